@@ -0,0 +1,103 @@
+// Package auth issues and verifies the bearer tokens callers authenticate with. A token is
+// the base64url encoded JSON claims followed by a dot and their base64url encoded HMAC-SHA256.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+type contextKey string
+
+const userIDContextKey contextKey = "auth_user_id"
+
+var (
+	ErrInvalidToken = errors.New("invalid bearer token")
+	ErrExpiredToken = errors.New("bearer token has expired")
+)
+
+type claims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenIssuer signs tokens with a shared secret, so any instance holding the same secret can verify them
+type TokenIssuer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// DefaultTokenTTL is how long tokens are valid for when no TTL is configured
+const DefaultTokenTTL = 24 * time.Hour
+
+func NewTokenIssuer(secret string, ttl time.Duration) *TokenIssuer {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &TokenIssuer{secret: []byte(secret), ttl: ttl, now: time.Now}
+}
+
+// Issue returns a token identifying userID and when it expires
+func (t *TokenIssuer) Issue(userID string) (string, time.Time, error) {
+	expiresAt := t.now().Add(t.ttl)
+
+	payload, err := json.Marshal(&claims{Subject: userID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + t.sign(encoded), expiresAt, nil
+}
+
+// Verify checks the signature and expiry of token and returns the ID of the user it identifies
+func (t *TokenIssuer) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(t.sign(parts[0]))) {
+		return "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	c := &claims{}
+	if err = json.Unmarshal(payload, c); err != nil || c.Subject == "" {
+		return "", ErrInvalidToken
+	}
+
+	if t.now().Unix() >= c.ExpiresAt {
+		return "", ErrExpiredToken
+	}
+	return c.Subject, nil
+}
+
+func (t *TokenIssuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated userID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey, userID)
+}
+
+// UserID returns the authenticated user stored in ctx by WithUserID
+func UserID(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(string)
+	return userID, ok && userID != ""
+}
@@ -11,47 +11,162 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/danvixent/aboki-africa-assessment/auth"
 	"github.com/danvixent/aboki-africa-assessment/config"
 	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
 	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/danvixent/aboki-africa-assessment/idempotency"
+	"github.com/danvixent/aboki-africa-assessment/leaderboard"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/danvixent/aboki-africa-assessment/webhook"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 )
 
-var configPath *string
+func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.Environ())
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-func init() {
-	configPath = flag.String("config_path", "", "path to config file")
-	flag.Parse()
-	if configPath == nil {
-		log.Fatalln("-config_path flag is required")
+	command := ""
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "", "serve":
+		serve(cfg)
+	case "migrate":
+		migrate(cfg, args)
+	case "reconcile":
+		reconcileBalances(cfg, args)
+	default:
+		log.Fatalf("unknown command %q, expected serve, migrate or reconcile", command)
 	}
 }
 
-func main() {
-	file, err := os.Open(*configPath)
+func serve(cfg *config.BaseConfig) {
+	shutdownTracing, err := tracing.Setup(cfg.Tracing)
 	if err != nil {
-		log.Fatalf("unable to open config file: %v", err)
+		log.Fatalf("failed to set up tracing: %v", err)
 	}
 
-	cfg := &config.BaseConfig{}
-	err = yaml.NewDecoder(file).Decode(cfg)
+	postgresClient := postgres.New(context.Background(), cfg.Postgres)
+	m := metrics.New()
+	postgresClient.RegisterMetrics(m.Registry)
+	userRepo := metrics.InstrumentUserRepository(postgres.NewUserRepository(postgresClient), m)
+	userReferralRepo := metrics.InstrumentUserReferralRepository(postgres.NewUserReferralRepository(postgresClient), m)
+	userPointsRepo := metrics.InstrumentUserPointRepository(postgres.NewUserPointsRepository(postgresClient), m)
+	ledgerRepo := postgres.NewLedgerRepository(postgresClient)
+	idempotencyRepo := postgres.NewIdempotencyRepository(postgresClient)
+	topupRepo := postgres.NewTopupRepository(postgresClient)
+	webhookEventRepo := postgres.NewWebhookEventRepository(postgresClient)
+	bankRecipientRepo := postgres.NewBankRecipientRepository(postgresClient)
+	withdrawalRepo := postgres.NewWithdrawalRepository(postgresClient)
+	outboxRepo := postgres.NewOutboxRepository(postgresClient)
+	webhookSubscriptionRepo := postgres.NewWebhookSubscriptionRepository(postgresClient)
+	webhookDeliveryRepo := postgres.NewWebhookDeliveryRepository(postgresClient)
+	signupCheckRepo := postgres.NewSignupCheckRepository(postgresClient)
+	leaderboardRepo := postgres.NewLeaderboardRepository(postgresClient)
+
+	program, err := referral.NewProgram(cfg.ReferralProgram)
 	if err != nil {
-		log.Fatalf("failed to decode config file: %v", err)
+		log.Fatalf("invalid referral program: %v", err)
 	}
 
-	postgresClient := postgres.New(context.Background(), cfg.Postgres)
-	userRepo := postgres.NewUserRepository(postgresClient)
-	userReferralRepo := postgres.NewUserReferralRepository(postgresClient)
-	userPointsRepo := postgres.NewUserPointsRepository(postgresClient)
+	tokenIssuer := auth.NewTokenIssuer(cfg.Auth.TokenSecret, cfg.Auth.TokenTTL)
 
-	h := handler.NewHandler(userRepo, userReferralRepo, userPointsRepo, postgresClient.BeginTx)
+	if cfg.Paystack == nil {
+		cfg.Paystack = &config.PaystackConfig{}
+	}
+	paystackClient := paystack.NewClient(cfg.PaystackAPIKey, cfg.Paystack.BaseURL)
+
+	h := handler.NewHandler(handler.Dependencies{
+		UserRepository:                userRepo,
+		UserReferralRepository:        userReferralRepo,
+		UserPointRepository:           userPointsRepo,
+		LedgerRepository:              ledgerRepo,
+		IdempotencyRepository:         idempotencyRepo,
+		TopupRepository:               topupRepo,
+		WebhookEventRepository:        webhookEventRepo,
+		BankRecipientRepository:       bankRecipientRepo,
+		WithdrawalRepository:          withdrawalRepo,
+		OutboxRepository:              outboxRepo,
+		WebhookSubscriptionRepository: webhookSubscriptionRepo,
+		WebhookDeliveryRepository:     webhookDeliveryRepo,
+		SignupCheckRepository:         signupCheckRepo,
+		LeaderboardRepository:         leaderboardRepo,
+		ReferralProgram:               program,
+		FraudChecker:                  fraud.NewChecker(signupCheckRepo, cfg.Fraud),
+		TokenIssuer:                   tokenIssuer,
+		PaystackClient:                paystackClient,
+		RunInTx:                       metrics.InstrumentTxRunner(postgresClient.RunInTx),
+	}, handler.Options{
+		PointPrice:   cfg.Paystack.PointPrice,
+		Withdrawals:  cfg.Withdrawals,
+		Webhooks:     cfg.Webhooks,
+		Idempotency:  cfg.Idempotency,
+		AdminUserIDs: cfg.Auth.AdminUserIDs,
+	})
+
+	// the workers stop with the server, events and deliveries they don't get to are handled on the next start
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := sync.WaitGroup{}
+
+	fanout := webhook.NewFanout(webhookSubscriptionRepo, webhookDeliveryRepo)
+	dispatcher := outbox.NewDispatcher(outboxRepo, postgresClient.RunInTx, cfg.Outbox, log.WithField("component", "outbox"),
+		outbox.NewLogPublisher(log.WithField("component", "outbox")), fanout)
+	deliverer := webhook.NewDeliverer(webhookSubscriptionRepo, webhookDeliveryRepo, postgresClient.RunInTx, cfg.Webhooks, log.WithField("component", "webhooks"))
+
+	refresher := leaderboard.NewRefresher(leaderboardRepo, cfg.Leaderboard, log.WithField("component", "leaderboard"))
+	purger := idempotency.NewPurger(idempotencyRepo, cfg.Idempotency, log.WithField("component", "idempotency"))
+
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		deliverer.Run(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		refresher.Run(workersCtx)
+	}()
+	go func() {
+		defer workers.Done()
+		purger.Run(workersCtx)
+	}()
+
+	migrator, err := postgres.NewMigrator(postgresClient)
+	if err != nil {
+		log.Fatalf("failed to create migrator: %v", err)
+	}
+
+	if cfg.Health == nil {
+		cfg.Health = &config.HealthConfig{}
+	}
+	checker := health.NewChecker(cfg.Health)
+	checker.Add("postgres", health.PingCheck(postgresClient))
+	checker.Add("migrations", health.MigrationCheck(migrator))
+	checker.Add("outbox", health.OutboxCheck(outboxRepo, dispatcher, cfg.Health.MaxOutboxLag))
 
 	router := httptreemux.New()
-	routes.SetupRoutes(router, h)
+	routes.SetupRoutes(router, h, m, checker, cfg.Server)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.ServePort,
@@ -69,7 +184,7 @@ func main() {
 
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscanll.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall. SIGKILL but can"t be catch, so no need to add it
@@ -77,11 +192,22 @@ func main() {
 	<-quit
 	log.Print("shutdown server ...")
 
+	// fail readiness first so load balancers stop sending requests before the listener closes
+	checker.Shutdown()
+	time.Sleep(cfg.Health.ShutdownDelay)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("server shutdown failed: %v", err)
 	}
+
+	stopWorkers()
+	workers.Wait()
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Printf("failed to flush traces: %v", err)
+	}
 	select {
 	case <-ctx.Done():
 		log.Print("timeout of 1 seconds.")
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	log "github.com/sirupsen/logrus"
+)
+
+// migrate runs the migrate subcommand: migrate up|down [-steps n]|status
+func migrate(cfg *config.BaseConfig, args []string) {
+	if len(args) == 0 {
+		log.Fatalln("migrate requires one of up, down or status")
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	steps := flags.Int("steps", 0, "number of migrations to revert, all of them when zero")
+	flags.Parse(args[1:])
+
+	ctx := context.Background()
+	migrator, err := postgres.NewMigrator(postgres.New(ctx, cfg.Postgres))
+	if err != nil {
+		log.Fatalf("failed to create migrator: %v", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate up failed: %v", err)
+		}
+		log.Printf("schema is at version %d", migrator.LatestVersion())
+	case "down":
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			log.Printf("reverted %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("migrate down failed: %v", err)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("migrate status failed: %v", err)
+		}
+
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%05d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		log.Fatalf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/reconcile"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	log "github.com/sirupsen/logrus"
+)
+
+// reconcileBalances reports transfers and transaction bonuses the ledger disagrees with and users whose cached
+// balance drifted from the ledger and, with -fix, corrects them.
+// It exits with status 1 when discrepancies are left so it can alert from a cron job.
+func reconcileBalances(cfg *config.BaseConfig, args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	format := flags.String("format", "json", "report format, json or csv")
+	output := flags.String("output", "", "file to write the report to, stdout when empty")
+	fix := flags.Bool("fix", false, "post an adjustment entry for each ledger discrepancy and set each drifted cached balance to the ledger balance")
+	flags.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		log.Fatalf("unknown format %q, expected json or csv", *format)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("unable to create report file: %v", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx := context.Background()
+	postgresClient := postgres.New(ctx, cfg.Postgres)
+
+	program, err := referral.NewProgram(cfg.ReferralProgram)
+	if err != nil {
+		log.Fatalf("invalid referral program: %v", err)
+	}
+
+	reconciler := reconcile.NewReconciler(
+		postgres.NewLedgerRepository(postgresClient),
+		postgres.NewUserPointsRepository(postgresClient),
+		postgres.NewUserReferralRepository(postgresClient),
+		program,
+		postgresClient.RunInTx,
+	)
+
+	report, runErr := reconciler.Run(ctx, *fix)
+	if report != nil {
+		var err error
+		if *format == "csv" {
+			err = report.WriteCSV(w)
+		} else {
+			err = report.WriteJSON(w)
+		}
+		if err != nil {
+			log.Fatalf("failed to write report: %v", err)
+		}
+	}
+
+	if runErr != nil {
+		log.Fatalf("reconcile failed: %v", runErr)
+	}
+
+	if n := report.Unfixed(); n > 0 {
+		log.Errorf("%d discrepancies are left, run with -fix to correct them", n)
+		os.Exit(1)
+	}
+}
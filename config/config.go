@@ -1,9 +1,112 @@
 package config
 
+import "time"
+
 type BaseConfig struct {
-	ServePort      string          `yaml:"serve_port"`
-	PaystackAPIKey string          `yaml:"paystack_api_key"`
-	Postgres       *PostgresConfig `yaml:"postgres"`
+	ServePort          string             `yaml:"serve_port"`
+	Server             *ServerConfig      `yaml:"server"`
+	PaystackAPIKey     string             `yaml:"paystack_api_key"`
+	PaystackAPIKeyFile string             `yaml:"paystack_api_key_file"` // read into PaystackAPIKey when it's set
+	Postgres           *PostgresConfig    `yaml:"postgres"`
+	ReferralProgram    *ReferralProgram   `yaml:"referral_program"`
+	Auth               *AuthConfig        `yaml:"auth"`
+	Paystack           *PaystackConfig    `yaml:"paystack"`
+	Withdrawals        *WithdrawalConfig  `yaml:"withdrawals"`
+	Outbox             *OutboxConfig      `yaml:"outbox"`
+	Webhooks           *WebhookConfig     `yaml:"webhooks"`
+	Fraud              *FraudConfig       `yaml:"fraud"`
+	Leaderboard        *LeaderboardConfig `yaml:"leaderboard"`
+	Tracing            *TracingConfig     `yaml:"tracing"`
+	Health             *HealthConfig      `yaml:"health"`
+	Idempotency        *IdempotencyConfig `yaml:"idempotency"`
+}
+
+// ServerConfig tunes how requests are served, a negative timeout means there's no limit
+type ServerConfig struct {
+	RequestTimeout time.Duration            `yaml:"request_timeout"` // how long a request may take, defaults to 30s
+	RouteTimeouts  map[string]time.Duration `yaml:"route_timeouts"`  // overrides RequestTimeout, keyed like "POST /withdrawals"
+}
+
+type PaystackConfig struct {
+	BaseURL    string `yaml:"base_url"`    // defaults to paystack.DefaultBaseURL
+	PointPrice int64  `yaml:"point_price"` // kobo charged for each point bought
+}
+
+// WithdrawalConfig prices and limits cash-outs of points, a zero limit means there's none
+type WithdrawalConfig struct {
+	PointRate  int64 `yaml:"point_rate"` // kobo paid out for each point withdrawn
+	MinPoints  int64 `yaml:"min_points"`
+	MaxPoints  int64 `yaml:"max_points"`  // the most points a single withdrawal may take
+	DailyLimit int64 `yaml:"daily_limit"` // the most points a user may withdraw in 24 hours
+}
+
+// OutboxConfig tunes the dispatcher that publishes outbox events
+type OutboxConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"` // wait between polls when there's nothing to publish
+	BatchSize    int           `yaml:"batch_size"`    // the most events published in one transaction
+	MaxBackoff   time.Duration `yaml:"max_backoff"`   // the longest wait before retrying an event that failed
+}
+
+// WebhookConfig tunes the delivery of outbox events to webhook subscriptions
+type WebhookConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"` // wait between polls when there's nothing to deliver
+	BatchSize    int           `yaml:"batch_size"`    // the most deliveries claimed at once
+	Timeout      time.Duration `yaml:"timeout"`       // how long a subscriber has to respond
+	MaxAttempts  int           `yaml:"max_attempts"`  // a delivery fails for good after this many attempts
+	RetryBackoff time.Duration `yaml:"retry_backoff"` // wait before the first retry, doubled on every retry after it
+	MaxBackoff   time.Duration `yaml:"max_backoff"`   // the longest wait between retries
+	// AllowPrivateAddresses lets subscriptions point at loopback, private and link-local addresses,
+	// it's only meant for local development since anyone could make the server call its own network
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses"`
+}
+
+// FraudConfig tunes the checks run on referred signups, zero values are replaced by the
+// defaults of package fraud and a negative limit disables its check
+type FraudConfig struct {
+	Window               time.Duration `yaml:"window"`                  // how far back signups from the same IP or device are counted
+	MaxSignupsPerIP      int64         `yaml:"max_signups_per_ip"`      // signups from one IP in Window before referrals from it are held
+	MaxSignupsPerDevice  int64         `yaml:"max_signups_per_device"`  // signups from one device in Window before referrals from it are held
+	BurstWindow          time.Duration `yaml:"burst_window"`            // how far back signups with the same referral code are counted
+	MaxReferralsPerBurst int64         `yaml:"max_referrals_per_burst"` // signups with one code in BurstWindow before the next ones are held
+	TrustForwardedFor    bool          `yaml:"trust_forwarded_for"`     // take the client IP from X-Forwarded-For, only safe behind a proxy that sets it
+	TrustedProxies       int           `yaml:"trusted_proxies"`         // proxies in front of the server appending to X-Forwarded-For, defaults to 1
+}
+
+// LeaderboardConfig tunes the refreshing of the cached referral leaderboard
+type LeaderboardConfig struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // how stale the leaderboard may get
+}
+
+// TracingConfig sets where OpenTelemetry spans are exported, see package tracing
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // none, stdout or file, defaults to none
+	File        string  `yaml:"file"`         // path spans are appended to by the file exporter, one JSON object each
+	SampleRatio float64 `yaml:"sample_ratio"` // share of the traces started here that are recorded, defaults to 1
+	ServiceName string  `yaml:"service_name"`
+}
+
+// HealthConfig tunes the /readyz checks and how the server drains on shutdown
+type HealthConfig struct {
+	CheckTimeout  time.Duration `yaml:"check_timeout"`  // how long each readiness check may take, defaults to 2s
+	MaxOutboxLag  time.Duration `yaml:"max_outbox_lag"` // readiness fails once the oldest unpublished event is older, zero disables it
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"` // how long readiness fails before the server stops, for load balancers to notice
+}
+
+// IdempotencyConfig tunes how long Idempotency-Key reservations and stored responses are kept
+type IdempotencyConfig struct {
+	// Lease is how long a request may hold its key before a retry takes it over, so a key left behind
+	// by a crash doesn't stay stuck. It defaults to 5m and must be longer than any request may run.
+	Lease         time.Duration `yaml:"lease"`
+	TTL           time.Duration `yaml:"ttl"`            // how long keys are kept after they were last used, defaults to 24h
+	PurgeInterval time.Duration `yaml:"purge_interval"` // wait between purges of expired keys, defaults to 1h
+}
+
+type AuthConfig struct {
+	TokenSecret     string        `yaml:"token_secret"`      // key the bearer tokens are signed with
+	TokenSecretFile string        `yaml:"token_secret_file"` // read into TokenSecret when it's set
+	TokenTTL        time.Duration `yaml:"token_ttl"`
+	// AdminUserIDs are the users allowed to call the /admin endpoints
+	AdminUserIDs []string `yaml:"admin_user_ids"`
 }
 
 type PostgresConfig struct {
@@ -13,4 +116,31 @@ type PostgresConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	MaxConn  int    `yaml:"max_conn"`
+
+	PasswordFile string `yaml:"password_file"` // read into Password when it's set, e.g. a mounted Docker or Kubernetes secret
+
+	SSLMode     string `yaml:"sslmode"`     // one of disable, allow, prefer, require, verify-ca or verify-full, defaults to disable
+	SSLRootCert string `yaml:"sslrootcert"` // CA certificate the server's is checked against by verify-ca and verify-full
+	SSLCert     string `yaml:"sslcert"`     // client certificate, SSLKey must be set with it
+	SSLKey      string `yaml:"sslkey"`
+
+	IsolationLevel string        `yaml:"isolation_level"` // one of read committed, repeatable read or serializable, defaults to read committed
+	MaxRetries     int           `yaml:"max_retries"`     // retries of a transaction that failed to serialize, a negative value disables them
+	RetryBackoff   time.Duration `yaml:"retry_backoff"`   // wait before the first retry, doubled on every retry after it
+}
+
+// ReferralProgram describes how referrers are rewarded, see package referral for how it's evaluated
+type ReferralProgram struct {
+	Rules []*ReferralRule `yaml:"rules"`
+	// UplineShares are the percentages of every reward paid on top of it to the referrer's own referrer,
+	// then to theirs and so on, e.g. [10, 5] pays 10% to the grand-referrer and 5% to the one above them
+	UplineShares []int64 `yaml:"upline_shares"`
+}
+
+type ReferralRule struct {
+	Name      string `yaml:"name"`
+	Event     string `yaml:"event"`     // the event that triggers the rule, one of referral.RefereeRegistered or referral.RefereeTransferred
+	Threshold int64  `yaml:"threshold"` // total points a referee must transfer to qualify, only used by referral.RefereeTransferred
+	BatchSize int64  `yaml:"batch_size"`
+	Reward    int64  `yaml:"reward"` // points paid to the referrer for every BatchSize qualifying referees
 }
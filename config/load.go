@@ -0,0 +1,269 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the names of the environment variables that override the config, the rest of a name is
+// the YAML path of the field it sets in upper case with dots as underscores, e.g. ABOKI_POSTGRES_PASSWORD
+const EnvPrefix = "ABOKI_"
+
+// ConfigPathEnv names the YAML file to load when there's no -config_path flag
+const ConfigPathEnv = EnvPrefix + "CONFIG_PATH"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is a field of BaseConfig that may be set from the environment or a flag
+type setting struct {
+	path  string // e.g. postgres.password, also the name of its flag
+	env   string
+	index []int
+	kind  reflect.Type
+}
+
+// override is a value given for a setting by the environment or a flag
+type override struct {
+	setting *setting
+	source  string
+	raw     string
+}
+
+// flagValue records the overrides given by a flag, they're applied once the YAML and the environment have been
+type flagValue struct {
+	setting   *setting
+	overrides *[]override
+}
+
+func (f *flagValue) String() string { return "" }
+
+func (f *flagValue) Set(raw string) error {
+	*f.overrides = append(*f.overrides, override{setting: f.setting, source: "-" + f.setting.path, raw: raw})
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.setting.kind.Kind() == reflect.Bool }
+
+// Load builds a BaseConfig from, in increasing precedence, the YAML file at -config_path (or ConfigPathEnv),
+// the EnvPrefix variables of environ and the flags in args, then reads the secrets files it names and validates
+// it. Every problem found is returned at once as Errors. Load also returns the arguments that follow the flags.
+//
+// Every scalar field, and every list of them written comma separated, has its own flag named after its YAML
+// path, e.g. -postgres.max_conn 10. Maps and lists of objects, like the referral rules, can only be set in YAML.
+func Load(args []string, environ []string) (*BaseConfig, []string, error) {
+	settings := settingsOf(reflect.TypeOf(BaseConfig{}), "", nil)
+
+	var flagOverrides []override
+	flags := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configPath := flags.String("config_path", "", "path to the YAML config file, "+ConfigPathEnv+" when not set")
+	for _, s := range settings {
+		flags.Var(&flagValue{setting: s, overrides: &flagOverrides}, s.path, "overrides "+s.path+", also set by "+s.env)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.IndexByte(kv, '='); i > 0 && strings.HasPrefix(kv[:i], EnvPrefix) {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	var errs Errors
+	path := *configPath
+	if path == "" {
+		path = env[ConfigPathEnv]
+	}
+	delete(env, ConfigPathEnv)
+
+	cfg := &BaseConfig{}
+	if path != "" {
+		if err := decodeFile(path, cfg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// an unknown variable is most likely a misspelt one, ignoring it would quietly leave the setting as it was
+	var envOverrides []override
+	byEnv := map[string]*setting{}
+	for _, s := range settings {
+		byEnv[s.env] = s
+	}
+	for name, raw := range env {
+		s, ok := byEnv[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: no such setting", name))
+			continue
+		}
+		envOverrides = append(envOverrides, override{setting: s, source: name, raw: raw})
+	}
+	sort.Slice(envOverrides, func(i, j int) bool { return envOverrides[i].source < envOverrides[j].source })
+
+	for _, o := range append(envOverrides, flagOverrides...) {
+		if err := o.setting.set(cfg, o.raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", o.source, err))
+		}
+	}
+
+	errs = append(errs, cfg.readSecrets()...)
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return cfg, flags.Args(), nil
+}
+
+// decodeFile decodes the YAML file at path into cfg, fields it doesn't know are an error
+func decodeFile(path string, cfg *BaseConfig) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.SetStrict(true)
+	if err = decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to decode config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// readSecrets replaces the secrets that have a *_file counterpart set with the contents of that file,
+// a file given at any layer wins over the secret itself so it needn't be cleared from the YAML
+func (c *BaseConfig) readSecrets() Errors {
+	var errs Errors
+	read := func(name string, file string, secret *string) {
+		if file == "" {
+			return
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			return
+		}
+		*secret = strings.TrimRight(string(b), "\r\n")
+	}
+
+	read("paystack_api_key_file", c.PaystackAPIKeyFile, &c.PaystackAPIKey)
+	if c.Postgres != nil {
+		read("postgres.password_file", c.Postgres.PasswordFile, &c.Postgres.Password)
+	}
+	if c.Auth != nil {
+		read("auth.token_secret_file", c.Auth.TokenSecretFile, &c.Auth.TokenSecret)
+	}
+	return errs
+}
+
+// settingsOf returns the settings of struct type t and of the structs it points to
+func settingsOf(t reflect.Type, prefix string, index []int) []*setting {
+	var settings []*setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := prefix + name
+		fieldIndex := append(append([]int{}, index...), i)
+		ft := f.Type
+		switch {
+		case ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct:
+			settings = append(settings, settingsOf(ft.Elem(), path+".", fieldIndex)...)
+		case isScalar(ft), ft.Kind() == reflect.Slice && isScalar(ft.Elem()):
+			env := EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+			settings = append(settings, &setting{path: path, env: env, index: fieldIndex, kind: ft})
+		}
+	}
+	return settings
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// set parses raw into the field s names, the structs on the way to it are allocated when they're nil
+func (s *setting) set(cfg *BaseConfig, raw string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, i := range s.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	if v.Kind() != reflect.Slice {
+		return parseScalar(v, raw)
+	}
+
+	items := reflect.MakeSlice(v.Type(), 0, 0)
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := parseScalar(elem, item); err != nil {
+			return err
+		}
+		items = reflect.Append(items, elem)
+	}
+	v.Set(items)
+	return nil
+}
+
+func parseScalar(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Errors are every problem found with a config, reported together so they can all be fixed in one go
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+var routeKey = regexp.MustCompile(`^[A-Z]+ /\S*$`)
+
+// Validate returns Errors listing every setting of c that's missing or out of range, nil when there's none.
+// The referral program is validated when it's compiled by referral.NewProgram.
+func (c *BaseConfig) Validate() error {
+	var errs Errors
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if !validPort(c.ServePort) {
+		fail("serve_port: expected a port number, got %q", c.ServePort)
+	}
+
+	if c.Server != nil {
+		for route := range c.Server.RouteTimeouts {
+			if !routeKey.MatchString(route) {
+				fail("server.route_timeouts: expected keys like \"POST /withdrawals\", got %q", route)
+			}
+		}
+	}
+
+	if c.Postgres == nil {
+		fail("postgres: is required")
+	} else {
+		p := c.Postgres
+		if p.Host == "" {
+			fail("postgres.host: is required")
+		}
+		if !validPort(p.Port) {
+			fail("postgres.port: expected a port number, got %q", p.Port)
+		}
+		if p.Database == "" {
+			fail("postgres.database: is required")
+		}
+		if p.Username == "" {
+			fail("postgres.username: is required")
+		}
+		if p.MaxConn < 0 {
+			fail("postgres.max_conn: must not be negative")
+		}
+		switch strings.ToLower(p.IsolationLevel) {
+		case "", "read committed", "repeatable read", "serializable":
+		default:
+			fail("postgres.isolation_level: expected read committed, repeatable read or serializable, got %q", p.IsolationLevel)
+		}
+		if p.RetryBackoff < 0 {
+			fail("postgres.retry_backoff: must not be negative")
+		}
+		switch p.SSLMode {
+		case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			fail("postgres.sslmode: expected disable, allow, prefer, require, verify-ca or verify-full, got %q", p.SSLMode)
+		}
+		if (p.SSLCert == "") != (p.SSLKey == "") {
+			fail("postgres.sslcert and postgres.sslkey: must be set together")
+		}
+	}
+
+	if c.Auth == nil || c.Auth.TokenSecret == "" {
+		fail("auth.token_secret: is required")
+	} else if c.Auth.TokenTTL < 0 {
+		fail("auth.token_ttl: must not be negative")
+	}
+
+	if c.Paystack != nil {
+		if c.Paystack.BaseURL != "" {
+			if u, err := url.Parse(c.Paystack.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				fail("paystack.base_url: expected an absolute URL, got %q", c.Paystack.BaseURL)
+			}
+		}
+		if c.Paystack.PointPrice < 0 {
+			fail("paystack.point_price: must not be negative")
+		}
+	}
+
+	if w := c.Withdrawals; w != nil {
+		if w.PointRate < 0 || w.MinPoints < 0 || w.MaxPoints < 0 || w.DailyLimit < 0 {
+			fail("withdrawals: point_rate and the limits must not be negative")
+		}
+		if w.MaxPoints > 0 && w.MinPoints > w.MaxPoints {
+			fail("withdrawals.min_points: %d is more than max_points %d", w.MinPoints, w.MaxPoints)
+		}
+	}
+
+	if o := c.Outbox; o != nil && (o.PollInterval < 0 || o.BatchSize < 0 || o.MaxBackoff < 0) {
+		fail("outbox: intervals and batch_size must not be negative")
+	}
+
+	if w := c.Webhooks; w != nil && (w.PollInterval < 0 || w.BatchSize < 0 || w.Timeout < 0 || w.MaxAttempts < 0 || w.RetryBackoff < 0 || w.MaxBackoff < 0) {
+		fail("webhooks: intervals, batch_size and max_attempts must not be negative")
+	}
+
+	if f := c.Fraud; f != nil && (f.Window < 0 || f.BurstWindow < 0 || f.TrustedProxies < 0) {
+		fail("fraud: window, burst_window and trusted_proxies must not be negative")
+	}
+
+	if c.Leaderboard != nil && c.Leaderboard.RefreshInterval < 0 {
+		fail("leaderboard.refresh_interval: must not be negative")
+	}
+
+	if t := c.Tracing; t != nil {
+		switch t.Exporter {
+		case "", "none", "stdout":
+		case "file":
+			if t.File == "" {
+				fail("tracing.file: is required by the file exporter")
+			}
+		default:
+			fail("tracing.exporter: expected none, stdout or file, got %q", t.Exporter)
+		}
+		if t.SampleRatio < 0 || t.SampleRatio > 1 {
+			fail("tracing.sample_ratio: expected a number between 0 and 1, got %v", t.SampleRatio)
+		}
+	}
+
+	if h := c.Health; h != nil && (h.CheckTimeout < 0 || h.MaxOutboxLag < 0 || h.ShutdownDelay < 0) {
+		fail("health: durations must not be negative")
+	}
+
+	if i := c.Idempotency; i != nil {
+		if i.Lease < 0 || i.TTL < 0 || i.PurgeInterval < 0 {
+			fail("idempotency: durations must not be negative")
+		} else if i.Lease > 0 && i.TTL > 0 && i.TTL <= i.Lease {
+			fail("idempotency.ttl: %s must be longer than lease %s", i.TTL, i.Lease)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
+
+// DSN returns the connection string of c, every part of it is escaped so passwords may hold any character
+func (c *PostgresConfig) DSN() string {
+	query := url.Values{}
+	query.Set("sslmode", "disable")
+	if c.SSLMode != "" {
+		query.Set("sslmode", c.SSLMode)
+	}
+	for name, value := range map[string]string{"sslrootcert": c.SSLRootCert, "sslcert": c.SSLCert, "sslkey": c.SSLKey} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if c.MaxConn > 0 {
+		query.Set("pool_max_conns", strconv.Itoa(c.MaxConn))
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.Username, c.Password),
+		Host:     net.JoinHostPort(c.Host, c.Port),
+		Path:     "/" + c.Database,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type IdempotencyRepository struct {
+	store *Store
+}
+
+func NewIdempotencyRepository(store *Store) *IdempotencyRepository {
+	return &IdempotencyRepository{store: store}
+}
+
+func (i *IdempotencyRepository) CreateIdempotencyKey(ctx context.Context, key *app.IdempotencyKey) error {
+	return i.store.run(ctx, func(data *state) error {
+		for _, k := range data.idempotencyKeys {
+			if k.Scope == key.Scope && k.Key == key.Key {
+				return errors.ErrDuplicate
+			}
+		}
+
+		key.ID = newID()
+		key.CreatedAt = time.Now()
+		key.UpdatedAt = key.CreatedAt
+
+		c := *key
+		data.idempotencyKeys = append(data.idempotencyKeys, &c)
+		return nil
+	})
+}
+
+func (i *IdempotencyRepository) FindIdempotencyKey(ctx context.Context, scope string, key string) (*app.IdempotencyKey, error) {
+	var found *app.IdempotencyKey
+	err := i.store.run(ctx, func(data *state) error {
+		for _, k := range data.idempotencyKeys {
+			if k.Scope == scope && k.Key == key {
+				c := *k
+				c.ResponseBody = append([]byte(nil), k.ResponseBody...)
+				found = &c
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+func (i *IdempotencyRepository) SaveIdempotencyKeyResponse(ctx context.Context, scope string, key string, status int, body []byte) error {
+	return i.store.run(ctx, func(data *state) error {
+		for _, k := range data.idempotencyKeys {
+			if k.Scope == scope && k.Key == key {
+				k.ResponseStatus = status
+				k.ResponseBody = append([]byte(nil), body...)
+				k.UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+func (i *IdempotencyRepository) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	return i.store.run(ctx, func(data *state) error {
+		for idx, k := range data.idempotencyKeys {
+			if k.Scope == scope && k.Key == key {
+				data.idempotencyKeys = append(data.idempotencyKeys[:idx], data.idempotencyKeys[idx+1:]...)
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func (i *IdempotencyRepository) TakeOverIdempotencyKey(ctx context.Context, scope string, key string, staleBefore time.Time) (bool, error) {
+	taken := false
+	err := i.store.run(ctx, func(data *state) error {
+		for _, k := range data.idempotencyKeys {
+			if k.Scope == scope && k.Key == key && !k.Completed() && k.UpdatedAt.Before(staleBefore) {
+				k.UpdatedAt = time.Now()
+				taken = true
+			}
+		}
+		return nil
+	})
+	return taken, err
+}
+
+func (i *IdempotencyRepository) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := i.store.run(ctx, func(data *state) error {
+		kept := data.idempotencyKeys[:0]
+		for _, k := range data.idempotencyKeys {
+			if k.UpdatedAt.Before(before) {
+				purged++
+				continue
+			}
+			kept = append(kept, k)
+		}
+		data.idempotencyKeys = kept
+		return nil
+	})
+	return purged, err
+}
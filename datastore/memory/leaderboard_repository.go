@@ -0,0 +1,190 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+type LeaderboardRepository struct {
+	store *Store
+}
+
+func NewLeaderboardRepository(store *Store) *LeaderboardRepository {
+	return &LeaderboardRepository{store: store}
+}
+
+// leaderboard is what RefreshLeaderboard computed, it's never changed so clones of the state share it
+type leaderboard struct {
+	refreshedAt time.Time
+	periods     map[app.LeaderboardPeriod][]*leaderboardRow
+}
+
+type leaderboardRow struct {
+	app.LeaderboardEntry
+	lastReferralAt time.Time
+	lastEarnedAt   time.Time
+	referralsRank  int64
+	pointsRank     int64
+}
+
+func (l *LeaderboardRepository) RefreshLeaderboard(ctx context.Context) error {
+	return l.store.run(ctx, func(data *state) error {
+		now := time.Now()
+		board := &leaderboard{refreshedAt: now, periods: map[app.LeaderboardPeriod][]*leaderboardRow{}}
+		for _, period := range app.LeaderboardPeriods {
+			board.periods[period] = data.leaderboardRows(period.Start(now))
+		}
+
+		data.leaderboard = board
+		return nil
+	})
+}
+
+func (l *LeaderboardRepository) GetLeaderboard(ctx context.Context, period app.LeaderboardPeriod, metric app.LeaderboardMetric, offset int, limit int) (*app.Leaderboard, error) {
+	board := &app.Leaderboard{Period: period, Metric: metric, Entries: []*app.LeaderboardEntry{}}
+	err := l.store.run(ctx, func(data *state) error {
+		if data.leaderboard == nil {
+			return nil
+		}
+
+		refreshedAt := data.leaderboard.refreshedAt
+		board.RefreshedAt = &refreshedAt
+
+		for _, row := range data.leaderboard.periods[period] {
+			rank := row.referralsRank
+			if metric == app.LeaderboardByPoints {
+				rank = row.pointsRank
+			}
+
+			// users without any of the metric are unranked, the ranks are the positions pages are cut at
+			if rank > 0 && rank > int64(offset) {
+				e := row.LeaderboardEntry
+				e.Rank = rank
+				board.Entries = append(board.Entries, &e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(board.Entries, func(i, j int) bool { return board.Entries[i].Rank < board.Entries[j].Rank })
+	if len(board.Entries) > limit {
+		board.Entries = board.Entries[:limit]
+		next := offset + limit
+		board.NextOffset = &next
+	}
+	return board, nil
+}
+
+// leaderboardRows totals the referrals and referral rewards of every active user since since and ranks them
+func (s *state) leaderboardRows(since time.Time) []*leaderboardRow {
+	byUser := map[string]*leaderboardRow{}
+	row := func(userID string) *leaderboardRow {
+		if r, ok := byUser[userID]; ok {
+			return r
+		}
+		r := &leaderboardRow{LeaderboardEntry: app.LeaderboardEntry{UserID: userID}}
+		byUser[userID] = r
+		return r
+	}
+
+	for _, r := range s.userReferrals {
+		if r.Held || r.DeletedAt != nil || r.CreatedAt.Before(since) {
+			continue
+		}
+
+		referrer := row(r.ReferrerID)
+		referrer.Referrals++
+		if r.CreatedAt.After(referrer.lastReferralAt) {
+			referrer.lastReferralAt = r.CreatedAt
+		}
+	}
+
+	for _, b := range s.transactionBonuses {
+		if b.DeletedAt == nil && !b.CreatedAt.Before(since) {
+			row(b.ReferrerID).QualifiedReferrals++
+		}
+	}
+
+	owners := map[string]string{}
+	for _, a := range s.accounts {
+		if a.UserID != nil {
+			owners[a.ID] = *a.UserID
+		}
+	}
+
+	for _, e := range s.journalEntries {
+		if !e.Kind.IsReferralReward() || e.CreatedAt.Before(since) {
+			continue
+		}
+
+		for _, p := range s.postings {
+			userID, ok := owners[p.AccountID]
+			if p.JournalEntryID != e.ID || !ok {
+				continue
+			}
+
+			earner := row(userID)
+			earner.Points += p.Amount
+			if e.CreatedAt.After(earner.lastEarnedAt) {
+				earner.lastEarnedAt = e.CreatedAt
+			}
+		}
+	}
+
+	rows := []*leaderboardRow{}
+	for _, user := range s.users {
+		if r, ok := byUser[user.ID]; ok && user.Active() {
+			r.Name = user.Name
+			rows = append(rows, r)
+		}
+	}
+
+	rank(rows, func(r *leaderboardRow) int64 { return r.Referrals }, func(a, b *leaderboardRow) bool {
+		return before(a.Referrals, b.Referrals, a.Points, b.Points, a.lastReferralAt, b.lastReferralAt, a.UserID, b.UserID)
+	}, func(r *leaderboardRow, rank int64) { r.referralsRank = rank })
+
+	rank(rows, func(r *leaderboardRow) int64 { return r.Points }, func(a, b *leaderboardRow) bool {
+		return before(a.Points, b.Points, a.Referrals, b.Referrals, a.lastEarnedAt, b.lastEarnedAt, a.UserID, b.UserID)
+	}, func(r *leaderboardRow, rank int64) { r.pointsRank = rank })
+	return rows
+}
+
+// rank numbers the rows whose value is positive in the order of less, the others are left unranked at zero
+func rank(rows []*leaderboardRow, value func(r *leaderboardRow) int64, less func(a, b *leaderboardRow) bool, set func(r *leaderboardRow, rank int64)) {
+	ranked := []*leaderboardRow{}
+	for _, r := range rows {
+		set(r, 0)
+		if value(r) > 0 {
+			ranked = append(ranked, r)
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+	for i, r := range ranked {
+		set(r, int64(i+1))
+	}
+}
+
+// before orders by metric then by tieBreaker, both descending, then by who got there first, a zero time
+// meaning never, then by user ID
+func before(metricA, metricB, tieBreakerA, tieBreakerB int64, reachedA, reachedB time.Time, userA, userB string) bool {
+	switch {
+	case metricA != metricB:
+		return metricA > metricB
+	case tieBreakerA != tieBreakerB:
+		return tieBreakerA > tieBreakerB
+	case !reachedA.Equal(reachedB):
+		if reachedA.IsZero() || reachedB.IsZero() {
+			return reachedB.IsZero()
+		}
+		return reachedA.Before(reachedB)
+	default:
+		return userA < userB
+	}
+}
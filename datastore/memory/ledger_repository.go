@@ -0,0 +1,231 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type LedgerRepository struct {
+	store *Store
+}
+
+func NewLedgerRepository(store *Store) *LedgerRepository {
+	return &LedgerRepository{store: store}
+}
+
+func (l *LedgerRepository) CreateAccount(ctx context.Context, account *app.Account) error {
+	return l.store.run(ctx, func(data *state) error {
+		return data.createAccount(account)
+	})
+}
+
+func (l *LedgerRepository) FindAccountByCode(ctx context.Context, code string) (*app.Account, error) {
+	var account *app.Account
+	err := l.store.run(ctx, func(data *state) error {
+		var err error
+		account, err = data.findAccount(func(a *app.Account) bool { return a.Code == code })
+		return err
+	})
+	return account, err
+}
+
+func (l *LedgerRepository) FindAccountByUserID(ctx context.Context, userID string) (*app.Account, error) {
+	var account *app.Account
+	err := l.store.run(ctx, func(data *state) error {
+		var err error
+		account, err = data.findAccount(func(a *app.Account) bool { return a.UserID != nil && *a.UserID == userID })
+		return err
+	})
+	return account, err
+}
+
+func (l *LedgerRepository) PostJournalEntry(ctx context.Context, entry *app.JournalEntry) error {
+	return l.store.run(ctx, func(data *state) error {
+		return data.postJournalEntry(entry)
+	})
+}
+
+func (l *LedgerRepository) GetAccountBalance(ctx context.Context, accountID string) (int64, error) {
+	var balance int64
+	err := l.store.run(ctx, func(data *state) error {
+		for _, p := range data.postings {
+			if p.AccountID == accountID {
+				balance += p.Amount
+			}
+		}
+		return nil
+	})
+	return balance, err
+}
+
+func (l *LedgerRepository) ListBalanceDiscrepancies(ctx context.Context) ([]*app.BalanceDiscrepancy, error) {
+	discrepancies := []*app.BalanceDiscrepancy{}
+	err := l.store.run(ctx, func(data *state) error {
+		for _, up := range data.userPoints {
+			if up.DeletedAt != nil {
+				continue
+			}
+
+			if d := data.balanceDiscrepancy(up); d != nil {
+				discrepancies = append(discrepancies, d)
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(discrepancies, func(i, j int) bool { return discrepancies[i].UserID < discrepancies[j].UserID })
+	return discrepancies, err
+}
+
+// ResyncUserBalance needs no lock, transactions on a Store are already serialized
+func (l *LedgerRepository) ResyncUserBalance(ctx context.Context, userID string) (*app.BalanceDiscrepancy, error) {
+	var discrepancy *app.BalanceDiscrepancy
+	err := l.store.run(ctx, func(data *state) error {
+		for _, up := range data.userPoints {
+			if up.UserID == userID && up.DeletedAt == nil {
+				if discrepancy = data.balanceDiscrepancy(up); discrepancy != nil {
+					up.Points = discrepancy.LedgerBalance
+					up.UpdatedAt = time.Now()
+				}
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return discrepancy, err
+}
+
+func (l *LedgerRepository) ListUserPostings(ctx context.Context, kind app.JournalEntryKind, userID string) ([]*app.UserPosting, error) {
+	postings := []*app.UserPosting{}
+	err := l.store.run(ctx, func(data *state) error {
+		users := map[string]string{}
+		for _, a := range data.accounts {
+			if a.UserID != nil && (userID == "" || *a.UserID == userID) {
+				users[a.ID] = *a.UserID
+			}
+		}
+
+		entries := map[string]*app.JournalEntry{}
+		for _, e := range data.journalEntries {
+			if e.Kind == kind {
+				entries[e.ID] = e
+			}
+		}
+
+		// postings are stored in the order their entries were posted
+		for _, p := range data.postings {
+			e, user := entries[p.JournalEntryID], users[p.AccountID]
+			if e != nil && user != "" {
+				postings = append(postings, &app.UserPosting{JournalEntryID: e.ID, Reference: e.Reference, UserID: user, Amount: p.Amount})
+			}
+		}
+		return nil
+	})
+	return postings, err
+}
+
+// balanceDiscrepancy compares up with the postings on its user's accounts, it returns nil when they agree
+func (s *state) balanceDiscrepancy(up *app.UserPoints) *app.BalanceDiscrepancy {
+	accounts := map[string]bool{}
+	for _, a := range s.accounts {
+		if a.UserID != nil && *a.UserID == up.UserID {
+			accounts[a.ID] = true
+		}
+	}
+
+	d := &app.BalanceDiscrepancy{UserID: up.UserID, CachedBalance: up.Points}
+	for _, p := range s.postings {
+		if accounts[p.AccountID] {
+			d.LedgerBalance += p.Amount
+		}
+	}
+
+	if d.Difference() == 0 {
+		return nil
+	}
+	return d
+}
+
+func (s *state) createAccount(account *app.Account) error {
+	for _, a := range s.accounts {
+		if a.Code == account.Code {
+			return errors.ErrDuplicate
+		}
+	}
+
+	account.ID = newID()
+	account.CreatedAt = time.Now()
+	account.UpdatedAt = account.CreatedAt
+
+	c := *account
+	s.accounts = append(s.accounts, &c)
+	return nil
+}
+
+func (s *state) findAccount(fn func(a *app.Account) bool) (*app.Account, error) {
+	for _, a := range s.accounts {
+		if a.DeletedAt == nil && fn(a) {
+			c := *a
+			return &c, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// postJournalEntry saves entry and its postings, then applies each posting to the user's cached balance
+func (s *state) postJournalEntry(entry *app.JournalEntry) error {
+	if !entry.IsBalanced() {
+		return errors.ErrUnbalancedJournalEntry
+	}
+
+	accounts := make([]*app.Account, len(entry.Postings))
+	for i, p := range entry.Postings {
+		account, err := s.findAccount(func(a *app.Account) bool { return a.ID == p.AccountID })
+		if err != nil {
+			return errors.Wrap(err, "failed to find posting account")
+		}
+		accounts[i] = account
+
+		// user balances can't go below zero, system accounts may
+		if account.UserID != nil && p.Amount < 0 {
+			for _, up := range s.userPoints {
+				if up.UserID == *account.UserID && up.DeletedAt == nil && up.Points+p.Amount < 0 {
+					return errors.ErrInsufficientFunds
+				}
+			}
+		}
+	}
+
+	entry.ID = newID()
+	entry.CreatedAt = time.Now()
+
+	c := *entry
+	c.Postings = nil
+	s.journalEntries = append(s.journalEntries, &c)
+
+	for i, p := range entry.Postings {
+		p.ID = newID()
+		p.JournalEntryID = entry.ID
+		p.CreatedAt = entry.CreatedAt
+
+		posting := *p
+		s.postings = append(s.postings, &posting)
+
+		if accounts[i].UserID == nil {
+			continue
+		}
+
+		for _, up := range s.userPoints {
+			if up.UserID == *accounts[i].UserID && up.DeletedAt == nil {
+				up.Points += p.Amount
+				up.UpdatedAt = entry.CreatedAt
+			}
+		}
+	}
+	return nil
+}
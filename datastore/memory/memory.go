@@ -0,0 +1,146 @@
+// Package memory implements the repositories in package app without a database,
+// it's meant for running the handlers and routes in hermetic tests.
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+var ErrTxClosed = errors.New("transaction has already been committed or rolled back")
+
+// Store holds every table in memory. Transactions are serializable: a transaction holds the
+// store's lock from BeginTx until it is committed or rolled back, and works on a copy of the
+// data which replaces the store's data only on commit.
+type Store struct {
+	lock chan struct{}
+	data *state
+}
+
+// systemAccounts are the accounts seeded by the migrations
+var systemAccounts = []string{
+	app.ReferralBonusExpenseAccount,
+	app.OpeningBalanceAccount,
+	app.PointSalesAccount,
+	app.WithdrawalHoldAccount,
+	app.WithdrawalsPaidAccount,
+	app.ReconciliationAccount,
+}
+
+// New returns a Store that has only the system accounts
+func New() *Store {
+	s := &Store{lock: make(chan struct{}, 1), data: &state{}}
+	for _, code := range systemAccounts {
+		s.data.createAccount(&app.Account{Code: code, Kind: app.SystemAccountKind})
+	}
+	return s
+}
+
+// BeginTx starts a new transaction
+func (s *Store) BeginTx() (app.Tx, error) {
+	s.lock <- struct{}{}
+	return &Tx{store: s, data: s.data.clone()}, nil
+}
+
+// RunInTx runs fn in a new transaction, it satisfies the app.TxRunner expected by handler.NewHandler.
+// Transactions on a Store can't fail to serialize so fn is never retried. When ctx already carries a
+// transaction, fn runs in a savepoint of it: a copy of its data that replaces it only if fn succeeds.
+func (s *Store) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var tx app.Tx
+	if parent, ok := ctx.Value(app.TxContextKey).(*Tx); ok {
+		if parent.done {
+			return ErrTxClosed
+		}
+		tx = &Tx{store: s, data: parent.data.clone(), parent: parent}
+	} else {
+		var err error
+		if tx, err = s.BeginTx(); err != nil {
+			return err
+		}
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, app.TxContextKey, tx)); err != nil {
+		return err
+	}
+
+	// like a database, a transaction whose context is done is rolled back rather than committed
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Tx is a transaction on a Store
+type Tx struct {
+	store  *Store
+	data   *state
+	done   bool
+	parent *Tx // the transaction a savepoint was taken in, it holds the store's lock
+}
+
+func (t *Tx) Commit(ctx context.Context) error {
+	if t.done {
+		return ErrTxClosed
+	}
+
+	t.done = true
+	if t.parent != nil {
+		t.parent.data = t.data
+		return nil
+	}
+
+	t.store.data = t.data
+	<-t.store.lock
+	return nil
+}
+
+func (t *Tx) Rollback(ctx context.Context) error {
+	if t.done {
+		return ErrTxClosed
+	}
+
+	t.done = true
+	if t.parent == nil {
+		<-t.store.lock
+	}
+	return nil
+}
+
+// run calls fn with the data visible to ctx: the transaction's copy if ctx carries
+// one, otherwise the store's data, which is locked for the duration of fn. Nothing is run once ctx is done.
+func (s *Store) run(ctx context.Context, fn func(data *state) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if tx, ok := ctx.Value(app.TxContextKey).(*Tx); ok {
+		if tx.done {
+			return ErrTxClosed
+		}
+		return fn(tx.data)
+	}
+
+	s.lock <- struct{}{}
+	defer func() { <-s.lock }()
+	return fn(s.data)
+}
+
+// newID returns a random version 4 UUID
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
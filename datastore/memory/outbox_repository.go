@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/jackc/pgx/v4"
+)
+
+type OutboxRepository struct {
+	store *Store
+}
+
+func NewOutboxRepository(store *Store) *OutboxRepository {
+	return &OutboxRepository{store: store}
+}
+
+func (o *OutboxRepository) CreateOutboxEvent(ctx context.Context, event *app.OutboxEvent) error {
+	return o.store.run(ctx, func(data *state) error {
+		event.ID = newID()
+		event.CreatedAt = time.Now()
+		event.AvailableAt = event.CreatedAt
+
+		c := *event
+		c.Payload = append([]byte(nil), event.Payload...)
+		data.outboxEvents = append(data.outboxEvents, &c)
+		return nil
+	})
+}
+
+// ClaimOutboxEvents doesn't lock anything, transactions on a Store are already serialized
+func (o *OutboxRepository) ClaimOutboxEvents(ctx context.Context, limit int) ([]*app.OutboxEvent, error) {
+	events := []*app.OutboxEvent{}
+	err := o.store.run(ctx, func(data *state) error {
+		now := time.Now()
+		for _, e := range data.outboxEvents {
+			if e.PublishedAt == nil && !e.AvailableAt.After(now) {
+				c := *e
+				c.Payload = append([]byte(nil), e.Payload...)
+				events = append(events, &c)
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, err
+}
+
+func (o *OutboxRepository) MarkOutboxEventPublished(ctx context.Context, id string) error {
+	return o.update(ctx, id, func(e *app.OutboxEvent) {
+		now := time.Now()
+		e.PublishedAt = &now
+	})
+}
+
+func (o *OutboxRepository) MarkOutboxEventFailed(ctx context.Context, id string, reason string, retryAt time.Time) error {
+	return o.update(ctx, id, func(e *app.OutboxEvent) {
+		e.Attempts++
+		e.LastError = reason
+		e.AvailableAt = retryAt
+	})
+}
+
+func (o *OutboxRepository) GetOutboxBacklog(ctx context.Context) (*app.OutboxBacklog, error) {
+	backlog := &app.OutboxBacklog{}
+	err := o.store.run(ctx, func(data *state) error {
+		for _, e := range data.outboxEvents {
+			if e.PublishedAt != nil {
+				continue
+			}
+
+			backlog.Pending++
+			if backlog.OldestCreatedAt == nil || e.CreatedAt.Before(*backlog.OldestCreatedAt) {
+				createdAt := e.CreatedAt
+				backlog.OldestCreatedAt = &createdAt
+			}
+		}
+		return nil
+	})
+	return backlog, err
+}
+
+func (o *OutboxRepository) update(ctx context.Context, id string, fn func(e *app.OutboxEvent)) error {
+	return o.store.run(ctx, func(data *state) error {
+		for _, e := range data.outboxEvents {
+			if e.ID == id {
+				fn(e)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type SignupCheckRepository struct {
+	store *Store
+}
+
+func NewSignupCheckRepository(store *Store) *SignupCheckRepository {
+	return &SignupCheckRepository{store: store}
+}
+
+func (s *SignupCheckRepository) CreateSignupCheck(ctx context.Context, check *app.SignupCheck) error {
+	return s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if c.UserID == check.UserID {
+				return errors.ErrDuplicate
+			}
+		}
+
+		if check.Reasons == nil {
+			check.Reasons = []string{}
+		}
+
+		check.ID = newID()
+		check.CreatedAt = time.Now()
+
+		data.signupChecks = append(data.signupChecks, cloneSignupCheck(check))
+		return nil
+	})
+}
+
+func (s *SignupCheckRepository) FindSignupCheckByID(ctx context.Context, id string) (*app.SignupCheck, error) {
+	return s.find(ctx, func(c *app.SignupCheck) bool { return c.ID == id })
+}
+
+func (s *SignupCheckRepository) FindUserSignupCheck(ctx context.Context, userID string) (*app.SignupCheck, error) {
+	return s.find(ctx, func(c *app.SignupCheck) bool { return c.UserID == userID })
+}
+
+func (s *SignupCheckRepository) CountSignupMatches(ctx context.Context, check *app.SignupCheck, since time.Time) (*app.SignupMatches, error) {
+	matches := &app.SignupMatches{}
+	err := s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if c.NormalizedEmail == check.NormalizedEmail {
+				matches.SameEmail++
+			}
+
+			if c.CreatedAt.Before(since) {
+				continue
+			}
+
+			if check.IPAddress != "" && c.IPAddress == check.IPAddress {
+				matches.SameIP++
+			}
+
+			if check.DeviceFingerprint != "" && c.DeviceFingerprint == check.DeviceFingerprint {
+				matches.SameDevice++
+			}
+		}
+		return nil
+	})
+	return matches, err
+}
+
+func (s *SignupCheckRepository) CountReferrerSignups(ctx context.Context, referrerID string, since time.Time) (int64, error) {
+	var count int64
+	err := s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if c.ReferrerID != nil && *c.ReferrerID == referrerID && !c.CreatedAt.Before(since) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (s *SignupCheckRepository) ListSignupChecks(ctx context.Context, decision app.ReferralDecision, limit int) ([]*app.SignupCheck, error) {
+	checks := []*app.SignupCheck{}
+	err := s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if c.Decision == decision {
+				checks = append(checks, cloneSignupCheck(c))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].CreatedAt.After(checks[j].CreatedAt) })
+	if len(checks) > limit {
+		checks = checks[:limit]
+	}
+	return checks, nil
+}
+
+func (s *SignupCheckRepository) UpdateSignupCheckDecision(ctx context.Context, check *app.SignupCheck) error {
+	return s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if c.ID == check.ID {
+				c.Decision = check.Decision
+				c.ReviewedAt = check.ReviewedAt
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
+
+func (s *SignupCheckRepository) find(ctx context.Context, match func(c *app.SignupCheck) bool) (*app.SignupCheck, error) {
+	var found *app.SignupCheck
+	err := s.store.run(ctx, func(data *state) error {
+		for _, c := range data.signupChecks {
+			if match(c) {
+				found = cloneSignupCheck(c)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+func cloneSignupCheck(c *app.SignupCheck) *app.SignupCheck {
+	clone := *c
+	clone.Reasons = append([]string{}, c.Reasons...)
+	return &clone
+}
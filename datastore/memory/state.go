@@ -0,0 +1,121 @@
+package memory
+
+import (
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+// state is the content of every table, records are stored by pointer and
+// copied whenever they leave the store or a transaction clones the state
+type state struct {
+	users                []*app.User
+	userReferrals        []*app.UserReferral
+	transactionBonuses   []*app.ReferredUserTransactionBonus
+	userPoints           []*app.UserPoints
+	transactions         []*app.Transaction
+	accounts             []*app.Account
+	journalEntries       []*app.JournalEntry
+	postings             []*app.Posting
+	idempotencyKeys      []*app.IdempotencyKey
+	topups               []*app.Topup
+	webhookEvents        []*app.WebhookEvent
+	bankRecipients       []*app.BankRecipient
+	withdrawals          []*app.Withdrawal
+	outboxEvents         []*app.OutboxEvent
+	webhookSubscriptions []*app.WebhookSubscription
+	webhookDeliveries    []*app.WebhookDelivery
+	signupChecks         []*app.SignupCheck
+	leaderboard          *leaderboard
+}
+
+func (s *state) clone() *state {
+	c := &state{}
+
+	for _, v := range s.users {
+		u := *v
+		c.users = append(c.users, &u)
+	}
+
+	for _, v := range s.userReferrals {
+		r := *v
+		c.userReferrals = append(c.userReferrals, &r)
+	}
+
+	for _, v := range s.transactionBonuses {
+		b := *v
+		c.transactionBonuses = append(c.transactionBonuses, &b)
+	}
+
+	for _, v := range s.userPoints {
+		p := *v
+		c.userPoints = append(c.userPoints, &p)
+	}
+
+	for _, v := range s.transactions {
+		t := *v
+		c.transactions = append(c.transactions, &t)
+	}
+
+	for _, v := range s.accounts {
+		a := *v
+		c.accounts = append(c.accounts, &a)
+	}
+
+	for _, v := range s.journalEntries {
+		e := *v
+		c.journalEntries = append(c.journalEntries, &e)
+	}
+
+	for _, v := range s.postings {
+		p := *v
+		c.postings = append(c.postings, &p)
+	}
+
+	for _, v := range s.idempotencyKeys {
+		k := *v
+		k.ResponseBody = append([]byte(nil), v.ResponseBody...)
+		c.idempotencyKeys = append(c.idempotencyKeys, &k)
+	}
+
+	for _, v := range s.topups {
+		t := *v
+		c.topups = append(c.topups, &t)
+	}
+
+	for _, v := range s.webhookEvents {
+		e := *v
+		e.Payload = append([]byte(nil), v.Payload...)
+		c.webhookEvents = append(c.webhookEvents, &e)
+	}
+
+	for _, v := range s.bankRecipients {
+		r := *v
+		c.bankRecipients = append(c.bankRecipients, &r)
+	}
+
+	for _, v := range s.withdrawals {
+		w := *v
+		c.withdrawals = append(c.withdrawals, &w)
+	}
+
+	for _, v := range s.outboxEvents {
+		e := *v
+		e.Payload = append([]byte(nil), v.Payload...)
+		c.outboxEvents = append(c.outboxEvents, &e)
+	}
+
+	for _, v := range s.webhookSubscriptions {
+		c.webhookSubscriptions = append(c.webhookSubscriptions, cloneWebhookSubscription(v))
+	}
+
+	for _, v := range s.webhookDeliveries {
+		c.webhookDeliveries = append(c.webhookDeliveries, cloneWebhookDelivery(v))
+	}
+
+	for _, v := range s.signupChecks {
+		c.signupChecks = append(c.signupChecks, cloneSignupCheck(v))
+	}
+
+	c.leaderboard = s.leaderboard
+
+	return c
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type TopupRepository struct {
+	store *Store
+}
+
+func NewTopupRepository(store *Store) *TopupRepository {
+	return &TopupRepository{store: store}
+}
+
+func (t *TopupRepository) CreateTopup(ctx context.Context, topup *app.Topup) error {
+	return t.store.run(ctx, func(data *state) error {
+		for _, v := range data.topups {
+			if v.Reference == topup.Reference {
+				return errors.ErrDuplicate
+			}
+		}
+
+		topup.ID = newID()
+		topup.CreatedAt = time.Now()
+		topup.UpdatedAt = topup.CreatedAt
+
+		c := *topup
+		data.topups = append(data.topups, &c)
+		return nil
+	})
+}
+
+func (t *TopupRepository) FindTopupByReference(ctx context.Context, reference string) (*app.Topup, error) {
+	var found *app.Topup
+	err := t.store.run(ctx, func(data *state) error {
+		for _, v := range data.topups {
+			if v.Reference == reference {
+				c := *v
+				found = &c
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+// LockTopupByReference is FindTopupByReference, transactions on a Store are already serialized
+func (t *TopupRepository) LockTopupByReference(ctx context.Context, reference string) (*app.Topup, error) {
+	return t.FindTopupByReference(ctx, reference)
+}
+
+func (t *TopupRepository) UpdateTopupStatus(ctx context.Context, topup *app.Topup) error {
+	return t.store.run(ctx, func(data *state) error {
+		for _, v := range data.topups {
+			if v.ID == topup.ID {
+				v.Status = topup.Status
+				v.PaidAt = topup.PaidAt
+				v.UpdatedAt = time.Now()
+				topup.UpdatedAt = v.UpdatedAt
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
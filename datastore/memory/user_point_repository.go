@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type UserPointsRepository struct {
+	store *Store
+}
+
+func NewUserPointsRepository(store *Store) *UserPointsRepository {
+	return &UserPointsRepository{store: store}
+}
+
+// CreateUserPoint creates the user's points balance along with their ledger account,
+// a non-zero userPoint.Points is posted as an opening balance against OpeningBalanceAccount
+func (u *UserPointsRepository) CreateUserPoint(ctx context.Context, userPoint *app.UserPoints) error {
+	return u.store.run(ctx, func(data *state) error {
+		userPoint.ID = newID()
+		userPoint.CreatedAt = time.Now()
+		userPoint.UpdatedAt = userPoint.CreatedAt
+
+		c := *userPoint
+		c.Points = 0
+		data.userPoints = append(data.userPoints, &c)
+
+		account := &app.Account{
+			Code:   app.UserAccountCode(userPoint.UserID),
+			Kind:   app.UserAccountKind,
+			UserID: &c.UserID,
+		}
+
+		if err := data.createAccount(account); err != nil {
+			return errors.Wrap(err, "failed to create user account")
+		}
+
+		if userPoint.Points == 0 {
+			return nil
+		}
+
+		equity, err := data.findAccount(func(a *app.Account) bool { return a.Code == app.OpeningBalanceAccount })
+		if err != nil {
+			return errors.Wrap(err, "failed to find opening balance account")
+		}
+
+		entry := app.NewTransferEntry(app.OpeningBalanceEntry, userPoint.ID, "opening balance", equity.ID, account.ID, userPoint.Points)
+		return data.postJournalEntry(entry)
+	})
+}
+
+func (u *UserPointsRepository) GetUserPointsBalance(ctx context.Context, userID string) (int64, error) {
+	var balance int64
+	err := u.store.run(ctx, func(data *state) error {
+		for _, p := range data.userPoints {
+			if p.UserID == userID && p.DeletedAt == nil {
+				balance = p.Points
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return balance, err
+}
+
+// LockUserPointsBalance is GetUserPointsBalance, transactions on a Store are already serialized
+func (u *UserPointsRepository) LockUserPointsBalance(ctx context.Context, userID string) (int64, error) {
+	return u.GetUserPointsBalance(ctx, userID)
+}
+
+func (u *UserPointsRepository) GetUserTotalTransferredPoints(ctx context.Context, userID string) (int64, error) {
+	var total int64
+	err := u.store.run(ctx, func(data *state) error {
+		for _, t := range data.transactions {
+			if t.UserID == userID && t.DeletedAt == nil {
+				total += t.Points
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+func (u *UserPointsRepository) CreatePointTransaction(ctx context.Context, txn *app.Transaction) error {
+	return u.store.run(ctx, func(data *state) error {
+		txn.ID = newID()
+		txn.CreatedAt = time.Now()
+		txn.UpdatedAt = txn.CreatedAt
+
+		c := *txn
+		data.transactions = append(data.transactions, &c)
+		return nil
+	})
+}
+
+func (u *UserPointsRepository) ListPointTransactions(ctx context.Context) ([]*app.Transaction, error) {
+	txns := []*app.Transaction{}
+	err := u.store.run(ctx, func(data *state) error {
+		for _, t := range data.transactions {
+			if t.DeletedAt == nil {
+				c := *t
+				txns = append(txns, &c)
+			}
+		}
+		return nil
+	})
+	return txns, err
+}
+
+func (u *UserPointsRepository) ListUserTransactions(ctx context.Context, userID string, filter *app.TransactionHistoryFilter) ([]*app.TransactionHistoryItem, error) {
+	items := []*app.TransactionHistoryItem{}
+	err := u.store.run(ctx, func(data *state) error {
+		postings := []*app.Posting{}
+		for _, p := range data.userPostings(userID) {
+			switch {
+			case filter.Direction == app.SentDirection && p.Amount > 0,
+				filter.Direction == app.ReceivedDirection && p.Amount < 0,
+				filter.From != nil && p.CreatedAt.Before(*filter.From),
+				filter.To != nil && !p.CreatedAt.Before(*filter.To),
+				filter.Before != nil && !postingBefore(p, *filter.Before, filter.BeforeID):
+				continue
+			}
+			postings = append(postings, p)
+		}
+
+		sort.Slice(postings, func(i, j int) bool {
+			return postingBefore(postings[j], postings[i].CreatedAt, postings[i].ID)
+		})
+
+		if len(postings) > filter.Limit {
+			postings = postings[:filter.Limit]
+		}
+
+		for _, p := range postings {
+			items = append(items, data.historyItem(p))
+		}
+		return nil
+	})
+	return items, err
+}
+
+// postingBefore reports whether p sorts before the (createdAt, id) keyset cursor
+func postingBefore(p *app.Posting, createdAt time.Time, id string) bool {
+	if p.CreatedAt.Equal(createdAt) {
+		return p.ID < id
+	}
+	return p.CreatedAt.Before(createdAt)
+}
+
+func (s *state) historyItem(p *app.Posting) *app.TransactionHistoryItem {
+	item := &app.TransactionHistoryItem{
+		ID:        p.ID,
+		Direction: app.ReceivedDirection,
+		Points:    p.Amount,
+		CreatedAt: p.CreatedAt,
+	}
+
+	if p.Amount < 0 {
+		item.Direction, item.Points = app.SentDirection, -p.Amount
+	}
+
+	for _, e := range s.journalEntries {
+		if e.ID == p.JournalEntryID {
+			item.Kind, item.Reference, item.Description = e.Kind, e.Reference, e.Description
+		}
+	}
+
+	for _, o := range s.postings {
+		if o.JournalEntryID != p.JournalEntryID || o.ID == p.ID {
+			continue
+		}
+
+		if account, err := s.findAccount(func(a *app.Account) bool { return a.ID == o.AccountID }); err == nil {
+			item.CounterpartyUserID = account.UserID
+		}
+		break
+	}
+	return item
+}
+
+func (u *UserPointsRepository) GetUserReferralEarnings(ctx context.Context, userID string) (int64, error) {
+	var earnings int64
+	err := u.store.run(ctx, func(data *state) error {
+		for _, p := range data.userPostings(userID) {
+			item := data.historyItem(p)
+			if item.Kind.IsReferralReward() {
+				earnings += p.Amount
+			}
+		}
+		return nil
+	})
+	return earnings, err
+}
+
+func (u *UserPointsRepository) GetUserLastActivity(ctx context.Context, userID string) (*time.Time, error) {
+	var last *time.Time
+	err := u.store.run(ctx, func(data *state) error {
+		for _, p := range data.userPostings(userID) {
+			if last == nil || p.CreatedAt.After(*last) {
+				at := p.CreatedAt
+				last = &at
+			}
+		}
+		return nil
+	})
+	return last, err
+}
+
+// userPostings returns the postings on userID's account
+func (s *state) userPostings(userID string) []*app.Posting {
+	account, err := s.findAccount(func(a *app.Account) bool { return a.UserID != nil && *a.UserID == userID })
+	if err != nil {
+		return nil
+	}
+
+	postings := []*app.Posting{}
+	for _, p := range s.postings {
+		if p.AccountID == account.ID {
+			postings = append(postings, p)
+		}
+	}
+	return postings
+}
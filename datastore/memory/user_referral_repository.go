@@ -0,0 +1,288 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type UserReferralRepository struct {
+	store *Store
+}
+
+func NewUserReferralRepository(store *Store) *UserReferralRepository {
+	return &UserReferralRepository{store: store}
+}
+
+func (u *UserReferralRepository) CreateUserReferral(ctx context.Context, referral *app.UserReferral) error {
+	return u.store.run(ctx, func(data *state) error {
+		referral.ID = newID()
+		referral.CreatedAt = time.Now()
+		referral.UpdatedAt = referral.CreatedAt
+
+		c := *referral
+		data.userReferrals = append(data.userReferrals, &c)
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) GetUnpaidUserReferralCount(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	err := u.store.run(ctx, func(data *state) error {
+		for _, r := range data.userReferrals {
+			if r.ReferrerID == userID && !r.PaidOut && !r.Held && r.DeletedAt == nil {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+func (u *UserReferralRepository) MarkPendingReferralsAsPaid(ctx context.Context, referrerID string, limit int64) ([]string, error) {
+	refereeIDs := []string{}
+	err := u.store.run(ctx, func(data *state) error {
+		refereeIDs = refereeIDs[:0]
+		// referrals are kept in the order they were made, so the oldest are paid first
+		for _, r := range data.userReferrals {
+			if limit == 0 {
+				break
+			}
+			if r.ReferrerID == referrerID && !r.PaidOut && !r.Held && r.DeletedAt == nil {
+				r.PaidOut = true
+				r.UpdatedAt = time.Now()
+				refereeIDs = append(refereeIDs, r.RefereeID)
+				limit--
+			}
+		}
+		return nil
+	})
+	return refereeIDs, err
+}
+
+func (u *UserReferralRepository) GetUserReferrer(ctx context.Context, userID string) (*app.User, error) {
+	var user *app.User
+	err := u.store.run(ctx, func(data *state) error {
+		for _, r := range data.userReferrals {
+			if r.RefereeID != userID || r.DeletedAt != nil {
+				continue
+			}
+
+			for _, existing := range data.users {
+				if existing.ID == r.ReferrerID {
+					c := *existing
+					user = &c
+					return nil
+				}
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return user, err
+}
+
+func (u *UserReferralRepository) CreateReferredUserTransactionBonus(ctx context.Context, referral *app.ReferredUserTransactionBonus) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, b := range data.transactionBonuses {
+			if b.RefereeID == referral.RefereeID {
+				return errors.ErrDuplicate
+			}
+		}
+
+		referral.ID = newID()
+		referral.CreatedAt = time.Now()
+		referral.UpdatedAt = referral.CreatedAt
+
+		c := *referral
+		data.transactionBonuses = append(data.transactionBonuses, &c)
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) GetUnpaidReferredUserTransactionBonus(ctx context.Context, userID string, limit int64) ([]*app.ReferredUserTransactionBonus, error) {
+	bonuses := []*app.ReferredUserTransactionBonus{}
+	err := u.store.run(ctx, func(data *state) error {
+		for _, b := range data.transactionBonuses {
+			if limit > 0 && int64(len(bonuses)) == limit {
+				break
+			}
+
+			if b.ReferrerID == userID && !b.PaidOut && b.DeletedAt == nil && !data.referralHeld(b.RefereeID) {
+				c := *b
+				bonuses = append(bonuses, &c)
+			}
+		}
+		return nil
+	})
+	return bonuses, err
+}
+
+func (u *UserReferralRepository) PayReferralsTransactionsBonuses(ctx context.Context, ids []string) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, b := range data.transactionBonuses {
+			for _, id := range ids {
+				if b.ID == id && b.DeletedAt == nil {
+					b.PaidOut = true
+					b.UpdatedAt = time.Now()
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) ListPaidReferredUserTransactionBonuses(ctx context.Context) ([]*app.ReferredUserTransactionBonus, error) {
+	bonuses := []*app.ReferredUserTransactionBonus{}
+	err := u.store.run(ctx, func(data *state) error {
+		for _, b := range data.transactionBonuses {
+			if b.PaidOut {
+				c := *b
+				bonuses = append(bonuses, &c)
+			}
+		}
+		return nil
+	})
+	return bonuses, err
+}
+
+func (u *UserReferralRepository) DeleteUnpaidRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, r := range data.userReferrals {
+			if r.RefereeID == refereeID && !r.PaidOut && r.DeletedAt == nil {
+				t := deletedAt
+				r.DeletedAt = &t
+			}
+		}
+
+		for _, b := range data.transactionBonuses {
+			if b.RefereeID == refereeID && !b.PaidOut && b.DeletedAt == nil {
+				t := deletedAt
+				b.DeletedAt = &t
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) RestoreRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, r := range data.userReferrals {
+			if r.RefereeID == refereeID && r.DeletedAt != nil && r.DeletedAt.Equal(deletedAt) {
+				r.DeletedAt = nil
+			}
+		}
+
+		for _, b := range data.transactionBonuses {
+			if b.RefereeID == refereeID && b.DeletedAt != nil && b.DeletedAt.Equal(deletedAt) {
+				b.DeletedAt = nil
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) ReleaseHeldReferral(ctx context.Context, refereeID string) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, r := range data.userReferrals {
+			if r.RefereeID == refereeID && r.Held && r.DeletedAt == nil {
+				r.Held = false
+				r.UpdatedAt = time.Now()
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserReferralRepository) GetReferralTree(ctx context.Context, userID string, depth int) ([]*app.ReferralNode, error) {
+	nodes := []*app.ReferralNode{}
+	err := u.store.run(ctx, func(data *state) error {
+		users := map[string]*app.User{}
+		for _, user := range data.users {
+			if user.DeletedAt == nil {
+				users[user.ID] = user
+			}
+		}
+
+		level := []string{userID}
+		for d := 1; d <= depth && len(level) > 0; d++ {
+			var next []string
+			for _, referrerID := range level {
+				for _, r := range data.userReferrals {
+					referee, ok := users[r.RefereeID]
+					if r.ReferrerID != referrerID || r.DeletedAt != nil || !ok {
+						continue
+					}
+
+					nodes = append(nodes, &app.ReferralNode{
+						UserID:     referee.ID,
+						Name:       referee.Name,
+						ReferrerID: referrerID,
+						Depth:      d,
+						Status:     app.ReferralStatusOf(r),
+						Active:     referee.DeactivatedAt == nil,
+						ReferredAt: r.CreatedAt,
+					})
+					next = append(next, referee.ID)
+				}
+			}
+			level = next
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].ReferredAt.Before(nodes[j].ReferredAt)
+	})
+	return nodes, nil
+}
+
+func (u *UserReferralRepository) GetReferralUpline(ctx context.Context, userID string, depth int) ([]*app.User, error) {
+	upline := []*app.User{}
+	err := u.store.run(ctx, func(data *state) error {
+		current := userID
+		for len(upline) < depth {
+			var referrerID string
+			for _, r := range data.userReferrals {
+				if r.RefereeID == current && !r.Held && r.DeletedAt == nil {
+					referrerID = r.ReferrerID
+					break
+				}
+			}
+
+			if referrerID == "" {
+				return nil
+			}
+
+			for _, user := range data.users {
+				if user.ID == referrerID {
+					c := *user
+					upline = append(upline, &c)
+					break
+				}
+			}
+			current = referrerID
+		}
+		return nil
+	})
+	return upline, err
+}
+
+// referralHeld reports whether the referral of refereeID is held
+func (s *state) referralHeld(refereeID string) bool {
+	for _, r := range s.userReferrals {
+		if r.RefereeID == refereeID && r.Held && r.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
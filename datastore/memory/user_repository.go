@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+func (u *UserRepository) CreateUser(ctx context.Context, user *app.User) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, existing := range data.users {
+			if existing.Email == user.Email {
+				return errors.ErrEmailTaken
+			}
+			if existing.ReferralCode == user.ReferralCode {
+				return errors.ErrDuplicateReferralCode
+			}
+		}
+
+		user.ID = newID()
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = user.CreatedAt
+
+		c := *user
+		data.users = append(data.users, &c)
+		return nil
+	})
+}
+
+func (u *UserRepository) FindUserByID(ctx context.Context, id string) (*app.User, error) {
+	var user *app.User
+	err := u.store.run(ctx, func(data *state) error {
+		var err error
+		user, err = data.findUser(func(user *app.User) bool { return user.ID == id })
+		return err
+	})
+	return user, err
+}
+
+func (u *UserRepository) FindUserByReferralCode(ctx context.Context, code string) (*app.User, error) {
+	var user *app.User
+	err := u.store.run(ctx, func(data *state) error {
+		var err error
+		user, err = data.findUser(func(user *app.User) bool { return user.ReferralCode == code })
+		return err
+	})
+	return user, err
+}
+
+func (u *UserRepository) FindUserByEmail(ctx context.Context, email string) (*app.User, error) {
+	var user *app.User
+	err := u.store.run(ctx, func(data *state) error {
+		var err error
+		user, err = data.findUser(func(user *app.User) bool { return user.Email == email })
+		return err
+	})
+	return user, err
+}
+
+func (u *UserRepository) FindUserByIDWithDeleted(ctx context.Context, id string) (*app.User, error) {
+	var user *app.User
+	err := u.store.run(ctx, func(data *state) error {
+		for _, existing := range data.users {
+			if existing.ID == id {
+				c := *existing
+				user = &c
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return user, err
+}
+
+func (u *UserRepository) UpdateUserLifecycle(ctx context.Context, user *app.User) error {
+	return u.store.run(ctx, func(data *state) error {
+		for _, existing := range data.users {
+			if existing.ID == user.ID {
+				user.UpdatedAt = time.Now()
+				existing.DeactivatedAt, existing.DeletedAt, existing.UpdatedAt = user.DeactivatedAt, user.DeletedAt, user.UpdatedAt
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
+
+// findUser returns a copy of the first user that isn't deleted and matches fn
+func (s *state) findUser(fn func(user *app.User) bool) (*app.User, error) {
+	for _, user := range s.users {
+		if user.DeletedAt == nil && fn(user) {
+			c := *user
+			return &c, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
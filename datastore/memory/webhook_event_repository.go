@@ -0,0 +1,35 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+type WebhookEventRepository struct {
+	store *Store
+}
+
+func NewWebhookEventRepository(store *Store) *WebhookEventRepository {
+	return &WebhookEventRepository{store: store}
+}
+
+func (w *WebhookEventRepository) CreateWebhookEvent(ctx context.Context, event *app.WebhookEvent) error {
+	return w.store.run(ctx, func(data *state) error {
+		for _, e := range data.webhookEvents {
+			if e.Provider == event.Provider && e.EventID == event.EventID {
+				return errors.ErrDuplicate
+			}
+		}
+
+		event.ID = newID()
+		event.CreatedAt = time.Now()
+
+		c := *event
+		c.Payload = append([]byte(nil), event.Payload...)
+		data.webhookEvents = append(data.webhookEvents, &c)
+		return nil
+	})
+}
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type WebhookSubscriptionRepository struct {
+	store *Store
+}
+
+func NewWebhookSubscriptionRepository(store *Store) *WebhookSubscriptionRepository {
+	return &WebhookSubscriptionRepository{store: store}
+}
+
+func (w *WebhookSubscriptionRepository) CreateWebhookSubscription(ctx context.Context, subscription *app.WebhookSubscription) error {
+	return w.store.run(ctx, func(data *state) error {
+		subscription.ID = newID()
+		subscription.CreatedAt = time.Now()
+
+		data.webhookSubscriptions = append(data.webhookSubscriptions, cloneWebhookSubscription(subscription))
+		return nil
+	})
+}
+
+func (w *WebhookSubscriptionRepository) FindWebhookSubscriptionByID(ctx context.Context, id string) (*app.WebhookSubscription, error) {
+	var found *app.WebhookSubscription
+	err := w.store.run(ctx, func(data *state) error {
+		for _, s := range data.webhookSubscriptions {
+			if s.ID == id && s.DeletedAt == nil {
+				found = cloneWebhookSubscription(s)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+func (w *WebhookSubscriptionRepository) ListUserWebhookSubscriptions(ctx context.Context, userID string) ([]*app.WebhookSubscription, error) {
+	return w.ListWebhookSubscriptionsForUsers(ctx, []string{userID})
+}
+
+func (w *WebhookSubscriptionRepository) ListWebhookSubscriptionsForUsers(ctx context.Context, userIDs []string) ([]*app.WebhookSubscription, error) {
+	subscriptions := []*app.WebhookSubscription{}
+	err := w.store.run(ctx, func(data *state) error {
+		for _, s := range data.webhookSubscriptions {
+			if s.DeletedAt == nil && containsString(userIDs, s.UserID) {
+				subscriptions = append(subscriptions, cloneWebhookSubscription(s))
+			}
+		}
+		return nil
+	})
+	return subscriptions, err
+}
+
+func (w *WebhookSubscriptionRepository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	return w.store.run(ctx, func(data *state) error {
+		for _, s := range data.webhookSubscriptions {
+			if s.ID == id && s.DeletedAt == nil {
+				now := time.Now()
+				s.DeletedAt = &now
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
+
+func cloneWebhookSubscription(s *app.WebhookSubscription) *app.WebhookSubscription {
+	c := *s
+	c.Events = append([]string(nil), s.Events...)
+	return &c
+}
+
+type WebhookDeliveryRepository struct {
+	store *Store
+}
+
+func NewWebhookDeliveryRepository(store *Store) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{store: store}
+}
+
+func (w *WebhookDeliveryRepository) CreateWebhookDelivery(ctx context.Context, delivery *app.WebhookDelivery) error {
+	return w.store.run(ctx, func(data *state) error {
+		for _, d := range data.webhookDeliveries {
+			if d.SubscriptionID == delivery.SubscriptionID && d.EventID == delivery.EventID {
+				return errors.ErrDuplicate
+			}
+		}
+
+		delivery.ID = newID()
+		delivery.CreatedAt = time.Now()
+		delivery.UpdatedAt = delivery.CreatedAt
+		delivery.NextAttemptAt = delivery.CreatedAt
+
+		data.webhookDeliveries = append(data.webhookDeliveries, cloneWebhookDelivery(delivery))
+		return nil
+	})
+}
+
+func (w *WebhookDeliveryRepository) FindWebhookDeliveryByID(ctx context.Context, id string) (*app.WebhookDelivery, error) {
+	var found *app.WebhookDelivery
+	err := w.store.run(ctx, func(data *state) error {
+		for _, d := range data.webhookDeliveries {
+			if d.ID == id {
+				found = cloneWebhookDelivery(d)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+// ClaimWebhookDeliveries doesn't lock anything, transactions on a Store are already serialized
+func (w *WebhookDeliveryRepository) ClaimWebhookDeliveries(ctx context.Context, limit int) ([]*app.WebhookDelivery, error) {
+	deliveries := []*app.WebhookDelivery{}
+	err := w.store.run(ctx, func(data *state) error {
+		active := map[string]bool{}
+		for _, s := range data.webhookSubscriptions {
+			active[s.ID] = s.DeletedAt == nil
+		}
+
+		now := time.Now()
+		for _, d := range data.webhookDeliveries {
+			if d.Status == app.WebhookDeliveryPending && !d.NextAttemptAt.After(now) && active[d.SubscriptionID] {
+				deliveries = append(deliveries, cloneWebhookDelivery(d))
+			}
+		}
+		return nil
+	})
+
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt) })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+func (w *WebhookDeliveryRepository) UpdateWebhookDelivery(ctx context.Context, delivery *app.WebhookDelivery) error {
+	return w.store.run(ctx, func(data *state) error {
+		for i, d := range data.webhookDeliveries {
+			if d.ID == delivery.ID {
+				delivery.UpdatedAt = time.Now()
+				data.webhookDeliveries[i] = cloneWebhookDelivery(delivery)
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
+
+func (w *WebhookDeliveryRepository) ListSubscriptionWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*app.WebhookDelivery, error) {
+	deliveries := []*app.WebhookDelivery{}
+	err := w.store.run(ctx, func(data *state) error {
+		// deliveries are appended in creation order, walk them backwards for the newest first
+		for i := len(data.webhookDeliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+			if d := data.webhookDeliveries[i]; d.SubscriptionID == subscriptionID {
+				deliveries = append(deliveries, cloneWebhookDelivery(d))
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func cloneWebhookDelivery(d *app.WebhookDelivery) *app.WebhookDelivery {
+	c := *d
+	c.Payload = append([]byte(nil), d.Payload...)
+	return &c
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type BankRecipientRepository struct {
+	store *Store
+}
+
+func NewBankRecipientRepository(store *Store) *BankRecipientRepository {
+	return &BankRecipientRepository{store: store}
+}
+
+func (b *BankRecipientRepository) CreateBankRecipient(ctx context.Context, recipient *app.BankRecipient) error {
+	return b.store.run(ctx, func(data *state) error {
+		for _, r := range data.bankRecipients {
+			if r.UserID == recipient.UserID && r.RecipientCode == recipient.RecipientCode {
+				return errors.ErrDuplicate
+			}
+		}
+
+		recipient.ID = newID()
+		recipient.CreatedAt = time.Now()
+		recipient.UpdatedAt = recipient.CreatedAt
+
+		c := *recipient
+		data.bankRecipients = append(data.bankRecipients, &c)
+		return nil
+	})
+}
+
+func (b *BankRecipientRepository) FindBankRecipientByID(ctx context.Context, id string) (*app.BankRecipient, error) {
+	var found *app.BankRecipient
+	err := b.store.run(ctx, func(data *state) error {
+		for _, r := range data.bankRecipients {
+			if r.ID == id && r.DeletedAt == nil {
+				c := *r
+				found = &c
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+func (b *BankRecipientRepository) ListUserBankRecipients(ctx context.Context, userID string) ([]*app.BankRecipient, error) {
+	recipients := []*app.BankRecipient{}
+	err := b.store.run(ctx, func(data *state) error {
+		for _, r := range data.bankRecipients {
+			if r.UserID == userID && r.DeletedAt == nil {
+				c := *r
+				recipients = append(recipients, &c)
+			}
+		}
+		return nil
+	})
+	return recipients, err
+}
+
+type WithdrawalRepository struct {
+	store *Store
+}
+
+func NewWithdrawalRepository(store *Store) *WithdrawalRepository {
+	return &WithdrawalRepository{store: store}
+}
+
+func (w *WithdrawalRepository) CreateWithdrawal(ctx context.Context, withdrawal *app.Withdrawal) error {
+	return w.store.run(ctx, func(data *state) error {
+		for _, v := range data.withdrawals {
+			if v.Reference == withdrawal.Reference {
+				return errors.ErrDuplicate
+			}
+		}
+
+		withdrawal.ID = newID()
+		withdrawal.CreatedAt = time.Now()
+		withdrawal.UpdatedAt = withdrawal.CreatedAt
+
+		c := *withdrawal
+		data.withdrawals = append(data.withdrawals, &c)
+		return nil
+	})
+}
+
+func (w *WithdrawalRepository) FindWithdrawalByReference(ctx context.Context, reference string) (*app.Withdrawal, error) {
+	var found *app.Withdrawal
+	err := w.store.run(ctx, func(data *state) error {
+		for _, v := range data.withdrawals {
+			if v.Reference == reference {
+				c := *v
+				found = &c
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+	return found, err
+}
+
+// LockWithdrawalByReference is FindWithdrawalByReference, transactions on a Store are already serialized
+func (w *WithdrawalRepository) LockWithdrawalByReference(ctx context.Context, reference string) (*app.Withdrawal, error) {
+	return w.FindWithdrawalByReference(ctx, reference)
+}
+
+func (w *WithdrawalRepository) UpdateWithdrawal(ctx context.Context, withdrawal *app.Withdrawal) error {
+	return w.store.run(ctx, func(data *state) error {
+		for _, v := range data.withdrawals {
+			if v.ID == withdrawal.ID {
+				v.Status = withdrawal.Status
+				v.TransferCode = withdrawal.TransferCode
+				v.FailureReason = withdrawal.FailureReason
+				v.CompletedAt = withdrawal.CompletedAt
+				v.UpdatedAt = time.Now()
+				withdrawal.UpdatedAt = v.UpdatedAt
+				return nil
+			}
+		}
+		return pgx.ErrNoRows
+	})
+}
+
+func (w *WithdrawalRepository) GetUserWithdrawnPointsSince(ctx context.Context, userID string, since time.Time) (int64, error) {
+	var total int64
+	err := w.store.run(ctx, func(data *state) error {
+		for _, v := range data.withdrawals {
+			if v.UserID == userID && !v.CreatedAt.Before(since) && v.Status != app.WithdrawalFailed {
+				total += v.Points
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+type IdempotencyRepository struct {
+	client *Client
+}
+
+func NewIdempotencyRepository(client *Client) *IdempotencyRepository {
+	return &IdempotencyRepository{client: client}
+}
+
+func (i *IdempotencyRepository) CreateIdempotencyKey(ctx context.Context, key *app.IdempotencyKey) error {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO idempotency_keys (scope, key, request_hash) VALUES ($1,$2,$3) RETURNING id, created_at, updated_at",
+		key.Scope, key.Key, key.RequestHash)
+
+	return row.Scan(&key.ID, &key.CreatedAt, &key.UpdatedAt)
+}
+
+func (i *IdempotencyRepository) FindIdempotencyKey(ctx context.Context, scope string, key string) (*app.IdempotencyKey, error) {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT id, scope, key, request_hash, response_status, response_body, created_at, updated_at FROM idempotency_keys WHERE scope = $1 AND key = $2", scope, key)
+
+	k := &app.IdempotencyKey{}
+	err = row.Scan(&k.ID, &k.Scope, &k.Key, &k.RequestHash, &k.ResponseStatus, &k.ResponseBody, &k.CreatedAt, &k.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (i *IdempotencyRepository) SaveIdempotencyKeyResponse(ctx context.Context, scope string, key string, status int, body []byte) error {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE idempotency_keys SET response_status = $1, response_body = $2, updated_at = now() WHERE scope = $3 AND key = $4",
+		status, body, scope, key)
+	return err
+}
+
+func (i *IdempotencyRepository) DeleteIdempotencyKey(ctx context.Context, scope string, key string) error {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2", scope, key)
+	return err
+}
+
+func (i *IdempotencyRepository) TakeOverIdempotencyKey(ctx context.Context, scope string, key string, staleBefore time.Time) (bool, error) {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := tx.Exec(ctx, "UPDATE idempotency_keys SET updated_at = now() WHERE scope = $1 AND key = $2 AND response_status = 0 AND updated_at < $3",
+		scope, key, staleBefore)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (i *IdempotencyRepository) PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := i.client.GetTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM idempotency_keys WHERE updated_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+type LeaderboardRepository struct {
+	client *Client
+}
+
+func NewLeaderboardRepository(client *Client) *LeaderboardRepository {
+	return &LeaderboardRepository{client: client}
+}
+
+// RefreshLeaderboard refreshes the referral_leaderboard view concurrently, so it can still be read while it's recomputed
+func (l *LeaderboardRepository) RefreshLeaderboard(ctx context.Context) error {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "REFRESH MATERIALIZED VIEW CONCURRENTLY referral_leaderboard")
+	return err
+}
+
+func (l *LeaderboardRepository) GetLeaderboard(ctx context.Context, period app.LeaderboardPeriod, metric app.LeaderboardMetric, offset int, limit int) (*app.Leaderboard, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ranks are precomputed, so pages are found through the rank indexes rather than by skipping rows.
+	// Users without any of the metric have no rank, so they're left out without leaving gaps in the pages.
+	rank := "referrals_rank"
+	if metric == app.LeaderboardByPoints {
+		rank = "points_rank"
+	}
+
+	board := &app.Leaderboard{Period: period, Metric: metric, Entries: []*app.LeaderboardEntry{}}
+	row := tx.QueryRow(ctx, "SELECT MAX(refreshed_at) FROM referral_leaderboard")
+	if err = row.Scan(&board.RefreshedAt); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+rank+`, user_id, name, referrals, qualified_referrals, points FROM referral_leaderboard
+WHERE period = $1 AND `+rank+` > $2 ORDER BY `+rank+` LIMIT $3`, string(period), offset, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &app.LeaderboardEntry{}
+		if err = rows.Scan(&e.Rank, &e.UserID, &e.Name, &e.Referrals, &e.QualifiedReferrals, &e.Points); err != nil {
+			return nil, err
+		}
+		board.Entries = append(board.Entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(board.Entries) > limit {
+		board.Entries = board.Entries[:limit]
+		next := offset + limit
+		board.NextOffset = &next
+	}
+	return board, nil
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type LedgerRepository struct {
+	client *Client
+}
+
+func NewLedgerRepository(client *Client) *LedgerRepository {
+	return &LedgerRepository{client: client}
+}
+
+func (l *LedgerRepository) CreateAccount(ctx context.Context, account *app.Account) error {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO accounts (code, kind, user_id) VALUES ($1,$2,$3) RETURNING id, created_at, updated_at",
+		account.Code, account.Kind, account.UserID)
+
+	return row.Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt)
+}
+
+func (l *LedgerRepository) FindAccountByCode(ctx context.Context, code string) (*app.Account, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT id, code, kind, user_id, created_at, updated_at, deleted_at FROM accounts WHERE code = $1 AND deleted_at IS NULL", code)
+	return scanAccount(row)
+}
+
+func (l *LedgerRepository) FindAccountByUserID(ctx context.Context, userID string) (*app.Account, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT id, code, kind, user_id, created_at, updated_at, deleted_at FROM accounts WHERE user_id = $1 AND deleted_at IS NULL", userID)
+	return scanAccount(row)
+}
+
+// PostJournalEntry saves entry and its postings, then applies each posting to the
+// balance cached in user_points. Everything happens in one transaction so the cached
+// balance can never disagree with the ledger.
+func (l *LedgerRepository) PostJournalEntry(ctx context.Context, entry *app.JournalEntry) error {
+	if !entry.IsBalanced() {
+		return errors.ErrUnbalancedJournalEntry
+	}
+
+	return l.client.inTx(ctx, func(ctx context.Context, tx Tx) error {
+		row := tx.QueryRow(ctx, "INSERT INTO journal_entries (kind, reference, description) VALUES ($1,$2,$3) RETURNING id, created_at",
+			entry.Kind, entry.Reference, entry.Description)
+		if err := row.Scan(&entry.ID, &entry.CreatedAt); err != nil {
+			return errors.Wrap(err, "failed to save journal entry")
+		}
+
+		for _, p := range entry.Postings {
+			p.JournalEntryID = entry.ID
+
+			row = tx.QueryRow(ctx, "INSERT INTO postings (journal_entry_id, account_id, amount) VALUES ($1,$2,$3) RETURNING id, created_at",
+				p.JournalEntryID, p.AccountID, p.Amount)
+			if err := row.Scan(&p.ID, &p.CreatedAt); err != nil {
+				return errors.Wrap(err, "failed to save posting")
+			}
+
+			// system accounts have no user_points row, so this is a no-op for them. The debit is
+			// conditional so a user balance can't go below zero even if a caller checked a stale balance.
+			tag, err := tx.Exec(ctx, "UPDATE user_points SET points = points + $1, updated_at = now() WHERE user_id = (SELECT user_id FROM accounts WHERE id = $2) AND deleted_at IS NULL AND points + $1 >= 0",
+				p.Amount, p.AccountID)
+			if err != nil {
+				return errors.Wrap(err, "failed to apply posting to user points")
+			}
+
+			if tag.RowsAffected() == 0 && p.Amount < 0 {
+				var isUserAccount bool
+				row = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM user_points WHERE user_id = (SELECT user_id FROM accounts WHERE id = $1) AND deleted_at IS NULL)", p.AccountID)
+				if err = row.Scan(&isUserAccount); err != nil {
+					return errors.Wrap(err, "failed to find posting account")
+				}
+
+				if isUserAccount {
+					return errors.ErrInsufficientFunds
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetAccountBalance computes the balance of an account from its postings
+func (l *LedgerRepository) GetAccountBalance(ctx context.Context, accountID string) (int64, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var balance int64
+	row := tx.QueryRow(ctx, "SELECT COALESCE(SUM(amount), 0) FROM postings WHERE account_id = $1", accountID)
+	if err = row.Scan(&balance); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+// ListBalanceDiscrepancies compares user_points with the postings of each user in one statement,
+// so the balances it reads are consistent with each other
+func (l *LedgerRepository) ListBalanceDiscrepancies(ctx context.Context) ([]*app.BalanceDiscrepancy, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT up.user_id, up.points, COALESCE(SUM(p.amount), 0)
+FROM user_points up
+LEFT JOIN accounts a ON a.user_id = up.user_id
+LEFT JOIN postings p ON p.account_id = a.id
+WHERE up.deleted_at IS NULL
+GROUP BY up.user_id, up.points
+HAVING up.points <> COALESCE(SUM(p.amount), 0)
+ORDER BY up.user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	discrepancies := []*app.BalanceDiscrepancy{}
+	for rows.Next() {
+		d := &app.BalanceDiscrepancy{}
+		if err = rows.Scan(&d.UserID, &d.CachedBalance, &d.LedgerBalance); err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies, rows.Err()
+}
+
+func (l *LedgerRepository) ResyncUserBalance(ctx context.Context, userID string) (*app.BalanceDiscrepancy, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// postings are made while holding this lock, so none can land between the two reads
+	d := &app.BalanceDiscrepancy{UserID: userID}
+	row := tx.QueryRow(ctx, "SELECT points FROM user_points WHERE user_id = $1 AND deleted_at IS NULL FOR UPDATE", userID)
+	if err = row.Scan(&d.CachedBalance); err != nil {
+		return nil, err
+	}
+
+	row = tx.QueryRow(ctx, "SELECT COALESCE(SUM(p.amount), 0) FROM postings p JOIN accounts a ON a.id = p.account_id WHERE a.user_id = $1", userID)
+	if err = row.Scan(&d.LedgerBalance); err != nil {
+		return nil, err
+	}
+
+	if d.Difference() == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE user_points SET points = $1, updated_at = now() WHERE user_id = $2 AND deleted_at IS NULL", d.LedgerBalance, userID)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (l *LedgerRepository) ListUserPostings(ctx context.Context, kind app.JournalEntryKind, userID string) ([]*app.UserPosting, error) {
+	tx, err := l.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT e.id, e.reference, a.user_id, p.amount
+FROM journal_entries e
+JOIN postings p ON p.journal_entry_id = e.id
+JOIN accounts a ON a.id = p.account_id
+WHERE e.kind = $1 AND a.user_id IS NOT NULL AND ($2 = '' OR a.user_id::text = $2)
+ORDER BY e.created_at, e.id, p.id`, kind, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postings := []*app.UserPosting{}
+	for rows.Next() {
+		p := &app.UserPosting{}
+		if err = rows.Scan(&p.JournalEntryID, &p.Reference, &p.UserID, &p.Amount); err != nil {
+			return nil, err
+		}
+		postings = append(postings, p)
+	}
+	return postings, rows.Err()
+}
+
+func scanAccount(row pgx.Row) (*app.Account, error) {
+	account := &app.Account{}
+	err := row.Scan(&account.ID, &account.Code, &account.Kind, &account.UserID, &account.CreatedAt, &account.UpdatedAt, &account.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterMetrics exports the stats of c's connection pool on registry
+func (c *Client) RegisterMetrics(registry prometheus.Registerer) {
+	gauge := func(name, help string, fn func() float64) {
+		registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+	}
+	counter := func(name, help string, fn func() float64) {
+		registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, fn))
+	}
+
+	gauge("pgxpool_total_conns", "Connections open in the pool.", func() float64 {
+		return float64(c.pool.Stat().TotalConns())
+	})
+	gauge("pgxpool_acquired_conns", "Connections currently in use.", func() float64 {
+		return float64(c.pool.Stat().AcquiredConns())
+	})
+	gauge("pgxpool_idle_conns", "Connections waiting to be used.", func() float64 {
+		return float64(c.pool.Stat().IdleConns())
+	})
+	gauge("pgxpool_constructing_conns", "Connections being opened.", func() float64 {
+		return float64(c.pool.Stat().ConstructingConns())
+	})
+	gauge("pgxpool_max_conns", "The most connections the pool opens.", func() float64 {
+		return float64(c.pool.Stat().MaxConns())
+	})
+	counter("pgxpool_acquires_total", "Connections acquired from the pool.", func() float64 {
+		return float64(c.pool.Stat().AcquireCount())
+	})
+	counter("pgxpool_empty_acquires_total", "Acquires that waited for a connection because none was idle.", func() float64 {
+		return float64(c.pool.Stat().EmptyAcquireCount())
+	})
+	counter("pgxpool_canceled_acquires_total", "Acquires canceled before they got a connection.", func() float64 {
+		return float64(c.pool.Stat().CanceledAcquireCount())
+	})
+	counter("pgxpool_acquire_duration_seconds_total", "Time spent acquiring connections.", func() float64 {
+		return c.pool.Stat().AcquireDuration().Seconds()
+	})
+}
@@ -0,0 +1,276 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres/migrations"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+)
+
+// migrationLockID is the key of the advisory lock held while migrating, so two
+// instances starting at the same time don't apply the same migration twice
+const migrationLockID = 7315521
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the migrations in fsys sorted by version, every migration needs both an up and a down file
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".sql")
+
+		direction := name[strings.LastIndex(name, ".")+1:]
+		if direction != "up" && direction != "down" {
+			return nil, fmt.Errorf("migration %s: name must end with .up.sql or .down.sql", file)
+		}
+		name = strings.TrimSuffix(name, "."+direction)
+
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s: name must start with <version>_", file)
+		}
+
+		buf, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if direction == "up" {
+			m.Up = string(buf)
+		} else {
+			m.Down = string(buf)
+		}
+	}
+
+	all := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: both up and down files are required", m.Version, m.Name)
+		}
+		all = append(all, m)
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// Migrator applies the embedded migrations, applied versions are recorded in schema_migrations
+type Migrator struct {
+	client     *Client
+	migrations []*Migration
+}
+
+func NewMigrator(client *Client) (*Migrator, error) {
+	all, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load migrations")
+	}
+	return &Migrator{client: client, migrations: all}, nil
+}
+
+// LatestVersion is the version the schema is at once every migration is applied
+func (m *Migrator) LatestVersion() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration in order, each in its own transaction
+func (m *Migrator) Up(ctx context.Context) ([]*Migration, error) {
+	var applied []*Migration
+
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			err = runMigration(ctx, conn, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return errors.Wrapf(err, "failed to apply migration %d_%s", migration.Version, migration.Name)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, or all of them when steps is zero
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	var reverted []*Migration
+
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+
+			err = runMigration(ctx, conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return errors.Wrapf(err, "failed to revert migration %d_%s", migration.Version, migration.Name)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration along with when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	var statuses []*MigrationStatus
+
+	err := m.withConn(ctx, func(conn *pgx.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := &MigrationStatus{Migration: migration}
+			if at, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Version returns the highest applied migration version, zero if none has been applied
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version int64
+
+	err := m.withConn(ctx, func(conn *pgx.Conn) error {
+		if err := createMigrationsTable(ctx, conn); err != nil {
+			return err
+		}
+		return conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	})
+	return version, err
+}
+
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := m.client.pool.Acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire connection")
+	}
+	defer conn.Release()
+
+	return fn(conn.Conn())
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	return m.withConn(ctx, func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return errors.Wrap(err, "failed to acquire migration lock")
+		}
+		defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+		if err := createMigrationsTable(ctx, conn); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func createMigrationsTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint PRIMARY KEY,
+    name text NOT NULL,
+    applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create schema_migrations table")
+	}
+	return nil
+}
+
+// appliedVersions returns when each applied migration was applied, keyed by version
+func appliedVersions(ctx context.Context, conn *pgx.Conn) (map[int64]time.Time, error) {
+	if err := createMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+	return versions, rows.Err()
+}
+
+// runMigration executes sql and the bookkeeping query in one transaction
+func runMigration(ctx context.Context, conn *pgx.Conn, sql string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS accounts (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    code text NOT NULL UNIQUE ,
+    kind text NOT NULL ,
+    user_id uuid REFERENCES users(id) UNIQUE ,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind text NOT NULL ,
+    reference text NOT NULL DEFAULT '',
+    description text NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    journal_entry_id uuid REFERENCES journal_entries(id) NOT NULL ,
+    account_id uuid REFERENCES accounts(id) NOT NULL ,
+    amount bigint NOT NULL CHECK (amount <> 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+CREATE INDEX IF NOT EXISTS postings_journal_entry_id_idx ON postings (journal_entry_id);
+
+INSERT INTO accounts (code, kind) VALUES
+    ('referral_bonus_expense', 'system'),
+    ('opening_balance_equity', 'system')
+ON CONFLICT (code) DO NOTHING;
+
+-- give every existing user an account and carry their current balance over as an opening balance
+INSERT INTO accounts (code, kind, user_id)
+SELECT 'user:' || id, 'user', id FROM users
+ON CONFLICT (code) DO NOTHING;
+
+WITH balances AS (
+    SELECT up.id AS user_point_id, a.id AS account_id, up.points
+    FROM user_points up JOIN accounts a ON a.user_id = up.user_id
+    WHERE up.points <> 0 AND up.deleted_at IS NULL
+), entries AS (
+    INSERT INTO journal_entries (kind, reference, description)
+    SELECT 'opening_balance', user_point_id::text, 'opening balance' FROM balances
+    RETURNING id, reference
+)
+INSERT INTO postings (journal_entry_id, account_id, amount)
+SELECT e.id, b.account_id, b.points FROM entries e JOIN balances b ON b.user_point_id::text = e.reference
+UNION ALL
+SELECT e.id, (SELECT id FROM accounts WHERE code = 'opening_balance_equity'), -b.points FROM entries e JOIN balances b ON b.user_point_id::text = e.reference;
@@ -0,0 +1,3 @@
+ALTER TABLE user_points DROP CONSTRAINT IF EXISTS user_points_user_id_key;
+
+ALTER TABLE user_referrals DROP CONSTRAINT IF EXISTS user_referrals_referee_id_key;
@@ -0,0 +1,4 @@
+-- a user can only be referred once and only has one points balance
+ALTER TABLE user_referrals ADD CONSTRAINT user_referrals_referee_id_key UNIQUE (referee_id);
+
+ALTER TABLE user_points ADD CONSTRAINT user_points_user_id_key UNIQUE (user_id);
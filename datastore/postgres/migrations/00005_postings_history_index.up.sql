@@ -0,0 +1,2 @@
+-- serves keyset pagination of a user's transaction history
+CREATE INDEX IF NOT EXISTS postings_account_id_created_at_id_idx ON postings (account_id, created_at DESC, id DESC);
@@ -0,0 +1,2 @@
+-- users created before passwords existed can't log in until one is set
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash text NOT NULL DEFAULT '';
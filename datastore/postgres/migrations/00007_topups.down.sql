@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS topups;
+
+-- the account stays if points were ever sold, postings reference it
+DELETE FROM accounts a WHERE a.code = 'point_sales'
+    AND NOT EXISTS (SELECT 1 FROM postings p WHERE p.account_id = a.id);
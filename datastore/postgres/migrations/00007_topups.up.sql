@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS topups (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid REFERENCES users(id) NOT NULL ,
+    reference text NOT NULL UNIQUE ,
+    points bigint NOT NULL CHECK (points > 0) ,
+    amount bigint NOT NULL CHECK (amount > 0) ,
+    status text NOT NULL DEFAULT 'pending' ,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS topups_user_id_idx ON topups (user_id);
+
+INSERT INTO accounts (code, kind) VALUES ('point_sales', 'system')
+ON CONFLICT (code) DO NOTHING;
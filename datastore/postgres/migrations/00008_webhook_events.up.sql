@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider text NOT NULL ,
+    event_id text NOT NULL ,
+    event text NOT NULL ,
+    payload jsonb NOT NULL ,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, event_id)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS withdrawals;
+DROP TABLE IF EXISTS bank_recipients;
+
+-- the accounts stay if points were ever withdrawn, postings reference them
+DELETE FROM accounts a WHERE a.code IN ('withdrawal_holds', 'withdrawals_paid')
+    AND NOT EXISTS (SELECT 1 FROM postings p WHERE p.account_id = a.id);
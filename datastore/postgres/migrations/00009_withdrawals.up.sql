@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS bank_recipients (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid REFERENCES users(id) NOT NULL ,
+    recipient_code text NOT NULL ,
+    account_number text NOT NULL ,
+    account_name text NOT NULL ,
+    bank_code text NOT NULL ,
+    bank_name text NOT NULL ,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, recipient_code)
+);
+
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid REFERENCES users(id) NOT NULL ,
+    bank_recipient_id uuid REFERENCES bank_recipients(id) NOT NULL ,
+    reference text NOT NULL UNIQUE ,
+    points bigint NOT NULL CHECK (points > 0) ,
+    amount bigint NOT NULL CHECK (amount > 0) ,
+    status text NOT NULL DEFAULT 'pending' ,
+    transfer_code text NOT NULL DEFAULT '' ,
+    failure_reason text NOT NULL DEFAULT '' ,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS withdrawals_user_id_created_at_idx ON withdrawals (user_id, created_at);
+
+INSERT INTO accounts (code, kind) VALUES
+    ('withdrawal_holds', 'system'),
+    ('withdrawals_paid', 'system')
+ON CONFLICT (code) DO NOTHING;
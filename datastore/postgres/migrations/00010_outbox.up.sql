@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    type text NOT NULL ,
+    aggregate_id text NOT NULL ,
+    payload jsonb NOT NULL ,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text NOT NULL DEFAULT '' ,
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the dispatcher only looks at unpublished events
+CREATE INDEX IF NOT EXISTS outbox_events_unpublished_idx ON outbox_events (available_at, created_at)
+    WHERE published_at IS NULL;
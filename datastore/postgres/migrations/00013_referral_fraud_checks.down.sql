@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS signup_checks;
+ALTER TABLE user_referrals DROP COLUMN IF EXISTS held;
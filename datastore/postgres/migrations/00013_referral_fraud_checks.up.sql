@@ -0,0 +1,20 @@
+ALTER TABLE user_referrals ADD COLUMN IF NOT EXISTS held BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS signup_checks (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id uuid REFERENCES users(id) NOT NULL UNIQUE ,
+    referrer_id uuid REFERENCES users(id) ,
+    normalized_email text NOT NULL ,
+    ip_address text NOT NULL DEFAULT '' ,
+    device_fingerprint text NOT NULL DEFAULT '' ,
+    decision text NOT NULL ,
+    reasons text[] NOT NULL DEFAULT '{}' ,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS signup_checks_normalized_email_idx ON signup_checks (normalized_email);
+CREATE INDEX IF NOT EXISTS signup_checks_ip_address_idx ON signup_checks (ip_address, created_at) WHERE ip_address <> '';
+CREATE INDEX IF NOT EXISTS signup_checks_device_fingerprint_idx ON signup_checks (device_fingerprint, created_at) WHERE device_fingerprint <> '';
+CREATE INDEX IF NOT EXISTS signup_checks_referrer_id_idx ON signup_checks (referrer_id, created_at);
+CREATE INDEX IF NOT EXISTS signup_checks_decision_idx ON signup_checks (decision, created_at);
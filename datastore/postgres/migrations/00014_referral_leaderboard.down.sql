@@ -0,0 +1 @@
+DROP MATERIALIZED VIEW IF EXISTS referral_leaderboard;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idempotency_keys_updated_at_idx;
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idempotency_keys_updated_at_idx ON idempotency_keys (updated_at);
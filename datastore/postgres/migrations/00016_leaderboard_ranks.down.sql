@@ -0,0 +1,54 @@
+DROP MATERIALIZED VIEW IF EXISTS referral_leaderboard;
+
+-- rankings of every period as of the last refresh, see app.LeaderboardRepository. The entry kinds
+-- are app.ReferralRewardEntries, the view must be recreated when a kind is added.
+CREATE MATERIALIZED VIEW referral_leaderboard AS
+WITH periods (period, starts_at) AS (
+    VALUES ('day', date_trunc('day', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'),
+           ('week', date_trunc('week', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'),
+           ('month', date_trunc('month', now() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'),
+           ('all', '-infinity'::timestamptz)
+),
+referrals AS (
+    SELECT p.period, r.referrer_id AS user_id, COUNT(*) AS referrals, MAX(r.created_at) AS last_referral_at
+    FROM periods p JOIN user_referrals r ON r.created_at >= p.starts_at
+    WHERE r.held = false AND r.deleted_at IS NULL
+    GROUP BY p.period, r.referrer_id
+),
+qualified AS (
+    SELECT p.period, b.referrer_id AS user_id, COUNT(*) AS qualified_referrals
+    FROM periods p JOIN referred_user_transaction_bonuses b ON b.created_at >= p.starts_at
+    WHERE b.deleted_at IS NULL
+    GROUP BY p.period, b.referrer_id
+),
+earnings AS (
+    SELECT p.period, a.user_id, SUM(po.amount) AS points, MAX(e.created_at) AS last_earned_at
+    FROM periods p
+    JOIN journal_entries e ON e.created_at >= p.starts_at
+    JOIN postings po ON po.journal_entry_id = e.id
+    JOIN accounts a ON a.id = po.account_id AND a.user_id IS NOT NULL
+    WHERE e.kind IN ('referral_bonus', 'referred_user_transaction_bonus', 'referral_upline_bonus')
+    GROUP BY p.period, a.user_id
+),
+totals AS (
+    SELECT period, user_id,
+           COALESCE(r.referrals, 0) AS referrals,
+           COALESCE(q.qualified_referrals, 0) AS qualified_referrals,
+           COALESCE(e.points, 0) AS points,
+           r.last_referral_at,
+           e.last_earned_at
+    FROM referrals r
+    FULL JOIN qualified q USING (period, user_id)
+    FULL JOIN earnings e USING (period, user_id)
+)
+SELECT t.period, t.user_id, u.name, t.referrals, t.qualified_referrals, t.points,
+       ROW_NUMBER() OVER (PARTITION BY t.period ORDER BY t.referrals DESC, t.points DESC, t.last_referral_at ASC NULLS LAST, t.user_id) AS referrals_rank,
+       ROW_NUMBER() OVER (PARTITION BY t.period ORDER BY t.points DESC, t.referrals DESC, t.last_earned_at ASC NULLS LAST, t.user_id) AS points_rank,
+       now() AS refreshed_at
+FROM totals t
+JOIN users u ON u.id = t.user_id AND u.deleted_at IS NULL AND u.deactivated_at IS NULL;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY needs a unique index
+CREATE UNIQUE INDEX IF NOT EXISTS referral_leaderboard_period_user_id_idx ON referral_leaderboard (period, user_id);
+CREATE INDEX IF NOT EXISTS referral_leaderboard_referrals_rank_idx ON referral_leaderboard (period, referrals_rank);
+CREATE INDEX IF NOT EXISTS referral_leaderboard_points_rank_idx ON referral_leaderboard (period, points_rank);
@@ -0,0 +1,3 @@
+-- the account stays if an adjustment was ever posted, postings reference it
+DELETE FROM accounts a WHERE a.code = 'reconciliation_adjustments'
+    AND NOT EXISTS (SELECT 1 FROM postings p WHERE p.account_id = a.id);
@@ -0,0 +1,2 @@
+INSERT INTO accounts (code, kind) VALUES ('reconciliation_adjustments', 'system')
+ON CONFLICT (code) DO NOTHING;
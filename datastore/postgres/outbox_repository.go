@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+type OutboxRepository struct {
+	client *Client
+}
+
+func NewOutboxRepository(client *Client) *OutboxRepository {
+	return &OutboxRepository{client: client}
+}
+
+func (o *OutboxRepository) CreateOutboxEvent(ctx context.Context, event *app.OutboxEvent) error {
+	tx, err := o.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO outbox_events (type, aggregate_id, payload) VALUES ($1,$2,$3) RETURNING id, available_at, created_at",
+		event.Type, event.AggregateID, string(event.Payload))
+
+	return row.Scan(&event.ID, &event.AvailableAt, &event.CreatedAt)
+}
+
+// ClaimOutboxEvents locks the events with FOR UPDATE SKIP LOCKED, it must be called in a transaction
+func (o *OutboxRepository) ClaimOutboxEvents(ctx context.Context, limit int) ([]*app.OutboxEvent, error) {
+	tx, err := o.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT id, type, aggregate_id, payload, attempts, last_error, available_at, published_at, created_at
+FROM outbox_events
+WHERE published_at IS NULL AND available_at <= now()
+ORDER BY created_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*app.OutboxEvent{}
+	for rows.Next() {
+		e := &app.OutboxEvent{}
+		var payload string
+		err = rows.Scan(&e.ID, &e.Type, &e.AggregateID, &payload, &e.Attempts, &e.LastError, &e.AvailableAt, &e.PublishedAt, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (o *OutboxRepository) MarkOutboxEventPublished(ctx context.Context, id string) error {
+	tx, err := o.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE outbox_events SET published_at = now() WHERE id = $1", id)
+	return err
+}
+
+func (o *OutboxRepository) MarkOutboxEventFailed(ctx context.Context, id string, reason string, retryAt time.Time) error {
+	tx, err := o.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE outbox_events SET attempts = attempts + 1, last_error = $1, available_at = $2 WHERE id = $3", reason, retryAt, id)
+	return err
+}
+
+func (o *OutboxRepository) GetOutboxBacklog(ctx context.Context) (*app.OutboxBacklog, error) {
+	tx, err := o.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	backlog := &app.OutboxBacklog{}
+	row := tx.QueryRow(ctx, "SELECT count(*), min(created_at) FROM outbox_events WHERE published_at IS NULL")
+	return backlog, row.Scan(&backlog.Pending, &backlog.OldestCreatedAt)
+}
@@ -2,58 +2,187 @@ package postgres
 
 import (
 	"context"
-	"fmt"
 	"github.com/jackc/pgconn"
+	"math/rand"
 	"strings"
 	"time"
 
 	app "github.com/danvixent/aboki-africa-assessment"
 	"github.com/danvixent/aboki-africa-assessment/config"
+	apperrors "github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/logging"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
 	"github.com/jackc/pgx/v4"
 	pool "github.com/jackc/pgx/v4/pgxpool"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client struct {
-	pool *pool.Pool
+	pool         *pool.Pool
+	txOptions    pgx.TxOptions
+	maxRetries   int
+	retryBackoff time.Duration
 }
 
-func (c *Client) BeginTx() (pgx.Tx, error) {
-	tx, err := c.pool.BeginTx(context.Background(), defaultOptions)
+const (
+	// DefaultMaxRetries is how many times a transaction is retried after a serialization failure
+	// when config.PostgresConfig.MaxRetries isn't set
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBackoff is the wait before the first retry when config.PostgresConfig.RetryBackoff
+	// isn't set, it doubles on every retry after that
+	DefaultRetryBackoff = 20 * time.Millisecond
+)
+
+// BeginTx starts a new transaction
+func (c *Client) BeginTx() (app.Tx, error) {
+	return c.begin()
+}
+
+func (c *Client) begin() (*retryableTx, error) {
+	tx, err := c.pool.BeginTx(context.Background(), c.txOptions)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to begin new transaction")
 	}
-	return tx, nil
+	return &retryableTx{Tx: tx}, nil
 }
 
-// GetTx extracts a pgx.Tx from ctx
+// GetTx extracts a pgx.Tx from ctx, the queries run through it are traced
 func (c *Client) GetTx(ctx context.Context) (Tx, error) {
 	tx := ctx.Value(app.TxContextKey)
 	if tx != nil {
-		return tx.(Tx), nil
+		return tracedTx{Tx: tx.(Tx)}, nil
+	}
+	return tracedTx{Tx: c}, nil
+}
+
+// RunInTx runs fn in a new transaction, it satisfies the app.TxRunner expected by handler.NewHandler.
+// When the transaction fails to serialize or deadlocks, it's rolled back and fn is run again in a
+// fresh transaction, up to maxRetries times with an exponential backoff between attempts.
+// When ctx already carries a transaction, fn runs in a savepoint of it instead and isn't retried.
+func (c *Client) RunInTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := tracing.Start(ctx, "postgres.RunInTx", trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	if parent, ok := ctx.Value(app.TxContextKey).(*retryableTx); ok {
+		span.SetAttributes(attribute.Bool("db.savepoint", true))
+		return parent.savepoint(ctx, fn)
+	}
+
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		tx, err := c.begin()
+		if err != nil {
+			return err
+		}
+
+		err = fn(context.WithValue(ctx, app.TxContextKey, tx))
+		if err == nil {
+			err = tx.Commit(ctx)
+		}
+		tx.Rollback(ctx)
+
+		if err == nil {
+			return nil
+		}
+
+		// the error fn returns may be one the caller mapped, so also check what the database reported
+		if !isRetryable(err) && !isRetryable(tx.failure) {
+			return err
+		}
+
+		if attempt >= c.maxRetries {
+			return errors.Wrapf(err, "transaction failed after %d retries", attempt)
+		}
+
+		logging.FromContext(ctx).WithError(err).Warnf("transaction failed to serialize, retrying in %s", backoff)
+		span.AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt+1), attribute.String("error", err.Error())))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)+1))):
+		}
+		backoff *= 2
+	}
+}
+
+// inTx runs fn inside the transaction stored in ctx, if there is none
+// fn is run with RunInTx
+func (c *Client) inTx(ctx context.Context, fn func(ctx context.Context, tx Tx) error) error {
+	if tx, ok := ctx.Value(app.TxContextKey).(Tx); ok {
+		return fn(ctx, tracedTx{Tx: tx})
 	}
-	return c, nil
+
+	return c.RunInTx(ctx, func(ctx context.Context) error {
+		tx, err := c.GetTx(ctx)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, tx)
+	})
 }
 
 // New Returns a new database initialized with credentials from config
 func New(ctx context.Context, config *config.PostgresConfig) *Client {
-	const format = "postgres://%s:%s@%s:%s/%s?sslmode=disable&pool_max_conns=%d"
-	uri := fmt.Sprintf(format, config.Username, config.Password, config.Host, config.Port, config.Database, config.MaxConn)
-
-	cfg, err := pool.ParseConfig(uri)
+	cfg, err := pool.ParseConfig(config.DSN())
 	if err != nil {
 		log.Panicf("failed to parse pgx config: %v", err)
 	}
 
 	cfg.ConnConfig.ConnectTimeout = time.Minute
 
+	txOptions, err := txOptionsFor(config.IsolationLevel)
+	if err != nil {
+		log.Panicf("invalid postgres config: %v", err)
+	}
+
 	pool, err := pool.ConnectConfig(ctx, cfg)
 	if err != nil {
 		log.Panicf("pgx pool failed to connect: %v", err)
 	}
 
-	return &Client{pool: pool}
+	client := &Client{
+		pool:         pool,
+		txOptions:    txOptions,
+		maxRetries:   config.MaxRetries,
+		retryBackoff: config.RetryBackoff,
+	}
+
+	if client.maxRetries == 0 {
+		client.maxRetries = DefaultMaxRetries
+	}
+
+	if client.retryBackoff <= 0 {
+		client.retryBackoff = DefaultRetryBackoff
+	}
+
+	return client
+}
+
+// txOptionsFor returns defaultOptions with the isolation level named by level,
+// which is one of "read committed", "repeatable read" or "serializable"
+func txOptionsFor(level string) (pgx.TxOptions, error) {
+	options := defaultOptions
+	switch isoLevel := pgx.TxIsoLevel(strings.ToLower(level)); isoLevel {
+	case "":
+	case pgx.ReadCommitted, pgx.RepeatableRead, pgx.Serializable:
+		options.IsoLevel = isoLevel
+	default:
+		return options, errors.Errorf("unsupported isolation level %q", level)
+	}
+	return options, nil
+}
+
+// Ping checks a connection of the pool can reach the database
+func (c *Client) Ping(ctx context.Context) error {
+	return c.pool.Ping(ctx)
 }
 
 // Query executues a query that typically returns more than one row
@@ -70,8 +199,7 @@ func (c *Client) QueryRow(ctx context.Context, query string, args ...interface{}
 
 // Exec executes a query that doesn't return rows
 func (c *Client) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
-	_, err := c.pool.Exec(ctx, query, args...)
-	return nil, err
+	return c.pool.Exec(ctx, query, args...)
 }
 
 func (c *Client) Commit(ctx context.Context) error {
@@ -82,8 +210,30 @@ func (c *Client) Rollback(ctx context.Context) error {
 	return nil
 }
 
+// SQLSTATEs reported by postgres
+const (
+	uniqueViolation      = "23505"
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// isRetryable reports whether err is a transaction conflict that can succeed if the
+// transaction is run again
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+	}
+	return false
+}
+
+// IsDuplicateError reports whether err was caused by a unique constraint violation
 func IsDuplicateError(err error) bool {
-	return strings.Contains(err.Error(), "duplicate key value violates unique constraint")
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == uniqueViolation
+	}
+	return errors.Is(err, apperrors.ErrDuplicate)
 }
 
 // Tx represents a database transaction
@@ -103,3 +253,73 @@ type Tx interface {
 	// Rollback rolls back the transaction
 	Rollback(ctx context.Context) error
 }
+
+// retryableTx is a pgx.Tx that remembers the last conflict the database reported, so RunInTx
+// can retry even when the caller replaced the error with one of its own
+type retryableTx struct {
+	pgx.Tx
+	failure error
+	parent  *retryableTx // the transaction a savepoint was taken in
+}
+
+func (t *retryableTx) track(err error) error {
+	if isRetryable(err) {
+		t.failure = err
+		// the whole transaction has to be retried, even if the savepoint's error is handled
+		if t.parent != nil {
+			t.parent.track(err)
+		}
+	}
+	return err
+}
+
+// savepoint runs fn in a savepoint of t, if fn fails t is rolled back to it and stays usable
+func (t *retryableTx) savepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	sp, err := t.Tx.Begin(ctx)
+	if err != nil {
+		return t.track(err)
+	}
+
+	tx := &retryableTx{Tx: sp, parent: t}
+	err = fn(context.WithValue(ctx, app.TxContextKey, tx))
+	if err == nil {
+		err = tx.track(tx.Commit(ctx))
+	}
+	tx.Rollback(ctx)
+	return err
+}
+
+func (t *retryableTx) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	rows, err := t.Tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, t.track(err)
+	}
+	return &retryableRows{Rows: rows, tx: t}, nil
+}
+
+func (t *retryableTx) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	return &retryableRow{row: t.Tx.QueryRow(ctx, query, args...), tx: t}
+}
+
+func (t *retryableTx) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	tag, err := t.Tx.Exec(ctx, query, args...)
+	return tag, t.track(err)
+}
+
+type retryableRows struct {
+	pgx.Rows
+	tx *retryableTx
+}
+
+func (r *retryableRows) Err() error {
+	return r.tx.track(r.Rows.Err())
+}
+
+type retryableRow struct {
+	row pgx.Row
+	tx  *retryableTx
+}
+
+func (r *retryableRow) Scan(dest ...interface{}) error {
+	return r.tx.track(r.row.Scan(dest...))
+}
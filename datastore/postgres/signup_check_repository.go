@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/jackc/pgx/v4"
+)
+
+type SignupCheckRepository struct {
+	client *Client
+}
+
+func NewSignupCheckRepository(client *Client) *SignupCheckRepository {
+	return &SignupCheckRepository{client: client}
+}
+
+const signupCheckColumns = "id, user_id, referrer_id, normalized_email, ip_address, device_fingerprint, decision, reasons, reviewed_at, created_at"
+
+func (s *SignupCheckRepository) CreateSignupCheck(ctx context.Context, check *app.SignupCheck) error {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	if check.Reasons == nil {
+		check.Reasons = []string{}
+	}
+
+	row := tx.QueryRow(ctx, `INSERT INTO signup_checks (user_id, referrer_id, normalized_email, ip_address, device_fingerprint, decision, reasons)
+VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id, created_at`,
+		check.UserID, check.ReferrerID, check.NormalizedEmail, check.IPAddress, check.DeviceFingerprint, check.Decision, check.Reasons)
+
+	return row.Scan(&check.ID, &check.CreatedAt)
+}
+
+func (s *SignupCheckRepository) FindSignupCheckByID(ctx context.Context, id string) (*app.SignupCheck, error) {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+signupCheckColumns+" FROM signup_checks WHERE id = $1", id)
+	return scanSignupCheck(row)
+}
+
+func (s *SignupCheckRepository) FindUserSignupCheck(ctx context.Context, userID string) (*app.SignupCheck, error) {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+signupCheckColumns+" FROM signup_checks WHERE user_id = $1", userID)
+	return scanSignupCheck(row)
+}
+
+func (s *SignupCheckRepository) CountSignupMatches(ctx context.Context, check *app.SignupCheck, since time.Time) (*app.SignupMatches, error) {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := &app.SignupMatches{}
+	row := tx.QueryRow(ctx, `SELECT
+    COUNT(*) FILTER (WHERE normalized_email = $1),
+    COUNT(*) FILTER (WHERE $2 <> '' AND ip_address = $2 AND created_at >= $4),
+    COUNT(*) FILTER (WHERE $3 <> '' AND device_fingerprint = $3 AND created_at >= $4)
+FROM signup_checks WHERE normalized_email = $1 OR ($2 <> '' AND ip_address = $2) OR ($3 <> '' AND device_fingerprint = $3)`,
+		check.NormalizedEmail, check.IPAddress, check.DeviceFingerprint, since)
+
+	if err = row.Scan(&matches.SameEmail, &matches.SameIP, &matches.SameDevice); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+func (s *SignupCheckRepository) CountReferrerSignups(ctx context.Context, referrerID string, since time.Time) (int64, error) {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	row := tx.QueryRow(ctx, "SELECT COUNT(*) FROM signup_checks WHERE referrer_id = $1 AND created_at >= $2", referrerID, since)
+	if err = row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *SignupCheckRepository) ListSignupChecks(ctx context.Context, decision app.ReferralDecision, limit int) ([]*app.SignupCheck, error) {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT "+signupCheckColumns+" FROM signup_checks WHERE decision = $1 ORDER BY created_at DESC, id DESC LIMIT $2", decision, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []*app.SignupCheck{}
+	for rows.Next() {
+		check, err := scanSignupCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+func (s *SignupCheckRepository) UpdateSignupCheckDecision(ctx context.Context, check *app.SignupCheck) error {
+	tx, err := s.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, "UPDATE signup_checks SET decision = $1, reviewed_at = $2 WHERE id = $3", check.Decision, check.ReviewedAt, check.ID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func scanSignupCheck(row pgx.Row) (*app.SignupCheck, error) {
+	c := &app.SignupCheck{}
+	err := row.Scan(&c.ID, &c.UserID, &c.ReferrerID, &c.NormalizedEmail, &c.IPAddress, &c.DeviceFingerprint, &c.Decision, &c.Reasons, &c.ReviewedAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
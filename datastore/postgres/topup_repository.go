@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/jackc/pgx/v4"
+)
+
+type TopupRepository struct {
+	client *Client
+}
+
+func NewTopupRepository(client *Client) *TopupRepository {
+	return &TopupRepository{client: client}
+}
+
+const topupColumns = "id, user_id, reference, points, amount, status, paid_at, created_at, updated_at"
+
+func (t *TopupRepository) CreateTopup(ctx context.Context, topup *app.Topup) error {
+	tx, err := t.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO topups (user_id, reference, points, amount, status) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at, updated_at",
+		topup.UserID, topup.Reference, topup.Points, topup.Amount, topup.Status)
+
+	return row.Scan(&topup.ID, &topup.CreatedAt, &topup.UpdatedAt)
+}
+
+func (t *TopupRepository) FindTopupByReference(ctx context.Context, reference string) (*app.Topup, error) {
+	tx, err := t.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+topupColumns+" FROM topups WHERE reference = $1", reference)
+	return scanTopup(row)
+}
+
+// LockTopupByReference reads the topup with SELECT ... FOR UPDATE, it must be called in a transaction
+func (t *TopupRepository) LockTopupByReference(ctx context.Context, reference string) (*app.Topup, error) {
+	tx, err := t.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+topupColumns+" FROM topups WHERE reference = $1 FOR UPDATE", reference)
+	return scanTopup(row)
+}
+
+func (t *TopupRepository) UpdateTopupStatus(ctx context.Context, topup *app.Topup) error {
+	tx, err := t.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "UPDATE topups SET status = $1, paid_at = $2, updated_at = now() WHERE id = $3 RETURNING updated_at",
+		topup.Status, topup.PaidAt, topup.ID)
+	return row.Scan(&topup.UpdatedAt)
+}
+
+func scanTopup(row pgx.Row) (*app.Topup, error) {
+	topup := &app.Topup{}
+	err := row.Scan(&topup.ID, &topup.UserID, &topup.Reference, &topup.Points, &topup.Amount, &topup.Status, &topup.PaidAt, &topup.CreatedAt, &topup.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return topup, nil
+}
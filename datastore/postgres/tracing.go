@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"runtime"
+	"strings"
+
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedTx starts a span for every query run through Tx, named after the repository method running it
+type tracedTx struct {
+	Tx
+}
+
+func (t tracedTx) Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	rows, err := t.Tx.Query(ctx, query, args...)
+	if err != nil {
+		tracing.RecordError(span, err)
+		span.End()
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (t tracedTx) QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	return &tracedRow{row: t.Tx.QueryRow(ctx, query, args...), span: span}
+}
+
+func (t tracedTx) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	tag, err := t.Tx.Exec(ctx, query, args...)
+	tracing.RecordError(span, err)
+	span.SetAttributes(attribute.Int64("db.rows_affected", tag.RowsAffected()))
+	return tag, err
+}
+
+// startQuerySpan starts the span of query, it must be called by the tracedTx method the repository called
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+	operation := strings.ToUpper(strings.SplitN(statement, " ", 2)[0])
+
+	return tracing.Start(ctx, callerName(3),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatement(statement), semconv.DBOperationKey.String(operation)),
+	)
+}
+
+// callerName returns the function skip frames up the stack as Type.Method, closures are named after
+// the function they're declared in
+func callerName(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip)
+	if !ok {
+		return "postgres.query"
+	}
+
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+	for i := strings.LastIndex(name, ".func"); i > 0; i = strings.LastIndex(name, ".func") {
+		name = name[:i]
+	}
+	return name
+}
+
+// tracedRows ends the span of their query once they're read or closed
+type tracedRows struct {
+	pgx.Rows
+	span  trace.Span
+	ended bool
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.end()
+	return false
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.end()
+}
+
+func (r *tracedRows) end() {
+	if r.ended {
+		return
+	}
+
+	r.ended = true
+	tracing.RecordError(r.span, r.Rows.Err())
+	r.span.End()
+}
+
+type tracedRow struct {
+	row  pgx.Row
+	span trace.Span
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	defer r.span.End()
+
+	err := r.row.Scan(dest...)
+	tracing.RecordError(r.span, err)
+	return err
+}
@@ -10,41 +10,69 @@ import (
 
 type UserPointsRepository struct {
 	client *Client
+	ledger *LedgerRepository
 }
 
 func NewUserPointsRepository(client *Client) *UserPointsRepository {
-	return &UserPointsRepository{client: client}
+	return &UserPointsRepository{client: client, ledger: NewLedgerRepository(client)}
 }
 
-func (u *UserPointsRepository) CreditUser(ctx context.Context, userID string, points int64) error {
-	tx, err := u.client.GetTx(ctx)
-	if err != nil {
-		return err
-	}
+// CreateUserPoint creates the user's points balance along with their ledger account,
+// a non-zero userPoint.Points is posted as an opening balance against OpeningBalanceAccount
+func (u *UserPointsRepository) CreateUserPoint(ctx context.Context, userPoint *app.UserPoints) error {
+	return u.client.inTx(ctx, func(ctx context.Context, tx Tx) error {
+		row := tx.QueryRow(ctx, "INSERT INTO user_points (user_id, points) VALUES ($1,0) RETURNING id, created_at, updated_at", userPoint.UserID)
+		if err := row.Scan(&userPoint.ID, &userPoint.CreatedAt, &userPoint.UpdatedAt); err != nil {
+			return err
+		}
+
+		account := &app.Account{
+			Code:   app.UserAccountCode(userPoint.UserID),
+			Kind:   app.UserAccountKind,
+			UserID: &userPoint.UserID,
+		}
 
-	_, err = tx.Exec(ctx, "UPDATE user_points SET points = points + $1 WHERE user_id = $2", points, userID)
-	return err
+		if err := u.ledger.CreateAccount(ctx, account); err != nil {
+			return errors.Wrap(err, "failed to create user account")
+		}
+
+		if userPoint.Points == 0 {
+			return nil
+		}
+
+		equity, err := u.ledger.FindAccountByCode(ctx, app.OpeningBalanceAccount)
+		if err != nil {
+			return errors.Wrap(err, "failed to find opening balance account")
+		}
+
+		entry := app.NewTransferEntry(app.OpeningBalanceEntry, userPoint.ID, "opening balance", equity.ID, account.ID, userPoint.Points)
+		return u.ledger.PostJournalEntry(ctx, entry)
+	})
 }
 
-func (u *UserPointsRepository) CreateUserPoint(ctx context.Context, userPoint *app.UserPoints) error {
+func (u *UserPointsRepository) GetUserPointsBalance(ctx context.Context, userID string) (int64, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	row := tx.QueryRow(ctx, "INSERT INTO user_points (user_id, points) VALUES ($1,$2) RETURNING id, created_at, updated_at", userPoint.UserID, userPoint.Points)
-
-	return row.Scan(&userPoint.ID, &userPoint.CreatedAt, &userPoint.UpdatedAt)
+	var balance int64
+	row := tx.QueryRow(ctx, "SELECT points from user_points WHERE user_id = $1 AND deleted_at IS NULL", userID)
+	if err := row.Scan(&balance); err != nil {
+		return 0, err
+	}
+	return balance, nil
 }
 
-func (u *UserPointsRepository) GetUserPointsBalance(ctx context.Context, userID string) (int64, error) {
+// LockUserPointsBalance reads the balance with SELECT ... FOR UPDATE, it must be called in a transaction
+func (u *UserPointsRepository) LockUserPointsBalance(ctx context.Context, userID string) (int64, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
 		return 0, err
 	}
 
 	var balance int64
-	row := tx.QueryRow(ctx, "SELECT points from user_points WHERE user_id = $1 AND deleted_at IS NULL", userID)
+	row := tx.QueryRow(ctx, "SELECT points from user_points WHERE user_id = $1 AND deleted_at IS NULL FOR UPDATE", userID)
 	if err := row.Scan(&balance); err != nil {
 		return 0, err
 	}
@@ -81,25 +109,118 @@ func (u *UserPointsRepository) CreatePointTransaction(ctx context.Context, txn *
 	return row.Scan(&txn.ID, &txn.CreatedAt, &txn.UpdatedAt)
 }
 
-func (u *UserPointsRepository) DebitUser(ctx context.Context, points int64, userID string) error {
+func (u *UserPointsRepository) ListPointTransactions(ctx context.Context) ([]*app.Transaction, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE user_points SET points = points - $1 WHERE user_id = $2 AND deleted_at IS NULL", points, userID)
-	return err
+	rows, err := tx.Query(ctx, "SELECT id, user_id, recipient_user_id, points, created_at, updated_at, deleted_at FROM transactions WHERE deleted_at IS NULL ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txns := []*app.Transaction{}
+	for rows.Next() {
+		txn := &app.Transaction{}
+		if err = rows.Scan(&txn.ID, &txn.UserID, &txn.RecipientUserID, &txn.Points, &txn.CreatedAt, &txn.UpdatedAt, &txn.DeletedAt); err != nil {
+			return nil, err
+		}
+		txns = append(txns, txn)
+	}
+	return txns, rows.Err()
 }
 
-func (u *UserPointsRepository) TransferPoints(ctx context.Context, senderID string, recipientID string, points int64) error {
-	err := u.DebitUser(ctx, points, senderID)
+func (u *UserPointsRepository) ListUserTransactions(ctx context.Context, userID string, filter *app.TransactionHistoryFilter) ([]*app.TransactionHistoryItem, error) {
+	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return errors.Wrap(err, "debit user failed")
+		return nil, err
 	}
 
-	err = u.CreditUser(ctx, recipientID, points)
+	const query = `
+SELECT p.id, e.kind, p.amount, e.reference, e.description, p.created_at,
+    (SELECT a.user_id FROM postings o JOIN accounts a ON a.id = o.account_id
+     WHERE o.journal_entry_id = p.journal_entry_id AND o.id <> p.id LIMIT 1)
+FROM postings p
+JOIN journal_entries e ON e.id = p.journal_entry_id
+JOIN accounts acc ON acc.id = p.account_id
+WHERE acc.user_id = $1
+    AND ($2 = '' OR ($2 = 'sent' AND p.amount < 0) OR ($2 = 'received' AND p.amount > 0))
+    AND ($3::timestamptz IS NULL OR p.created_at >= $3)
+    AND ($4::timestamptz IS NULL OR p.created_at < $4)
+    AND ($5::timestamptz IS NULL OR (p.created_at, p.id) < ($5, $6::uuid))
+ORDER BY p.created_at DESC, p.id DESC
+LIMIT $7`
+
+	var beforeID *string
+	if filter.Before != nil {
+		beforeID = &filter.BeforeID
+	}
+
+	rows, err := tx.Query(ctx, query, userID, filter.Direction, filter.From, filter.To, filter.Before, beforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*app.TransactionHistoryItem{}
+	for rows.Next() {
+		item := &app.TransactionHistoryItem{}
+		var amount int64
+		err = rows.Scan(&item.ID, &item.Kind, &amount, &item.Reference, &item.Description, &item.CreatedAt, &item.CounterpartyUserID)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Direction, item.Points = app.ReceivedDirection, amount
+		if amount < 0 {
+			item.Direction, item.Points = app.SentDirection, -amount
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetUserReferralEarnings sums every referral bonus credited to userID
+func (u *UserPointsRepository) GetUserReferralEarnings(ctx context.Context, userID string) (int64, error) {
+	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return errors.Wrap(err, "credit user failed")
+		return 0, err
+	}
+
+	var earnings int64
+	row := tx.QueryRow(ctx, `
+SELECT COALESCE(SUM(p.amount), 0) FROM postings p
+JOIN journal_entries e ON e.id = p.journal_entry_id
+JOIN accounts a ON a.id = p.account_id
+WHERE a.user_id = $1 AND e.kind = ANY($2)`, userID, referralRewardKinds())
+	if err = row.Scan(&earnings); err != nil {
+		return 0, err
+	}
+	return earnings, nil
+}
+
+// GetUserLastActivity returns when userID's balance last changed, nil if it never has
+func (u *UserPointsRepository) GetUserLastActivity(ctx context.Context, userID string) (*time.Time, error) {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *time.Time
+	row := tx.QueryRow(ctx, "SELECT MAX(p.created_at) FROM postings p JOIN accounts a ON a.id = p.account_id WHERE a.user_id = $1", userID)
+	if err = row.Scan(&last); err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// referralRewardKinds returns app.ReferralRewardEntries as strings, for ANY($n)
+func referralRewardKinds() []string {
+	kinds := make([]string, len(app.ReferralRewardEntries))
+	for i, kind := range app.ReferralRewardEntries {
+		kinds[i] = string(kind)
 	}
-	return nil
+	return kinds
 }
@@ -2,8 +2,11 @@ package postgres
 
 import (
 	"context"
-	app "github.com/danvixent/aboki-africa-assessment"
 	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
 )
 
 type UserReferralRepository struct {
@@ -20,8 +23,8 @@ func (u *UserReferralRepository) CreateUserReferral(ctx context.Context, referra
 		return err
 	}
 
-	row := tx.QueryRow(ctx, "INSERT INTO user_referrals (referrer_id, referee_id) VALUES ($1,$2) RETURNING id, created_at, updated_at",
-		referral.ReferrerID, referral.RefereeID)
+	row := tx.QueryRow(ctx, "INSERT INTO user_referrals (referrer_id, referee_id, held) VALUES ($1,$2,$3) RETURNING id, created_at, updated_at",
+		referral.ReferrerID, referral.RefereeID, referral.Held)
 
 	err = row.Scan(&referral.ID, &referral.CreatedAt, &referral.UpdatedAt)
 	if err != nil {
@@ -37,7 +40,7 @@ func (u *UserReferralRepository) GetUnpaidUserReferralCount(ctx context.Context,
 	}
 	var count int64
 
-	row := tx.QueryRow(ctx, "SELECT COUNT(*) FROM user_referrals WHERE referrer_id = $1 AND paid_out = false AND deleted_at IS NULL", userID)
+	row := tx.QueryRow(ctx, "SELECT COUNT(*) FROM user_referrals WHERE referrer_id = $1 AND paid_out = false AND held = false AND deleted_at IS NULL", userID)
 
 	if err = row.Scan(&count); err != nil {
 		return 0, err
@@ -45,32 +48,49 @@ func (u *UserReferralRepository) GetUnpaidUserReferralCount(ctx context.Context,
 	return count, nil
 }
 
-func (u *UserReferralRepository) MarkPendingReferralsAsPaid(ctx context.Context, referrerID string) error {
+func (u *UserReferralRepository) MarkPendingReferralsAsPaid(ctx context.Context, referrerID string, limit int64) ([]string, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE user_referrals SET paid_out = true WHERE referrer_id = $1 AND deleted_at IS NULL", referrerID)
-	return err
-}
-
-func (u *UserReferralRepository) GetUserReferrer(ctx context.Context, userID string) (*app.User, error) {
-	tx, err := u.client.GetTx(ctx)
+	// RETURNING comes back in no particular order, so the paid rows are sorted again
+	query := `WITH paid AS (
+		UPDATE user_referrals SET paid_out = true, updated_at = now() WHERE id IN (
+			SELECT id FROM user_referrals WHERE referrer_id = $1 AND paid_out = false AND held = false AND deleted_at IS NULL
+			ORDER BY created_at, id LIMIT $2
+		) RETURNING id, referee_id, created_at
+	)
+	SELECT referee_id FROM paid ORDER BY created_at, id`
+	rows, err := tx.Query(ctx, query, referrerID, limit)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	row := tx.QueryRow(ctx, "SELECT * FROM users WHERE id IN( SELECT referrer_id FROM user_referrals WHERE referee_id = $1 AND deleted_at IS NULL)", userID)
+	refereeIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		refereeIDs = append(refereeIDs, id)
+	}
+	return refereeIDs, rows.Err()
+}
 
-	user := &app.User{}
-	err = row.Scan(&user.ID, &user.Name, &user.Email, &user.ReferralCode, &user.CreatedAt, &user.UpdatedAt)
+func (u *UserReferralRepository) GetUserReferrer(ctx context.Context, userID string) (*app.User, error) {
+	tx, err := u.client.GetTx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
+
+	row := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id IN( SELECT referrer_id FROM user_referrals WHERE referee_id = $1 AND deleted_at IS NULL)", userID)
+	return scanUser(row)
 }
 
+// CreateReferredUserTransactionBonus returns errors.ErrDuplicate when the referee already has a bonus, the
+// conflict is skipped rather than raised so the transaction in ctx can still be used afterwards
 func (u *UserReferralRepository) CreateReferredUserTransactionBonus(ctx context.Context, referral *app.ReferredUserTransactionBonus) error {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
@@ -80,17 +100,17 @@ func (u *UserReferralRepository) CreateReferredUserTransactionBonus(ctx context.
 	referral.CreatedAt = time.Now()
 	referral.UpdatedAt = time.Now()
 
-	row := tx.QueryRow(ctx, "INSERT INTO referred_user_transaction_bonuses (referrer_id, referee_id, created_at, updated_at) VALUES ('$1','$2','$3','$4') RETURNING id",
+	row := tx.QueryRow(ctx, "INSERT INTO referred_user_transaction_bonuses (referrer_id, referee_id, created_at, updated_at) VALUES ($1,$2,$3,$4) ON CONFLICT (referee_id) DO NOTHING RETURNING id",
 		referral.ReferrerID, referral.RefereeID, referral.CreatedAt, referral.UpdatedAt)
 
 	err = row.Scan(&referral.ID)
-	if err != nil {
-		return err
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrDuplicate
 	}
-	return nil
+	return err
 }
 
-func (u *UserReferralRepository) GetUnpaidReferredUserTransactionBonus(ctx context.Context, userID string) ([]*app.ReferredUserTransactionBonus, error) {
+func (u *UserReferralRepository) GetUnpaidReferredUserTransactionBonus(ctx context.Context, userID string, limit int64) ([]*app.ReferredUserTransactionBonus, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
 		return nil, err
@@ -98,7 +118,11 @@ func (u *UserReferralRepository) GetUnpaidReferredUserTransactionBonus(ctx conte
 
 	bonuses := []*app.ReferredUserTransactionBonus{}
 
-	rows, err := tx.Query(ctx, "SELECT * FROM referred_user_transaction_bonuses WHERE referrer_id = $1 AND paid_out = false AND deleted_at IS NULL LIMIT 3", userID)
+	rows, err := tx.Query(ctx, `
+SELECT b.* FROM referred_user_transaction_bonuses b
+WHERE b.referrer_id = $1 AND b.paid_out = false AND b.deleted_at IS NULL
+    AND NOT EXISTS (SELECT 1 FROM user_referrals r WHERE r.referee_id = b.referee_id AND r.held = true AND r.deleted_at IS NULL)
+ORDER BY b.created_at, b.id LIMIT NULLIF($2, 0)`, userID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -106,7 +130,7 @@ func (u *UserReferralRepository) GetUnpaidReferredUserTransactionBonus(ctx conte
 
 	for rows.Next() {
 		bonus := &app.ReferredUserTransactionBonus{}
-		err = rows.Scan(&bonus.ID, &bonus.ReferrerID, &bonus.ReferrerID, &bonus.RefereeID, &bonus.PaidOut, &bonus.CreatedAt, &bonus.UpdatedAt)
+		err = rows.Scan(&bonus.ID, &bonus.ReferrerID, &bonus.RefereeID, &bonus.PaidOut, &bonus.CreatedAt, &bonus.UpdatedAt, &bonus.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -122,6 +146,140 @@ func (u *UserReferralRepository) PayReferralsTransactionsBonuses(ctx context.Con
 		return err
 	}
 
-	_, err = tx.Exec(ctx, "UPDATE referred_user_transaction_bonuses SET paid_out = true WHERE id IN ($1) AND deleted_at IS NULL", ids)
+	_, err = tx.Exec(ctx, "UPDATE referred_user_transaction_bonuses SET paid_out = true WHERE id = ANY($1) AND deleted_at IS NULL", ids)
+	return err
+}
+
+func (u *UserReferralRepository) ListPaidReferredUserTransactionBonuses(ctx context.Context) ([]*app.ReferredUserTransactionBonus, error) {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT id, referrer_id, referee_id, paid_out, created_at, updated_at, deleted_at FROM referred_user_transaction_bonuses WHERE paid_out = true ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bonuses := []*app.ReferredUserTransactionBonus{}
+	for rows.Next() {
+		bonus := &app.ReferredUserTransactionBonus{}
+		err = rows.Scan(&bonus.ID, &bonus.ReferrerID, &bonus.RefereeID, &bonus.PaidOut, &bonus.CreatedAt, &bonus.UpdatedAt, &bonus.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		bonuses = append(bonuses, bonus)
+	}
+	return bonuses, rows.Err()
+}
+
+func (u *UserReferralRepository) DeleteUnpaidRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE user_referrals SET deleted_at = $1 WHERE referee_id = $2 AND paid_out = false AND deleted_at IS NULL", deletedAt, refereeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE referred_user_transaction_bonuses SET deleted_at = $1 WHERE referee_id = $2 AND paid_out = false AND deleted_at IS NULL", deletedAt, refereeID)
+	return err
+}
+
+func (u *UserReferralRepository) RestoreRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE user_referrals SET deleted_at = NULL WHERE referee_id = $1 AND deleted_at = $2", refereeID, deletedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE referred_user_transaction_bonuses SET deleted_at = NULL WHERE referee_id = $1 AND deleted_at = $2", refereeID, deletedAt)
+	return err
+}
+
+func (u *UserReferralRepository) ReleaseHeldReferral(ctx context.Context, refereeID string) error {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE user_referrals SET held = false, updated_at = now() WHERE referee_id = $1 AND held = true AND deleted_at IS NULL", refereeID)
 	return err
 }
+
+func (u *UserReferralRepository) GetReferralTree(ctx context.Context, userID string, depth int) ([]*app.ReferralNode, error) {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `WITH RECURSIVE tree AS (
+    SELECT r.referee_id, r.referrer_id, r.paid_out, r.held, r.created_at, 1 AS depth
+    FROM user_referrals r JOIN users u ON u.id = r.referee_id AND u.deleted_at IS NULL
+    WHERE r.referrer_id = $1 AND r.deleted_at IS NULL
+    UNION ALL
+    SELECT r.referee_id, r.referrer_id, r.paid_out, r.held, r.created_at, t.depth + 1
+    FROM user_referrals r JOIN tree t ON r.referrer_id = t.referee_id
+    JOIN users u ON u.id = r.referee_id AND u.deleted_at IS NULL
+    WHERE r.deleted_at IS NULL AND t.depth < $2
+)
+SELECT t.referee_id, u.name, t.referrer_id, t.depth, t.paid_out, t.held, u.deactivated_at IS NULL, t.created_at
+FROM tree t JOIN users u ON u.id = t.referee_id
+ORDER BY t.depth, t.created_at, t.referee_id`, userID, depth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []*app.ReferralNode{}
+	for rows.Next() {
+		node := &app.ReferralNode{}
+		referral := &app.UserReferral{}
+		err = rows.Scan(&node.UserID, &node.Name, &node.ReferrerID, &node.Depth, &referral.PaidOut, &referral.Held, &node.Active, &node.ReferredAt)
+		if err != nil {
+			return nil, err
+		}
+
+		node.Status = app.ReferralStatusOf(referral)
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
+
+func (u *UserReferralRepository) GetReferralUpline(ctx context.Context, userID string, depth int) ([]*app.User, error) {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `WITH RECURSIVE upline AS (
+    SELECT r.referrer_id, 1 AS depth
+    FROM user_referrals r WHERE r.referee_id = $1 AND r.held = false AND r.deleted_at IS NULL
+    UNION ALL
+    SELECT r.referrer_id, up.depth + 1
+    FROM user_referrals r JOIN upline up ON r.referee_id = up.referrer_id
+    WHERE r.held = false AND r.deleted_at IS NULL AND up.depth < $2
+)
+SELECT `+userColumns+` FROM upline JOIN users ON users.id = upline.referrer_id ORDER BY upline.depth`, userID, depth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*app.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
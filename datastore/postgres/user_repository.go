@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"context"
+
 	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 )
 
@@ -27,43 +30,80 @@ func (u *UserResource) CreateUser(ctx context.Context, user *app.User) error {
 		return err
 	}
 
+	// a taken referral code is skipped rather than raised so another one can be tried in the same transaction
 	row := tx.QueryRow(ctx,
-		"INSERT INTO users (name, email, referral_code) VALUES($1, $2, $3) RETURNING id, created_at, updated_at",
-		user.Name, user.Email, user.ReferralCode)
+		"INSERT INTO users (name, email, referral_code, password_hash) VALUES($1, $2, $3, $4) ON CONFLICT (referral_code) DO NOTHING RETURNING id, created_at, updated_at",
+		user.Name, user.Email, user.ReferralCode, user.PasswordHash)
 
 	err = row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrDuplicateReferralCode
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "users_email_key" {
+		return errors.ErrEmailTaken
+	}
+	return err
+}
+
+func (u *UserResource) FindUserByID(ctx context.Context, id string) (*app.User, error) {
+	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	row := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 AND deleted_at IS NULL", id)
+	return scanUser(row)
 }
 
-func (u *UserResource) FindUserByID(ctx context.Context, id string) error {
+func (u *UserResource) FindUserByReferralCode(ctx context.Context, code string) (*app.User, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	row := tx.QueryRow(ctx, "SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL", id)
+	row := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE referral_code = $1 AND deleted_at IS NULL", code)
+	return scanUser(row)
+}
 
-	user := &app.User{}
-	err = row.Scan(&user.ID, &user.Name, &user.Email, &user.ReferralCode, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt)
+func (u *UserResource) FindUserByEmail(ctx context.Context, email string) (*app.User, error) {
+	tx, err := u.client.GetTx(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	row := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1 AND deleted_at IS NULL", email)
+	return scanUser(row)
 }
 
-func (u *UserResource) FindUserByReferralCode(ctx context.Context, code string) (*app.User, error) {
+func (u *UserResource) FindUserByIDWithDeleted(ctx context.Context, id string) (*app.User, error) {
 	tx, err := u.client.GetTx(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	row := tx.QueryRow(ctx, "SELECT * FROM users WHERE referral_code = $1 AND deleted_at IS NULL", code)
+	row := tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id)
+	return scanUser(row)
+}
+
+func (u *UserResource) UpdateUserLifecycle(ctx context.Context, user *app.User) error {
+	tx, err := u.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "UPDATE users SET deactivated_at = $1, deleted_at = $2, updated_at = now() WHERE id = $3 RETURNING updated_at",
+		user.DeactivatedAt, user.DeletedAt, user.ID)
+	return row.Scan(&user.UpdatedAt)
+}
+
+// userColumns are the users columns scanUser expects, in order
+const userColumns = "id, name, email, referral_code, password_hash, created_at, updated_at, deactivated_at, deleted_at"
 
+func scanUser(row pgx.Row) (*app.User, error) {
 	user := &app.User{}
-	err = row.Scan(&user.ID, &user.Name, &user.Email, &user.ReferralCode, &user.CreatedAt, &user.UpdatedAt, &user.DeletedAt)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.ReferralCode, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, &user.DeactivatedAt, &user.DeletedAt)
 	if err != nil {
 		return nil, err
 	}
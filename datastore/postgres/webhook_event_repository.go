@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type WebhookEventRepository struct {
+	client *Client
+}
+
+func NewWebhookEventRepository(client *Client) *WebhookEventRepository {
+	return &WebhookEventRepository{client: client}
+}
+
+// CreateWebhookEvent returns errors.ErrDuplicate for an event that was already recorded, the conflict
+// is skipped rather than raised so the transaction in ctx can still be used afterwards
+func (w *WebhookEventRepository) CreateWebhookEvent(ctx context.Context, event *app.WebhookEvent) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO webhook_events (provider, event_id, event, payload) VALUES ($1,$2,$3,$4) ON CONFLICT (provider, event_id) DO NOTHING RETURNING id, created_at",
+		event.Provider, event.EventID, event.Event, string(event.Payload))
+
+	err = row.Scan(&event.ID, &event.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrDuplicate
+	}
+	return err
+}
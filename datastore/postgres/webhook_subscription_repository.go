@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+type WebhookSubscriptionRepository struct {
+	client *Client
+}
+
+func NewWebhookSubscriptionRepository(client *Client) *WebhookSubscriptionRepository {
+	return &WebhookSubscriptionRepository{client: client}
+}
+
+const webhookSubscriptionColumns = "id, user_id, url, events, secret, created_at, deleted_at"
+
+func (w *WebhookSubscriptionRepository) CreateWebhookSubscription(ctx context.Context, subscription *app.WebhookSubscription) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO webhook_subscriptions (user_id, url, events, secret) VALUES ($1,$2,$3,$4) RETURNING id, created_at",
+		subscription.UserID, subscription.URL, subscription.Events, subscription.Secret)
+
+	return row.Scan(&subscription.ID, &subscription.CreatedAt)
+}
+
+func (w *WebhookSubscriptionRepository) FindWebhookSubscriptionByID(ctx context.Context, id string) (*app.WebhookSubscription, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = $1 AND deleted_at IS NULL", id)
+	return scanWebhookSubscription(row)
+}
+
+func (w *WebhookSubscriptionRepository) ListUserWebhookSubscriptions(ctx context.Context, userID string) ([]*app.WebhookSubscription, error) {
+	return w.list(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at", userID)
+}
+
+func (w *WebhookSubscriptionRepository) ListWebhookSubscriptionsForUsers(ctx context.Context, userIDs []string) ([]*app.WebhookSubscription, error) {
+	return w.list(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE user_id = ANY($1::uuid[]) AND deleted_at IS NULL ORDER BY created_at", userIDs)
+}
+
+func (w *WebhookSubscriptionRepository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, "UPDATE webhook_subscriptions SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (w *WebhookSubscriptionRepository) list(ctx context.Context, query string, args ...interface{}) ([]*app.WebhookSubscription, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*app.WebhookSubscription{}
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func scanWebhookSubscription(row pgx.Row) (*app.WebhookSubscription, error) {
+	s := &app.WebhookSubscription{}
+	err := row.Scan(&s.ID, &s.UserID, &s.URL, &s.Events, &s.Secret, &s.CreatedAt, &s.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type WebhookDeliveryRepository struct {
+	client *Client
+}
+
+func NewWebhookDeliveryRepository(client *Client) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{client: client}
+}
+
+const webhookDeliveryColumns = "id, subscription_id, event_id, event_type, payload, status, attempts, response_status, last_error, next_attempt_at, delivered_at, created_at, updated_at"
+
+// CreateWebhookDelivery returns errors.ErrDuplicate when the event was already delivered to the subscription,
+// the conflict is skipped rather than raised so the transaction in ctx can still be used afterwards
+func (w *WebhookDeliveryRepository) CreateWebhookDelivery(ctx context.Context, delivery *app.WebhookDelivery) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, `INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, status)
+VALUES ($1,$2,$3,$4,$5) ON CONFLICT (subscription_id, event_id) DO NOTHING RETURNING id, next_attempt_at, created_at, updated_at`,
+		delivery.SubscriptionID, delivery.EventID, delivery.EventType, string(delivery.Payload), delivery.Status)
+
+	err = row.Scan(&delivery.ID, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrDuplicate
+	}
+	return err
+}
+
+func (w *WebhookDeliveryRepository) FindWebhookDeliveryByID(ctx context.Context, id string) (*app.WebhookDelivery, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE id = $1", id)
+	return scanWebhookDelivery(row)
+}
+
+// ClaimWebhookDeliveries locks the deliveries with FOR UPDATE SKIP LOCKED, it must be called in a transaction
+func (w *WebhookDeliveryRepository) ClaimWebhookDeliveries(ctx context.Context, limit int) ([]*app.WebhookDelivery, error) {
+	return w.list(ctx, `
+SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries
+WHERE status = 'pending' AND next_attempt_at <= now()
+	AND subscription_id IN (SELECT id FROM webhook_subscriptions WHERE deleted_at IS NULL)
+ORDER BY next_attempt_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED`, limit)
+}
+
+func (w *WebhookDeliveryRepository) UpdateWebhookDelivery(ctx context.Context, delivery *app.WebhookDelivery) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = $2, response_status = $3, last_error = $4,
+next_attempt_at = $5, delivered_at = $6, updated_at = now() WHERE id = $7 RETURNING updated_at`,
+		delivery.Status, delivery.Attempts, delivery.ResponseStatus, delivery.LastError, delivery.NextAttemptAt, delivery.DeliveredAt, delivery.ID)
+
+	return row.Scan(&delivery.UpdatedAt)
+}
+
+func (w *WebhookDeliveryRepository) ListSubscriptionWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*app.WebhookDelivery, error) {
+	return w.list(ctx, "SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE subscription_id = $1 ORDER BY created_at DESC LIMIT $2", subscriptionID, limit)
+}
+
+func (w *WebhookDeliveryRepository) list(ctx context.Context, query string, args ...interface{}) ([]*app.WebhookDelivery, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*app.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookDelivery(row pgx.Row) (*app.WebhookDelivery, error) {
+	d := &app.WebhookDelivery{}
+	var payload string
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.ResponseStatus, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = []byte(payload)
+	return d, nil
+}
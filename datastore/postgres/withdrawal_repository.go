@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/jackc/pgx/v4"
+)
+
+type BankRecipientRepository struct {
+	client *Client
+}
+
+func NewBankRecipientRepository(client *Client) *BankRecipientRepository {
+	return &BankRecipientRepository{client: client}
+}
+
+const bankRecipientColumns = "id, user_id, recipient_code, account_number, account_name, bank_code, bank_name, created_at, updated_at, deleted_at"
+
+func (b *BankRecipientRepository) CreateBankRecipient(ctx context.Context, recipient *app.BankRecipient) error {
+	tx, err := b.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO bank_recipients (user_id, recipient_code, account_number, account_name, bank_code, bank_name) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id, created_at, updated_at",
+		recipient.UserID, recipient.RecipientCode, recipient.AccountNumber, recipient.AccountName, recipient.BankCode, recipient.BankName)
+
+	return row.Scan(&recipient.ID, &recipient.CreatedAt, &recipient.UpdatedAt)
+}
+
+func (b *BankRecipientRepository) FindBankRecipientByID(ctx context.Context, id string) (*app.BankRecipient, error) {
+	tx, err := b.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+bankRecipientColumns+" FROM bank_recipients WHERE id = $1 AND deleted_at IS NULL", id)
+	return scanBankRecipient(row)
+}
+
+func (b *BankRecipientRepository) ListUserBankRecipients(ctx context.Context, userID string) ([]*app.BankRecipient, error) {
+	tx, err := b.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT "+bankRecipientColumns+" FROM bank_recipients WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*app.BankRecipient{}
+	for rows.Next() {
+		recipient, err := scanBankRecipient(rows)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+func scanBankRecipient(row pgx.Row) (*app.BankRecipient, error) {
+	r := &app.BankRecipient{}
+	err := row.Scan(&r.ID, &r.UserID, &r.RecipientCode, &r.AccountNumber, &r.AccountName, &r.BankCode, &r.BankName, &r.CreatedAt, &r.UpdatedAt, &r.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type WithdrawalRepository struct {
+	client *Client
+}
+
+func NewWithdrawalRepository(client *Client) *WithdrawalRepository {
+	return &WithdrawalRepository{client: client}
+}
+
+const withdrawalColumns = "id, user_id, bank_recipient_id, reference, points, amount, status, transfer_code, failure_reason, completed_at, created_at, updated_at"
+
+func (w *WithdrawalRepository) CreateWithdrawal(ctx context.Context, withdrawal *app.Withdrawal) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "INSERT INTO withdrawals (user_id, bank_recipient_id, reference, points, amount, status) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id, created_at, updated_at",
+		withdrawal.UserID, withdrawal.BankRecipientID, withdrawal.Reference, withdrawal.Points, withdrawal.Amount, withdrawal.Status)
+
+	return row.Scan(&withdrawal.ID, &withdrawal.CreatedAt, &withdrawal.UpdatedAt)
+}
+
+func (w *WithdrawalRepository) FindWithdrawalByReference(ctx context.Context, reference string) (*app.Withdrawal, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+withdrawalColumns+" FROM withdrawals WHERE reference = $1", reference)
+	return scanWithdrawal(row)
+}
+
+// LockWithdrawalByReference reads the withdrawal with SELECT ... FOR UPDATE, it must be called in a transaction
+func (w *WithdrawalRepository) LockWithdrawalByReference(ctx context.Context, reference string) (*app.Withdrawal, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	row := tx.QueryRow(ctx, "SELECT "+withdrawalColumns+" FROM withdrawals WHERE reference = $1 FOR UPDATE", reference)
+	return scanWithdrawal(row)
+}
+
+func (w *WithdrawalRepository) UpdateWithdrawal(ctx context.Context, withdrawal *app.Withdrawal) error {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	row := tx.QueryRow(ctx, "UPDATE withdrawals SET status = $1, transfer_code = $2, failure_reason = $3, completed_at = $4, updated_at = now() WHERE id = $5 RETURNING updated_at",
+		withdrawal.Status, withdrawal.TransferCode, withdrawal.FailureReason, withdrawal.CompletedAt, withdrawal.ID)
+	return row.Scan(&withdrawal.UpdatedAt)
+}
+
+func (w *WithdrawalRepository) GetUserWithdrawnPointsSince(ctx context.Context, userID string, since time.Time) (int64, error) {
+	tx, err := w.client.GetTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	row := tx.QueryRow(ctx, "SELECT COALESCE(SUM(points), 0) FROM withdrawals WHERE user_id = $1 AND created_at >= $2 AND status <> $3",
+		userID, since, app.WithdrawalFailed)
+	if err = row.Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func scanWithdrawal(row pgx.Row) (*app.Withdrawal, error) {
+	w := &app.Withdrawal{}
+	err := row.Scan(&w.ID, &w.UserID, &w.BankRecipientID, &w.Reference, &w.Points, &w.Amount, &w.Status, &w.TransferCode, &w.FailureReason, &w.CompletedAt, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
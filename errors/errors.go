@@ -1,15 +1,152 @@
 package errors
 
-import "github.com/pkg/errors"
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
 
 var (
-	ErrGeneric           = errors.New("something went wrong")
-	ErrDebitUserFailed   = errors.New("failed to debit user")
-	ErrCreditUserFailed  = errors.New("failed to credit user")
-	ErrInsufficientFunds = errors.New("insufficient funds for the operation you're trying to perform")
-	ErrCreateUserFailed  = errors.New("failed to create user")
+	ErrGeneric           = Internal("something went wrong")
+	ErrDebitUserFailed   = Internal("failed to debit user")
+	ErrCreditUserFailed  = Internal("failed to credit user")
+	ErrInsufficientFunds = InsufficientFunds("insufficient funds for the operation you're trying to perform")
+	ErrCreateUserFailed  = Internal("failed to create user")
+	ErrDuplicate         = errors.New("duplicate key value violates unique constraint")
+
+	ErrDuplicateReferralCode = errors.New("referral code is already taken")
+
+	ErrUnbalancedJournalEntry = errors.New("journal entry postings must be non-zero and sum to zero")
+
+	ErrUnauthenticated    = Unauthorized("a valid bearer token is required")
+	ErrForbidden          = Forbidden("you're not allowed to access this resource")
+	ErrInvalidCredentials = Unauthorized("invalid email or password")
+
+	ErrUserNotFound              = NotFound("user not found")
+	ErrRecipientNotFound         = NotFound("recipient not found")
+	ErrRecipientInactive         = InvalidField("recipient_user_id", "the recipient's account is not active")
+	ErrAccountInactive           = Forbidden("your account has been deactivated")
+	ErrEmailTaken                = Conflict("a user with this email already exists")
+	ErrUnknownReferralCode       = InvalidField("referral_code", "referral code does not exist")
+	ErrSelfTransfer              = InvalidField("recipient_user_id", "you can't transfer points to yourself")
+	ErrInvalidCursor             = InvalidField("cursor", "invalid pagination cursor")
+	ErrInvalidDirection          = InvalidField("direction", "direction must be either sent or received")
+	ErrNonPositiveTransferAmount = InvalidField("points", "points must be greater than zero")
+
+	ErrIdempotencyKeyReused        = Conflict("idempotency key has already been used with a different request")
+	ErrIdempotentRequestInProgress = Conflict("a request with this idempotency key is still being processed")
+
+	ErrTopupNotFound          = NotFound("topup not found")
+	ErrNonPositiveTopupAmount = InvalidField("points", "points must be greater than zero")
+	ErrTopupTooLarge          = InvalidField("points", "too many points in one topup")
+	ErrPaymentProviderFailed  = Upstream("payment provider is unavailable, please try again")
+
+	ErrBankRecipientNotFound   = NotFound("bank account not found")
+	ErrBankRecipientExists     = Conflict("this bank account has already been added")
+	ErrUnresolvedBankAccount   = InvalidField("account_number", "the bank account could not be resolved")
+	ErrWithdrawalNotFound      = NotFound("withdrawal not found")
+	ErrWithdrawalLimitExceeded = LimitExceeded("this withdrawal would exceed your daily withdrawal limit")
+
+	ErrInvalidWebhookSignature = Unauthorized("invalid webhook signature")
+	ErrInvalidWebhookPayload   = Validation("invalid webhook payload")
+
+	ErrWebhookSubscriptionNotFound = NotFound("webhook subscription not found")
+	ErrInvalidWebhookURL           = InvalidField("url", "url must be an absolute http or https URL")
+	ErrUnresolvedWebhookURL        = InvalidField("url", "the url's host could not be resolved")
+	ErrPrivateWebhookURL           = InvalidField("url", "url must resolve to a public address")
+	ErrWebhookDeliveryNotFound     = NotFound("webhook delivery not found")
+	ErrWebhookDeliveryNotFailed    = Conflict("only failed webhook deliveries can be replayed")
+
+	ErrSignupCheckNotFound = NotFound("signup check not found")
+	ErrSignupCheckNotHeld  = Conflict("only held referrals can be reviewed")
+	ErrInvalidDecision     = InvalidField("decision", "decision must be one of allow, hold or block")
+
+	ErrInvalidReferralTreeDepth = InvalidField("depth", "depth must be between 1 and 10")
+
+	ErrInvalidLeaderboardPeriod = InvalidField("period", "period must be one of day, week, month or all")
+	ErrInvalidLeaderboardMetric = InvalidField("metric", "metric must be either referrals or points")
+	ErrInvalidOffset            = InvalidField("offset", "offset must not be negative")
+)
+
+type Code string
+
+const (
+	CodeInternal          Code = "internal_error"
+	CodeValidation        Code = "validation_error"
+	CodeNotFound          Code = "not_found"
+	CodeConflict          Code = "conflict"
+	CodeInsufficientFunds Code = "insufficient_funds"
+	CodeUnauthorized      Code = "unauthorized"
+	CodeForbidden         Code = "forbidden"
+	CodeUpstream          Code = "upstream_error"
+	CodeLimitExceeded     Code = "limit_exceeded"
 )
 
+// Error is an error that's safe to show to API clients, Message and Details are sent as is
+// and Status is the HTTP status code it's reported with
+type Error struct {
+	Code    Code                   `json:"code"`
+	Status  int                    `json:"-"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func Internal(message string) *Error {
+	return &Error{Code: CodeInternal, Status: http.StatusInternalServerError, Message: message}
+}
+
+func Validation(message string) *Error {
+	return &Error{Code: CodeValidation, Status: http.StatusBadRequest, Message: message}
+}
+
+// InvalidField is a validation error naming the offending field in its details
+func InvalidField(field string, message string) *Error {
+	return &Error{Code: CodeValidation, Status: http.StatusBadRequest, Message: message, Details: map[string]interface{}{"field": field}}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Status: http.StatusNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Status: http.StatusConflict, Message: message}
+}
+
+func InsufficientFunds(message string) *Error {
+	return &Error{Code: CodeInsufficientFunds, Status: http.StatusUnprocessableEntity, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Status: http.StatusUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Status: http.StatusForbidden, Message: message}
+}
+
+func LimitExceeded(message string) *Error {
+	return &Error{Code: CodeLimitExceeded, Status: http.StatusUnprocessableEntity, Message: message}
+}
+
+// Upstream reports a failure of a service we depend on, like the payment provider
+func Upstream(message string) *Error {
+	return &Error{Code: CodeUpstream, Status: http.StatusBadGateway, Message: message}
+}
+
+// ToError returns the *Error in err's chain, any other error is reported as ErrGeneric
+// so internal details never leak to clients
+func ToError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return ErrGeneric
+}
+
 func New(message string) error {
 	return errors.New(message)
 }
@@ -21,3 +158,7 @@ func Wrap(err error, message string) error {
 func Is(err error, target error) bool {
 	return errors.Is(err, target)
 }
+
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
@@ -0,0 +1,31 @@
+package fraud
+
+import "strings"
+
+// domains whose mailboxes ignore dots in the local part, googlemail.com addresses are gmail.com ones
+var dotlessDomains = map[string]bool{"gmail.com": true}
+
+// NormalizeEmail reduces email to the mailbox it's delivered to: it's lowercased, a +tag is
+// dropped and, for Gmail, so are the dots in the local part
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+
+	if i := strings.IndexByte(local, '+'); i >= 0 {
+		local = local[:i]
+	}
+
+	if dotlessDomains[domain] {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
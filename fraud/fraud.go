@@ -0,0 +1,166 @@
+// Package fraud decides whether a referred signup may count towards its referrer's bonuses,
+// see app.SignupCheck for what's recorded about each signup
+package fraud
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	DefaultWindow               = 24 * time.Hour
+	DefaultMaxSignupsPerIP      = 5
+	DefaultMaxSignupsPerDevice  = 2
+	DefaultBurstWindow          = time.Hour
+	DefaultMaxReferralsPerBurst = 5
+)
+
+// DeviceFingerprintHeader carries the fingerprint clients compute for the device they run on
+const DeviceFingerprintHeader = "X-Device-Fingerprint"
+
+// reasons a referral is flagged for
+const (
+	// SelfReferral blocks a referee who shares an email or a device with their referrer
+	SelfReferral = "self_referral"
+	// DuplicateEmail holds a referee whose email is an alias of another user's
+	DuplicateEmail = "duplicate_email"
+	// RepeatedIP holds a referee whose IP address signed up too often
+	RepeatedIP = "repeated_ip"
+	// RepeatedDevice holds a referee whose device signed up too often
+	RepeatedDevice = "repeated_device"
+	// SignupBurst holds a referee who's one of too many signups with the same code in a short time
+	SignupBurst = "signup_burst"
+)
+
+// Checker runs the fraud checks configured by a config.FraudConfig
+type Checker struct {
+	signupCheckRepository app.SignupCheckRepository
+	window                time.Duration
+	maxSignupsPerIP       int64
+	maxSignupsPerDevice   int64
+	burstWindow           time.Duration
+	maxReferralsPerBurst  int64
+	trustForwardedFor     bool
+	trustedProxies        int
+}
+
+// NewChecker returns a Checker, defaults are used for the fields of cfg that aren't set
+func NewChecker(signupCheckRepository app.SignupCheckRepository, cfg *config.FraudConfig) *Checker {
+	c := &Checker{
+		signupCheckRepository: signupCheckRepository,
+		window:                DefaultWindow,
+		maxSignupsPerIP:       DefaultMaxSignupsPerIP,
+		maxSignupsPerDevice:   DefaultMaxSignupsPerDevice,
+		burstWindow:           DefaultBurstWindow,
+		maxReferralsPerBurst:  DefaultMaxReferralsPerBurst,
+		trustedProxies:        1,
+	}
+
+	if cfg != nil {
+		if cfg.Window > 0 {
+			c.window = cfg.Window
+		}
+		if cfg.MaxSignupsPerIP != 0 {
+			c.maxSignupsPerIP = cfg.MaxSignupsPerIP
+		}
+		if cfg.MaxSignupsPerDevice != 0 {
+			c.maxSignupsPerDevice = cfg.MaxSignupsPerDevice
+		}
+		if cfg.BurstWindow > 0 {
+			c.burstWindow = cfg.BurstWindow
+		}
+		if cfg.MaxReferralsPerBurst != 0 {
+			c.maxReferralsPerBurst = cfg.MaxReferralsPerBurst
+		}
+		c.trustForwardedFor = cfg.TrustForwardedFor
+		if cfg.TrustedProxies > 0 {
+			c.trustedProxies = cfg.TrustedProxies
+		}
+	}
+	return c
+}
+
+// ClientIP returns the IP address r was sent from
+func (c *Checker) ClientIP(r *http.Request) string {
+	if c.trustForwardedFor {
+		// every proxy appends the address it saw, entries left of the ones our proxies added are whatever
+		// the client sent and can't be trusted. The outermost of our proxies added the client's address.
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(header, ",")...)
+		}
+
+		if len(entries) > 0 {
+			i := len(entries) - c.trustedProxies
+			if i < 0 {
+				i = 0
+			}
+			return strings.TrimSpace(entries[i])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Check sets the Decision and Reasons of check, the signup of a user referred by referrer. It must
+// be called before check is saved, in the transaction saving it, and with the referrer's balance
+// locked so signups using the same code are counted one after the other.
+func (c *Checker) Check(ctx context.Context, check *app.SignupCheck, referrer *app.User) error {
+	check.Decision, check.Reasons = app.ReferralAllowed, []string{}
+
+	referrerCheck, err := c.signupCheckRepository.FindUserSignupCheck(ctx, referrer.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return errors.Wrap(err, "failed to find referrer signup check")
+	}
+
+	sameDevice := referrerCheck != nil && check.DeviceFingerprint != "" && referrerCheck.DeviceFingerprint == check.DeviceFingerprint
+	if check.NormalizedEmail == NormalizeEmail(referrer.Email) || sameDevice {
+		check.Decision, check.Reasons = app.ReferralBlocked, []string{SelfReferral}
+		return nil
+	}
+
+	matches, err := c.signupCheckRepository.CountSignupMatches(ctx, check, time.Now().Add(-c.window))
+	if err != nil {
+		return errors.Wrap(err, "failed to count matching signups")
+	}
+
+	if matches.SameEmail > 0 {
+		check.Reasons = append(check.Reasons, DuplicateEmail)
+	}
+
+	if c.maxSignupsPerIP > 0 && matches.SameIP >= c.maxSignupsPerIP {
+		check.Reasons = append(check.Reasons, RepeatedIP)
+	}
+
+	if c.maxSignupsPerDevice > 0 && matches.SameDevice >= c.maxSignupsPerDevice {
+		check.Reasons = append(check.Reasons, RepeatedDevice)
+	}
+
+	if c.maxReferralsPerBurst > 0 {
+		signups, err := c.signupCheckRepository.CountReferrerSignups(ctx, referrer.ID, time.Now().Add(-c.burstWindow))
+		if err != nil {
+			return errors.Wrap(err, "failed to count referrer signups")
+		}
+
+		if signups >= c.maxReferralsPerBurst {
+			check.Reasons = append(check.Reasons, SignupBurst)
+		}
+	}
+
+	if len(check.Reasons) > 0 {
+		check.Decision = app.ReferralHeld
+	}
+	return nil
+}
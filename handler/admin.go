@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeactivateUser suspends userID: they can't log in, send nor receive points until they're restored.
+// Their balance, referrals and bonuses are kept as they are.
+func (h *Handler) DeactivateUser(ctx context.Context, userID string, logger *log.Entry) (*app.User, error) {
+	ctx, span := tracing.Start(ctx, "Handler.DeactivateUser")
+	defer span.End()
+
+	return h.updateUserLifecycle(ctx, userID, logger, func(ctx context.Context, user *app.User, now time.Time) error {
+		if user.DeletedAt != nil {
+			return errors.ErrUserNotFound
+		}
+
+		if user.DeactivatedAt == nil {
+			user.DeactivatedAt = &now
+		}
+		return nil
+	})
+}
+
+// DeleteUser soft-deletes userID, they disappear from every lookup but can be restored. Their ledger account
+// and balance are kept so in-flight withdrawals still settle, and their unpaid referral and transaction
+// bonus stop counting towards their referrer's bonuses. Bonuses already paid aren't clawed back.
+func (h *Handler) DeleteUser(ctx context.Context, userID string, logger *log.Entry) (*app.User, error) {
+	ctx, span := tracing.Start(ctx, "Handler.DeleteUser")
+	defer span.End()
+
+	return h.updateUserLifecycle(ctx, userID, logger, func(ctx context.Context, user *app.User, now time.Time) error {
+		if user.DeletedAt != nil {
+			return nil
+		}
+
+		user.DeletedAt = &now
+		if err := h.userReferralRepository.DeleteUnpaidRefereeReferrals(ctx, user.ID, now); err != nil {
+			logger.WithError(err).Error("failed to delete unpaid referrals of user")
+			return errors.ErrGeneric
+		}
+		return nil
+	})
+}
+
+// RestoreUser undoes DeactivateUser and DeleteUser, the referral and bonus DeleteUser removed count again
+func (h *Handler) RestoreUser(ctx context.Context, userID string, logger *log.Entry) (*app.User, error) {
+	ctx, span := tracing.Start(ctx, "Handler.RestoreUser")
+	defer span.End()
+
+	return h.updateUserLifecycle(ctx, userID, logger, func(ctx context.Context, user *app.User, now time.Time) error {
+		if user.DeletedAt != nil {
+			if err := h.userReferralRepository.RestoreRefereeReferrals(ctx, user.ID, *user.DeletedAt); err != nil {
+				logger.WithError(err).Error("failed to restore referrals of user")
+				return errors.ErrGeneric
+			}
+		}
+
+		user.DeactivatedAt, user.DeletedAt = nil, nil
+		return nil
+	})
+}
+
+// updateUserLifecycle lets the authenticated admin apply fn to userID and saves the result. The user's
+// balance is locked first, so transfers and withdrawals they have in flight finish before it changes.
+func (h *Handler) updateUserLifecycle(ctx context.Context, userID string, logger *log.Entry, fn func(ctx context.Context, user *app.User, now time.Time) error) (*app.User, error) {
+	if err := h.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	logger = logger.WithField("user_id", userID)
+
+	var user *app.User
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		_, err := h.userPointRepository.LockUserPointsBalance(ctx, userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			logger.WithError(err).Error("failed to lock user points balance")
+			return errors.ErrGeneric
+		}
+
+		user, err = h.userRepository.FindUserByIDWithDeleted(ctx, userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.ErrUserNotFound
+			}
+			logger.WithError(err).Error("failed to find user")
+			return errors.ErrGeneric
+		}
+
+		// postgres keeps timestamps to the microsecond, RestoreUser matches rows on the exact DeletedAt
+		if err = fn(ctx, user, time.Now().Truncate(time.Microsecond)); err != nil {
+			return err
+		}
+
+		if err = h.userRepository.UpdateUserLifecycle(ctx, user); err != nil {
+			logger.WithError(err).Error("failed to update user")
+			return errors.ErrGeneric
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return user, nil
+}
+
+// authorizeAdmin makes sure the authenticated user is one of the configured admins
+func (h *Handler) authorizeAdmin(ctx context.Context) error {
+	callerID, ok := auth.UserID(ctx)
+	if !ok {
+		return errors.ErrUnauthenticated
+	}
+
+	if !h.admins[callerID] {
+		return errors.ErrForbidden
+	}
+	return nil
+}
+
+// findActiveUser is findUser that rejects users who were deactivated
+func (h *Handler) findActiveUser(ctx context.Context, userID string, logger *log.Entry) (*app.User, error) {
+	user, err := h.findUser(ctx, userID, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.Active() {
+		return nil, errors.ErrAccountInactive
+	}
+	return user, nil
+}
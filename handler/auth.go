@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Login checks the user's credentials and issues them a bearer token
+func (h *Handler) Login(ctx context.Context, input *LoginRequest, logger *log.Entry) (*LoginResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.Login")
+	defer span.End()
+
+	user, err := h.userRepository.FindUserByEmail(ctx, input.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrInvalidCredentials
+		}
+		logger.WithError(err).Error("failed to find user by email")
+		return nil, errors.ErrGeneric
+	}
+
+	if user.PasswordHash == "" {
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password))
+	if err != nil {
+		return nil, errors.ErrInvalidCredentials
+	}
+
+	if !user.Active() {
+		return nil, errors.ErrAccountInactive
+	}
+
+	token, expiresAt, err := h.tokenIssuer.Issue(user.ID)
+	if err != nil {
+		logger.WithError(err).Error("failed to issue token")
+		return nil, errors.ErrGeneric
+	}
+
+	return &LoginResponse{Token: token, ExpiresAt: expiresAt, User: user}, nil
+}
+
+// Authenticate returns the ID of the user token was issued to
+func (h *Handler) Authenticate(token string) (string, error) {
+	userID, err := h.tokenIssuer.Verify(token)
+	if err != nil {
+		return "", errors.ErrUnauthenticated
+	}
+	return userID, nil
+}
+
+// authorizeUser makes sure the authenticated user is userID, users can only read their own records
+func authorizeUser(ctx context.Context, userID string) error {
+	callerID, ok := auth.UserID(ctx)
+	if !ok {
+		return errors.ErrUnauthenticated
+	}
+
+	if callerID != userID {
+		return errors.ErrForbidden
+	}
+	return nil
+}
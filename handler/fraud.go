@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSignupChecksLimit is how many signup checks are listed when no limit is given
+	DefaultSignupChecksLimit = 50
+
+	// MaxSignupChecksLimit is the most signup checks listed at once
+	MaxSignupChecksLimit = 200
+)
+
+// ClientIP returns the IP address r was sent from, as far as the fraud checks are concerned
+func (h *Handler) ClientIP(r *http.Request) string {
+	return h.fraudChecker.ClientIP(r)
+}
+
+// ListSignupChecks returns the most recent signup checks that made decision, held ones when it's empty
+func (h *Handler) ListSignupChecks(ctx context.Context, decision string, limit int, logger *log.Entry) ([]*app.SignupCheck, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ListSignupChecks")
+	defer span.End()
+
+	if err := h.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if decision == "" {
+		decision = string(app.ReferralHeld)
+	}
+
+	switch app.ReferralDecision(decision) {
+	case app.ReferralAllowed, app.ReferralHeld, app.ReferralBlocked:
+	default:
+		return nil, errors.ErrInvalidDecision
+	}
+
+	if limit <= 0 {
+		limit = DefaultSignupChecksLimit
+	}
+
+	if limit > MaxSignupChecksLimit {
+		limit = MaxSignupChecksLimit
+	}
+
+	checks, err := h.signupCheckRepository.ListSignupChecks(ctx, app.ReferralDecision(decision), limit)
+	if err != nil {
+		logger.WithError(err).Error("failed to list signup checks")
+		return nil, errors.ErrGeneric
+	}
+	return checks, nil
+}
+
+// ReleaseHeldReferral lets the held referral of signup check id count towards its referrer's bonuses,
+// the signup and transaction bonuses are paid straight away if the referral completes a batch
+func (h *Handler) ReleaseHeldReferral(ctx context.Context, id string, logger *log.Entry) (*app.SignupCheck, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ReleaseHeldReferral")
+	defer span.End()
+
+	return h.reviewHeldReferral(ctx, id, app.ReferralAllowed, logger, func(ctx context.Context, check *app.SignupCheck, now time.Time) error {
+		if err := h.userReferralRepository.ReleaseHeldReferral(ctx, check.UserID); err != nil {
+			logger.WithError(err).Error("failed to release held referral")
+			return errors.ErrGeneric
+		}
+
+		// a referrer who has been deactivated or deleted since is paid with their next completed batch
+		referrer, err := h.userRepository.FindUserByID(ctx, *check.ReferrerID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil
+			}
+			logger.WithError(err).Error("failed to find referrer")
+			return errors.ErrGeneric
+		}
+
+		if !referrer.Active() {
+			return nil
+		}
+
+		if err = h.paySignupReward(ctx, referrer.ID, check.UserID, logger); err != nil {
+			return err
+		}
+
+		// a referee who passed the transfer threshold while held has a bonus waiting for the release
+		return h.payTransferReward(ctx, referrer.ID, logger)
+	})
+}
+
+// RejectHeldReferral drops the held referral of signup check id, the referee stays registered
+func (h *Handler) RejectHeldReferral(ctx context.Context, id string, logger *log.Entry) (*app.SignupCheck, error) {
+	ctx, span := tracing.Start(ctx, "Handler.RejectHeldReferral")
+	defer span.End()
+
+	return h.reviewHeldReferral(ctx, id, app.ReferralBlocked, logger, func(ctx context.Context, check *app.SignupCheck, now time.Time) error {
+		if err := h.userReferralRepository.DeleteUnpaidRefereeReferrals(ctx, check.UserID, now); err != nil {
+			logger.WithError(err).Error("failed to delete held referral")
+			return errors.ErrGeneric
+		}
+		return nil
+	})
+}
+
+// reviewHeldReferral lets the authenticated admin settle the held signup check id with decision, fn applies
+// the decision to the referral. The referrer's balance is locked like it is when a referee registers.
+func (h *Handler) reviewHeldReferral(ctx context.Context, id string, decision app.ReferralDecision, logger *log.Entry, fn func(ctx context.Context, check *app.SignupCheck, now time.Time) error) (*app.SignupCheck, error) {
+	if err := h.authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	logger = logger.WithField("signup_check_id", id)
+
+	var check *app.SignupCheck
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		var err error
+		check, err = h.signupCheckRepository.FindSignupCheckByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.ErrSignupCheckNotFound
+			}
+			logger.WithError(err).Error("failed to find signup check")
+			return errors.ErrGeneric
+		}
+
+		if check.Decision != app.ReferralHeld || check.ReferrerID == nil {
+			return errors.ErrSignupCheckNotHeld
+		}
+
+		if _, err = h.userPointRepository.LockUserPointsBalance(ctx, *check.ReferrerID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			logger.WithError(err).Error("failed to lock referrer points balance")
+			return errors.ErrGeneric
+		}
+
+		// checked again now the lock is held, another admin may have just reviewed it
+		check, err = h.signupCheckRepository.FindSignupCheckByID(ctx, id)
+		if err != nil {
+			logger.WithError(err).Error("failed to find signup check")
+			return errors.ErrGeneric
+		}
+
+		if check.Decision != app.ReferralHeld {
+			return errors.ErrSignupCheckNotHeld
+		}
+
+		now := time.Now().Truncate(time.Microsecond)
+		if err = fn(ctx, check, now); err != nil {
+			return err
+		}
+
+		check.Decision, check.ReviewedAt = decision, &now
+		if err = h.signupCheckRepository.UpdateSignupCheckDecision(ctx, check); err != nil {
+			logger.WithError(err).Error("failed to update signup check")
+			return errors.ErrGeneric
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return check, nil
+}
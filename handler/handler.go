@@ -4,109 +4,399 @@ import (
 	"context"
 	"crypto/rand"
 	"io"
+	"regexp"
+	"strings"
+	"time"
 
 	app "github.com/danvixent/aboki-africa-assessment"
-	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/config"
 	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
+	"github.com/danvixent/aboki-africa-assessment/idempotency"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
 	"github.com/jackc/pgx/v4"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Handler struct {
-	userRepository         app.UserRepository
-	userReferralRepository app.UserReferralRepository
-	userPointRepository    app.UserPointRepository
-	beginTxFunc            func() (pgx.Tx, error)
+	userRepository                app.UserRepository
+	userReferralRepository        app.UserReferralRepository
+	userPointRepository           app.UserPointRepository
+	ledgerRepository              app.LedgerRepository
+	idempotencyRepository         app.IdempotencyRepository
+	topupRepository               app.TopupRepository
+	webhookEventRepository        app.WebhookEventRepository
+	bankRecipientRepository       app.BankRecipientRepository
+	withdrawalRepository          app.WithdrawalRepository
+	outboxRepository              app.OutboxRepository
+	webhookSubscriptionRepository app.WebhookSubscriptionRepository
+	webhookDeliveryRepository     app.WebhookDeliveryRepository
+	signupCheckRepository         app.SignupCheckRepository
+	leaderboardRepository         app.LeaderboardRepository
+	referralProgram               *referral.Program
+	fraudChecker                  *fraud.Checker
+	tokenIssuer                   *auth.TokenIssuer
+	paystackClient                *paystack.Client
+	pointPrice                    int64 // kobo charged for each point bought
+	withdrawals                   config.WithdrawalConfig
+	allowPrivateWebhooks          bool            // let subscriptions point at loopback and private addresses
+	idempotencyLease              time.Duration   // how long a request may hold its Idempotency-Key
+	admins                        map[string]bool // IDs of the users allowed to call admin endpoints
+	runInTx                       app.TxRunner
 }
 
-func NewHandler(userRepository app.UserRepository, userReferralRepository app.UserReferralRepository, userPointRepository app.UserPointRepository, beginTxFunc func() (pgx.Tx, error)) *Handler {
+const (
+	// DefaultPointPrice is the kobo charged for each point bought when NewHandler is given no price
+	DefaultPointPrice int64 = 100
+
+	// DefaultWithdrawalPointRate is the kobo paid out for each point withdrawn when NewHandler is given no rate
+	DefaultWithdrawalPointRate int64 = 100
+)
+
+// Dependencies are the repositories and services the handler is built on
+type Dependencies struct {
+	UserRepository                app.UserRepository
+	UserReferralRepository        app.UserReferralRepository
+	UserPointRepository           app.UserPointRepository
+	LedgerRepository              app.LedgerRepository
+	IdempotencyRepository         app.IdempotencyRepository
+	TopupRepository               app.TopupRepository
+	WebhookEventRepository        app.WebhookEventRepository
+	BankRecipientRepository       app.BankRecipientRepository
+	WithdrawalRepository          app.WithdrawalRepository
+	OutboxRepository              app.OutboxRepository
+	WebhookSubscriptionRepository app.WebhookSubscriptionRepository
+	WebhookDeliveryRepository     app.WebhookDeliveryRepository
+	SignupCheckRepository         app.SignupCheckRepository
+	LeaderboardRepository         app.LeaderboardRepository
+	ReferralProgram               *referral.Program
+	FraudChecker                  *fraud.Checker
+	TokenIssuer                   *auth.TokenIssuer
+	PaystackClient                *paystack.Client
+	RunInTx                       app.TxRunner
+}
+
+// Options tune the handler, the defaults are used for what's left unset
+type Options struct {
+	PointPrice   int64 // kobo charged for each point bought, DefaultPointPrice when it isn't positive
+	Withdrawals  *config.WithdrawalConfig
+	Webhooks     *config.WebhookConfig
+	Idempotency  *config.IdempotencyConfig
+	AdminUserIDs []string // IDs of the users allowed to call admin endpoints
+}
+
+func NewHandler(deps Dependencies, opts Options) *Handler {
+	pointPrice := opts.PointPrice
+	if pointPrice <= 0 {
+		pointPrice = DefaultPointPrice
+	}
+
+	withdrawals := opts.Withdrawals
+	if withdrawals == nil {
+		withdrawals = &config.WithdrawalConfig{}
+	}
+
+	if withdrawals.PointRate <= 0 {
+		w := *withdrawals
+		w.PointRate = DefaultWithdrawalPointRate
+		withdrawals = &w
+	}
+
+	admins := map[string]bool{}
+	for _, id := range opts.AdminUserIDs {
+		admins[id] = true
+	}
+
 	return &Handler{
-		userRepository:         userRepository,
-		userReferralRepository: userReferralRepository,
-		userPointRepository:    userPointRepository,
-		beginTxFunc:            beginTxFunc,
+		userRepository:                deps.UserRepository,
+		userReferralRepository:        deps.UserReferralRepository,
+		userPointRepository:           deps.UserPointRepository,
+		ledgerRepository:              deps.LedgerRepository,
+		idempotencyRepository:         deps.IdempotencyRepository,
+		topupRepository:               deps.TopupRepository,
+		webhookEventRepository:        deps.WebhookEventRepository,
+		bankRecipientRepository:       deps.BankRecipientRepository,
+		withdrawalRepository:          deps.WithdrawalRepository,
+		outboxRepository:              deps.OutboxRepository,
+		webhookSubscriptionRepository: deps.WebhookSubscriptionRepository,
+		webhookDeliveryRepository:     deps.WebhookDeliveryRepository,
+		signupCheckRepository:         deps.SignupCheckRepository,
+		leaderboardRepository:         deps.LeaderboardRepository,
+		referralProgram:               deps.ReferralProgram,
+		fraudChecker:                  deps.FraudChecker,
+		tokenIssuer:                   deps.TokenIssuer,
+		paystackClient:                deps.PaystackClient,
+		pointPrice:                    pointPrice,
+		withdrawals:                   *withdrawals,
+		allowPrivateWebhooks:          opts.Webhooks != nil && opts.Webhooks.AllowPrivateAddresses,
+		idempotencyLease:              idempotency.Lease(opts.Idempotency),
+		admins:                        admins,
+		runInTx:                       trackCommits(deps.RunInTx),
 	}
 }
 
 func (h *Handler) RegisterUser(ctx context.Context, input *UserRequest, logger *log.Entry) (*app.User, error) {
-	tx, err := h.beginTxFunc()
+	ctx, span := tracing.Start(ctx, "Handler.RegisterUser")
+	defer span.End()
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		logger.WithError(err).Error("failed to start transaction")
+		logger.WithError(err).Error("failed to hash password")
 		return nil, errors.ErrGeneric
 	}
-	defer tx.Rollback(ctx)
-
-	ctx = context.WithValue(ctx, app.TxContextKey, tx)
 
 	user := &app.User{
 		Name:         input.Name,
 		Email:        input.Email,
-		ReferralCode: GenReferralCode(6),
+		PasswordHash: string(passwordHash),
 	}
 
-	err = h.userRepository.CreateUser(ctx, user)
-	if err != nil {
-		logger.WithError(err).Error("failed to create user")
-		return nil, errors.ErrCreateUserFailed
-	}
+	err = h.runInTx(ctx, func(ctx context.Context) error {
+		err := h.createUser(ctx, user)
+		if err != nil {
+			if errors.Is(err, errors.ErrEmailTaken) {
+				return errors.ErrEmailTaken
+			}
+			logger.WithError(err).Error("failed to create user")
+			return errors.ErrCreateUserFailed
+		}
 
-	userPoint := &app.UserPoints{
-		UserID: user.ID,
-		Points: 0,
-	}
+		userPoint := &app.UserPoints{
+			UserID: user.ID,
+			Points: 0,
+		}
 
-	err = h.userPointRepository.CreateUserPoint(ctx, userPoint)
-	if err != nil {
-		logger.WithError(err).Error("failed to create user point balance")
-		return nil, errors.ErrGeneric
-	}
+		err = h.userPointRepository.CreateUserPoint(ctx, userPoint)
+		if err != nil {
+			logger.WithError(err).Error("failed to create user point balance")
+			return errors.ErrGeneric
+		}
+
+		check := &app.SignupCheck{
+			UserID:            user.ID,
+			NormalizedEmail:   fraud.NormalizeEmail(user.Email),
+			IPAddress:         input.IPAddress,
+			DeviceFingerprint: input.DeviceFingerprint,
+			Decision:          app.ReferralAllowed,
+		}
+
+		registered := &app.UserRegisteredPayload{UserID: user.ID, Name: user.Name, Email: user.Email}
+		if input.ReferralCode == nil {
+			if err = h.createSignupCheck(ctx, check, logger); err != nil {
+				return err
+			}
+			return h.recordUserRegistered(ctx, registered, logger)
+		}
 
-	if input.ReferralCode != nil {
 		referrer, err := h.userRepository.FindUserByReferralCode(ctx, *input.ReferralCode)
 		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.ErrUnknownReferralCode
+			}
 			logger.WithError(err).Error("failed to find user by referral code")
-			return nil, errors.ErrGeneric
+			return errors.ErrGeneric
+		}
+
+		if !referrer.Active() {
+			return errors.ErrUnknownReferralCode
+		}
+
+		// lock the referrer's balance so referees registering concurrently can't both be counted
+		// towards the same signup bonus, nor slip past the fraud checks together
+		if _, err = h.userPointRepository.LockUserPointsBalance(ctx, referrer.ID); err != nil {
+			logger.WithError(err).Error("failed to lock referrer points balance")
+			return errors.ErrGeneric
+		}
+
+		check.ReferrerID = &referrer.ID
+		if err = h.fraudChecker.Check(ctx, check, referrer); err != nil {
+			logger.WithError(err).Error("failed to run referral fraud checks")
+			return errors.ErrGeneric
+		}
+
+		if err = h.createSignupCheck(ctx, check, logger); err != nil {
+			return err
+		}
+
+		// a blocked referral is dropped, the referee is still registered but was referred by nobody
+		if check.Decision == app.ReferralBlocked {
+			logger.WithField("reasons", check.Reasons).Warn("blocked referral")
+			return h.recordUserRegistered(ctx, registered, logger)
 		}
 
 		userReferral := &app.UserReferral{
 			ReferrerID: referrer.ID,
 			RefereeID:  user.ID,
 			PaidOut:    false,
+			Held:       check.Decision == app.ReferralHeld,
 		}
 
 		err = h.userReferralRepository.CreateUserReferral(ctx, userReferral)
 		if err != nil {
 			logger.WithError(err).Error("failed to save user referral")
-			return nil, errors.ErrGeneric
+			return errors.ErrGeneric
+		}
+
+		registered.ReferrerID = &referrer.ID
+		if err = h.recordUserRegistered(ctx, registered, logger); err != nil {
+			return err
+		}
+
+		if userReferral.Held {
+			logger.WithField("reasons", check.Reasons).Warn("held referral for review")
+			return nil
 		}
 
-		unpaidCount, err := h.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+		return h.paySignupReward(ctx, referrer.ID, user.ID, logger)
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return user, nil
+}
+
+// payTransferReward pays referrerID for every full batch of their unpaid referred user transaction bonuses,
+// bonuses of held referrals wait for them to be released. It must be called in a transaction holding the lock on the referrer's balance
+func (h *Handler) payTransferReward(ctx context.Context, referrerID string, logger *log.Entry) error {
+	// every pending bonus is fetched, a backlog left while the referrer was inactive or referrals were held is paid out at once
+	bonuses, err := h.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrerID, 0)
+	if err != nil {
+		logger.WithError(err).Error("failed to get unpaid referred user transaction bonuses")
+		return errors.ErrGeneric
+	}
+
+	if reward, paid := h.referralProgram.TransferReward(int64(len(bonuses))); reward > 0 {
+		bonuses = bonuses[:paid]
+		bonusIDs := make([]string, len(bonuses))
+		refereeIDs := make([]string, len(bonuses))
+		for i, b := range bonuses {
+			bonusIDs[i] = b.ID
+			refereeIDs[i] = b.RefereeID
+		}
+
+		err = h.userReferralRepository.PayReferralsTransactionsBonuses(ctx, bonusIDs)
 		if err != nil {
-			logger.WithError(err).Error("failed to get unpaid user referral count")
-			return nil, errors.ErrGeneric
+			logger.WithError(err).Error("failed to pay referrals transactions bonuses")
+			return errors.ErrGeneric
 		}
 
-		if unpaidCount == 3 {
-			err = h.userPointRepository.CreditUser(ctx, referrer.ID, 50)
-			if err != nil {
-				logger.WithError(err).Error("failed credit user referrer")
-				return nil, errors.ErrGeneric
-			}
+		err = h.payFromSystemAccount(ctx, app.ReferralBonusExpenseAccount, referrerID, reward, app.ReferredUserTransactionBonusEntry, strings.Join(bonusIDs, ","), "referred user transaction bonus")
+		if err != nil {
+			logger.WithError(err).Error("failed to credit referrer with referred user transaction bonuses")
+			return errors.ErrCreditUserFailed
+		}
 
-			err = h.userReferralRepository.MarkPendingReferralsAsPaid(ctx, referrer.ID)
-			if err != nil {
-				logger.WithError(err).Error("failed to mark pending referrals as paid")
-				return nil, errors.ErrGeneric
-			}
+		err = h.recordEvent(ctx, app.ReferralBonusPaidEvent, referrerID, &app.ReferralBonusPaidPayload{
+			ReferrerID: referrerID,
+			Kind:       app.ReferredUserTransactionBonusEntry,
+			Points:     reward,
+			RefereeIDs: refereeIDs,
+		})
+		if err != nil {
+			logger.WithError(err).Error("failed to record referral bonus event")
+			return errors.ErrGeneric
 		}
+
+		return h.payUplineBonuses(ctx, referrerID, reward, strings.Join(bonusIDs, ","), logger)
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		logger.WithError(err).Error("failed to commit transaction")
-		return nil, errors.ErrGeneric
+	return nil
+}
+
+// paySignupReward pays referrerID the signup reward if refereeID completed a batch of unpaid referrals,
+// it must be called in a transaction holding the lock on the referrer's balance
+func (h *Handler) paySignupReward(ctx context.Context, referrerID string, refereeID string, logger *log.Entry) error {
+	unpaidCount, err := h.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrerID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get unpaid user referral count")
+		return errors.ErrGeneric
 	}
 
-	return user, nil
+	if reward, referrals := h.referralProgram.SignupReward(unpaidCount); reward > 0 {
+		err = h.payFromSystemAccount(ctx, app.ReferralBonusExpenseAccount, referrerID, reward, app.ReferralBonusEntry, refereeID, "referral bonus")
+		if err != nil {
+			logger.WithError(err).Error("failed credit user referrer")
+			return errors.ErrGeneric
+		}
+
+		refereeIDs, err := h.userReferralRepository.MarkPendingReferralsAsPaid(ctx, referrerID, referrals)
+		if err != nil {
+			logger.WithError(err).Error("failed to mark pending referrals as paid")
+			return errors.ErrGeneric
+		}
+
+		err = h.recordEvent(ctx, app.ReferralBonusPaidEvent, referrerID, &app.ReferralBonusPaidPayload{
+			ReferrerID: referrerID,
+			Kind:       app.ReferralBonusEntry,
+			Points:     reward,
+			RefereeIDs: refereeIDs,
+		})
+		if err != nil {
+			logger.WithError(err).Error("failed to record referral bonus event")
+			return errors.ErrGeneric
+		}
+
+		return h.payUplineBonuses(ctx, referrerID, reward, refereeID, logger)
+	}
+	return nil
+}
+
+func (h *Handler) createSignupCheck(ctx context.Context, check *app.SignupCheck, logger *log.Entry) error {
+	if err := h.signupCheckRepository.CreateSignupCheck(ctx, check); err != nil {
+		logger.WithError(err).Error("failed to save signup check")
+		return errors.ErrGeneric
+	}
+	return nil
+}
+
+func (h *Handler) recordUserRegistered(ctx context.Context, payload *app.UserRegisteredPayload, logger *log.Entry) error {
+	if err := h.recordEvent(ctx, app.UserRegisteredEvent, payload.UserID, payload); err != nil {
+		logger.WithError(err).Error("failed to record user registered event")
+		return errors.ErrGeneric
+	}
+	return nil
+}
+
+// txError returns err if it's safe to show to clients, anything else, like a failed commit,
+// is logged and reported as errors.ErrGeneric
+func txError(err error, logger *log.Entry) error {
+	var e *errors.Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	logger.WithError(err).Error("transaction failed")
+	return errors.ErrGeneric
+}
+
+// idPattern matches the UUIDs the database gives every record
+var idPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// isID reports whether id can be the ID of a record, postgres fails to cast anything else to a uuid
+// instead of finding nothing
+func isID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// referralCodeAttempts is how many referral codes are tried for a new user before giving up
+const referralCodeAttempts = 5
+
+// createUser saves user with a newly generated referral code, a code that's already taken is replaced
+func (h *Handler) createUser(ctx context.Context, user *app.User) error {
+	var err error
+	for attempt := 0; attempt < referralCodeAttempts; attempt++ {
+		user.ReferralCode = GenReferralCode(6)
+		err = h.userRepository.CreateUser(ctx, user)
+		if !errors.Is(err, errors.ErrDuplicateReferralCode) {
+			return err
+		}
+	}
+	return err
 }
 
 // GenReferralCode helps to generate reference code.
@@ -123,42 +413,76 @@ func GenReferralCode(max int) string {
 	return string(b)
 }
 
+// TransferPoints moves points from the authenticated user to input.RecipientUserID
 func (h *Handler) TransferPoints(ctx context.Context, input *TransferPointsRequest, logger *log.Entry) error {
-	tx, err := h.beginTxFunc()
+	ctx, span := tracing.Start(ctx, "Handler.TransferPoints")
+	defer span.End()
+
+	senderID, ok := auth.UserID(ctx)
+	if !ok {
+		return errors.ErrUnauthenticated
+	}
+
+	if input.Points <= 0 {
+		return errors.ErrNonPositiveTransferAmount
+	}
+
+	if input.RecipientUserID == senderID {
+		return errors.ErrSelfTransfer
+	}
+
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		return h.transferPoints(ctx, senderID, input, logger)
+	})
+	if err != nil {
+		return txError(err, logger)
+	}
+
+	return nil
+}
+
+func (h *Handler) transferPoints(ctx context.Context, senderID string, input *TransferPointsRequest, logger *log.Entry) error {
+	recipient, err := h.userRepository.FindUserByID(ctx, input.RecipientUserID)
 	if err != nil {
-		logger.WithError(err).Error("failed to start transaction")
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.ErrRecipientNotFound
+		}
+		logger.WithError(err).Error("failed to find recipient")
 		return errors.ErrGeneric
 	}
-	defer tx.Rollback(ctx)
 
-	ctx = context.WithValue(ctx, app.TxContextKey, tx)
+	if !recipient.Active() {
+		return errors.ErrRecipientInactive
+	}
 
-	balance, err := h.userPointRepository.GetUserPointsBalance(ctx, input.UserID)
+	// the sender's balance stays locked until the transaction ends, so concurrent transfers
+	// from the same sender can't both pass the balance and referral threshold checks
+	balance, err := h.userPointRepository.LockUserPointsBalance(ctx, senderID)
 	if err != nil {
 		logger.WithError(err).Error("failed to get user points balance")
 		return errors.ErrGeneric
 	}
 
+	// checked after the lock, an admin deactivating the sender waits for it too
+	if _, err = h.findActiveUser(ctx, senderID, logger); err != nil {
+		return err
+	}
+
 	if balance < input.Points {
 		return errors.ErrInsufficientFunds
 	}
 
 	// we get the total before recording the transaction so we can determine if the total transferred points
-	// was previously less than 200
-	totalTransferredPoints, err := h.userPointRepository.GetUserTotalTransferredPoints(ctx, input.UserID)
+	// was previously below the referral program's threshold
+	totalTransferredPoints, err := h.userPointRepository.GetUserTotalTransferredPoints(ctx, senderID)
 	if err != nil {
 		logger.WithError(err).Error("failed to get user total transferred points")
 		return errors.ErrGeneric
 	}
 
-	err = h.userPointRepository.TransferPoints(ctx, input.UserID, input.RecipientUserID, input.Points)
-	if err != nil {
-		return errors.Wrap(err, "transfer points failed")
-	}
-
 	// record the point transfer
 	txn := &app.Transaction{
-		UserID:          input.UserID,
+		UserID:          senderID,
 		RecipientUserID: input.RecipientUserID,
 		Points:          input.Points,
 	}
@@ -168,61 +492,61 @@ func (h *Handler) TransferPoints(ctx context.Context, input *TransferPointsReque
 		return errors.ErrCreditUserFailed
 	}
 
-	// if it was previously less than 200 and now it's greater than 200, credit the referrer who
-	// referred this user with 50 points.
-	if totalTransferredPoints <= 200 && totalTransferredPoints+input.Points > 200 {
-		referrer, err := h.userReferralRepository.GetUserReferrer(ctx, input.UserID)
-		if err != nil {
-			// if it's pgx.ErrNoRows, it means this user wasn't referred by anyone
-			if errors.Is(err, pgx.ErrNoRows) {
-				return nil
-			}
-			logger.WithError(err).Error("failed to find user referrer")
-			return errors.ErrGeneric
-		}
+	err = h.transferBetweenUsers(ctx, senderID, input.RecipientUserID, input.Points, txn.ID)
+	if err != nil {
+		return errors.Wrap(err, "transfer points failed")
+	}
 
-		bonus := &app.ReferredUserTransactionBonus{
-			ReferrerID: referrer.ID,
-			RefereeID:  input.UserID,
-			PaidOut:    false,
-		}
+	err = h.recordEvent(ctx, app.PointsTransferredEvent, txn.ID, &app.PointsTransferredPayload{
+		TransactionID:   txn.ID,
+		UserID:          senderID,
+		RecipientUserID: input.RecipientUserID,
+		Points:          input.Points,
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to record points transferred event")
+		return errors.ErrGeneric
+	}
 
-		err = h.userReferralRepository.CreateReferredUserTransactionBonus(ctx, bonus)
-		if err != nil && !postgres.IsDuplicateError(err) {
-			logger.WithError(err).Error("failed to create referred user transaction bonus")
-			return errors.ErrGeneric
-		}
+	// if this transfer took the user past the threshold, record a bonus for the referrer who
+	// referred this user, the referrer is paid once enough of their referees qualify.
+	if !h.referralProgram.QualifyingTransfer(totalTransferredPoints, totalTransferredPoints+input.Points) {
+		return nil
+	}
 
-		bonuses, err := h.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrer.ID)
-		if err != nil {
-			logger.WithError(err).Error("failed to get unpaid referred user transaction bonuses")
-			return errors.ErrGeneric
+	referrer, err := h.userReferralRepository.GetUserReferrer(ctx, senderID)
+	if err != nil {
+		// if it's pgx.ErrNoRows, it means this user wasn't referred by anyone
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
 		}
+		logger.WithError(err).Error("failed to find user referrer")
+		return errors.ErrGeneric
+	}
 
-		if len(bonuses) == 3 {
-			bonusIDs := make([]string, len(bonuses))
-			for i, b := range bonuses {
-				bonusIDs[i] = b.ID
-			}
-
-			err = h.userReferralRepository.PayReferralsTransactionsBonuses(ctx, bonusIDs)
-			if err != nil {
-				logger.WithError(err).Error("failed to pay referrals transactions bonuses")
-				return errors.ErrGeneric
-			}
+	// lock the referrer's balance so referees qualifying concurrently can't pay out the same batch twice
+	if _, err = h.userPointRepository.LockUserPointsBalance(ctx, referrer.ID); err != nil {
+		logger.WithError(err).Error("failed to lock referrer points balance")
+		return errors.ErrGeneric
+	}
 
-			err = h.userPointRepository.CreditUser(ctx, referrer.ID, 50)
-			if err != nil {
-				logger.WithError(err).Error("failed to credit referrer with referred user transaction bonuses")
-				return errors.ErrCreditUserFailed
-			}
-		}
+	bonus := &app.ReferredUserTransactionBonus{
+		ReferrerID: referrer.ID,
+		RefereeID:  senderID,
+		PaidOut:    false,
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		logger.WithError(err).Error("failed to commit transaction")
+	// a referee qualifies once, later transfers past the threshold find their bonus already there
+	err = h.userReferralRepository.CreateReferredUserTransactionBonus(ctx, bonus)
+	if err != nil && !errors.Is(err, errors.ErrDuplicate) {
+		logger.WithError(err).Error("failed to create referred user transaction bonus")
 		return errors.ErrGeneric
 	}
 
-	return nil
+	// a deactivated or deleted referrer keeps their bonus, it's paid with the first batch completed after they're restored
+	if !referrer.Active() {
+		return nil
+	}
+
+	return h.payTransferReward(ctx, referrer.ID, logger)
 }
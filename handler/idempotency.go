@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+type commitKey struct{}
+
+// commitTracker records whether a request got as far as committing a write
+type commitTracker struct {
+	reached bool
+}
+
+// TrackCommits returns a ctx the handler records the commits of a request in, MayHaveCommitted reports them
+func TrackCommits(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commitKey{}, &commitTracker{})
+}
+
+// MayHaveCommitted reports whether the request served with ctx reached the commit of a write. A request that
+// failed before it did changed nothing, one that failed after it might have and can't safely run again.
+func MayHaveCommitted(ctx context.Context) bool {
+	t, ok := ctx.Value(commitKey{}).(*commitTracker)
+	return !ok || t.reached
+}
+
+// committing marks the request served with ctx as reaching a commit, whether or not the commit goes through
+func committing(ctx context.Context) {
+	if t, ok := ctx.Value(commitKey{}).(*commitTracker); ok {
+		t.reached = true
+	}
+}
+
+// trackCommits returns a TxRunner marking the request as reaching a commit once fn succeeds
+func trackCommits(runInTx app.TxRunner) app.TxRunner {
+	return func(ctx context.Context, fn func(ctx context.Context) error) error {
+		return runInTx(ctx, func(ctx context.Context) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+
+			committing(ctx)
+			return nil
+		})
+	}
+}
+
+// BeginIdempotentRequest reserves key within scope for a request whose body hashes to requestHash.
+// When the key was already used for the same request, the stored key is returned and its response
+// should be replayed, a nil key means the request should be executed. A key still in progress past its
+// lease was left behind by a request that never finished, it's taken over and the request executed again.
+func (h *Handler) BeginIdempotentRequest(ctx context.Context, scope string, key string, requestHash string, logger *log.Entry) (*app.IdempotencyKey, error) {
+	ctx, span := tracing.Start(ctx, "Handler.BeginIdempotentRequest")
+	defer span.End()
+
+	err := h.idempotencyRepository.CreateIdempotencyKey(ctx, &app.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+	})
+	if err == nil {
+		return nil, nil
+	}
+
+	if !postgres.IsDuplicateError(err) {
+		logger.WithError(err).Error("failed to create idempotency key")
+		return nil, errors.ErrGeneric
+	}
+
+	existing, err := h.idempotencyRepository.FindIdempotencyKey(ctx, scope, key)
+	if err != nil {
+		logger.WithError(err).Error("failed to find idempotency key")
+		return nil, errors.ErrGeneric
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, errors.ErrIdempotencyKeyReused
+	}
+
+	if existing.Completed() {
+		return existing, nil
+	}
+
+	staleBefore := time.Now().Add(-h.idempotencyLease)
+	if existing.UpdatedAt.After(staleBefore) {
+		return nil, errors.ErrIdempotentRequestInProgress
+	}
+
+	taken, err := h.idempotencyRepository.TakeOverIdempotencyKey(ctx, scope, key, staleBefore)
+	if err != nil {
+		logger.WithError(err).Error("failed to take over idempotency key")
+		return nil, errors.ErrGeneric
+	}
+
+	// another retry got to it first, or the original request finished after all
+	if !taken {
+		return nil, errors.ErrIdempotentRequestInProgress
+	}
+
+	logger.WithField("held_since", existing.UpdatedAt).Warn("took over an idempotency key past its lease")
+	return nil, nil
+}
+
+// CompleteIdempotentRequest stores the response of the request made with key so it can be replayed
+func (h *Handler) CompleteIdempotentRequest(ctx context.Context, scope string, key string, status int, body []byte, logger *log.Entry) error {
+	ctx, span := tracing.Start(ctx, "Handler.CompleteIdempotentRequest")
+	defer span.End()
+
+	err := h.idempotencyRepository.SaveIdempotencyKeyResponse(ctx, scope, key, status, body)
+	if err != nil {
+		logger.WithError(err).Error("failed to save idempotency key response")
+		return errors.ErrGeneric
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey frees key so the request can be retried, it's used when the
+// original request failed before MayHaveCommitted
+func (h *Handler) ReleaseIdempotencyKey(ctx context.Context, scope string, key string, logger *log.Entry) error {
+	ctx, span := tracing.Start(ctx, "Handler.ReleaseIdempotencyKey")
+	defer span.End()
+
+	err := h.idempotencyRepository.DeleteIdempotencyKey(ctx, scope, key)
+	if err != nil {
+		logger.WithError(err).Error("failed to release idempotency key")
+		return errors.ErrGeneric
+	}
+	return nil
+}
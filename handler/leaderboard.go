@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLeaderboardLimit is how many leaderboard entries are returned when no limit is given
+	DefaultLeaderboardLimit = 50
+
+	// MaxLeaderboardLimit is the most leaderboard entries returned at once
+	MaxLeaderboardLimit = 200
+)
+
+// GetLeaderboard returns a page of the top referrers of period ranked by metric, the all-time
+// leaderboard by referrals when they aren't given
+func (h *Handler) GetLeaderboard(ctx context.Context, period, metric string, offset, limit int, logger *log.Entry) (*app.Leaderboard, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetLeaderboard")
+	defer span.End()
+
+	p := app.LeaderboardAllTime
+	if period != "" {
+		p = app.LeaderboardPeriod(period)
+	}
+
+	valid := false
+	for _, known := range app.LeaderboardPeriods {
+		valid = valid || p == known
+	}
+	if !valid {
+		return nil, errors.ErrInvalidLeaderboardPeriod
+	}
+
+	m := app.LeaderboardByReferrals
+	if metric != "" {
+		m = app.LeaderboardMetric(metric)
+	}
+
+	if m != app.LeaderboardByReferrals && m != app.LeaderboardByPoints {
+		return nil, errors.ErrInvalidLeaderboardMetric
+	}
+
+	if offset < 0 {
+		return nil, errors.ErrInvalidOffset
+	}
+
+	if limit <= 0 {
+		limit = DefaultLeaderboardLimit
+	}
+	if limit > MaxLeaderboardLimit {
+		limit = MaxLeaderboardLimit
+	}
+
+	board, err := h.leaderboardRepository.GetLeaderboard(ctx, p, m, offset, limit)
+	if err != nil {
+		logger.WithError(err).Error("failed to get leaderboard")
+		return nil, errors.ErrGeneric
+	}
+	return board, nil
+}
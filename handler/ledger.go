@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// payFromSystemAccount posts an entry moving points from the system account identified by code to userID
+func (h *Handler) payFromSystemAccount(ctx context.Context, code string, userID string, points int64, kind app.JournalEntryKind, reference, description string) error {
+	from, err := h.ledgerRepository.FindAccountByCode(ctx, code)
+	if err != nil {
+		return errors.Wrap(err, "failed to find system account "+code)
+	}
+
+	to, err := h.ledgerRepository.FindAccountByUserID(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to find user account")
+	}
+
+	entry := app.NewTransferEntry(kind, reference, description, from.ID, to.ID, points)
+	return h.ledgerRepository.PostJournalEntry(ctx, entry)
+}
+
+// transferBetweenUsers posts an entry moving points from senderID to recipientID
+func (h *Handler) transferBetweenUsers(ctx context.Context, senderID string, recipientID string, points int64, reference string) error {
+	from, err := h.ledgerRepository.FindAccountByUserID(ctx, senderID)
+	if err != nil {
+		return errors.Wrap(err, "failed to find sender account")
+	}
+
+	to, err := h.ledgerRepository.FindAccountByUserID(ctx, recipientID)
+	if err != nil {
+		return errors.Wrap(err, "failed to find recipient account")
+	}
+
+	entry := app.NewTransferEntry(app.PointTransferEntry, reference, "point transfer", from.ID, to.ID, points)
+	return h.ledgerRepository.PostJournalEntry(ctx, entry)
+}
+
+// payToSystemAccount posts an entry moving points from userID to the system account identified by code
+func (h *Handler) payToSystemAccount(ctx context.Context, userID string, code string, points int64, kind app.JournalEntryKind, reference, description string) error {
+	from, err := h.ledgerRepository.FindAccountByUserID(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "failed to find user account")
+	}
+
+	to, err := h.ledgerRepository.FindAccountByCode(ctx, code)
+	if err != nil {
+		return errors.Wrap(err, "failed to find system account "+code)
+	}
+
+	entry := app.NewTransferEntry(kind, reference, description, from.ID, to.ID, points)
+	return h.ledgerRepository.PostJournalEntry(ctx, entry)
+}
+
+// transferBetweenSystemAccounts posts an entry moving points between the system accounts identified by fromCode and toCode
+func (h *Handler) transferBetweenSystemAccounts(ctx context.Context, fromCode string, toCode string, points int64, kind app.JournalEntryKind, reference, description string) error {
+	from, err := h.ledgerRepository.FindAccountByCode(ctx, fromCode)
+	if err != nil {
+		return errors.Wrap(err, "failed to find system account "+fromCode)
+	}
+
+	to, err := h.ledgerRepository.FindAccountByCode(ctx, toCode)
+	if err != nil {
+		return errors.Wrap(err, "failed to find system account "+toCode)
+	}
+
+	entry := app.NewTransferEntry(kind, reference, description, from.ID, to.ID, points)
+	return h.ledgerRepository.PostJournalEntry(ctx, entry)
+}
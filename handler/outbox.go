@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// recordEvent saves an event to the outbox, it must be called in the transaction of the change
+// the event describes so one is never saved without the other
+func (h *Handler) recordEvent(ctx context.Context, eventType string, aggregateID string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode "+eventType+" payload")
+	}
+
+	err = h.outboxRepository.CreateOutboxEvent(ctx, &app.OutboxEvent{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     b,
+	})
+	return errors.Wrap(err, "failed to save "+eventType+" event")
+}
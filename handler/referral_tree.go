@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultReferralTreeDepth is how many levels of a referral tree are returned when no depth is given
+	DefaultReferralTreeDepth = 3
+
+	// MaxReferralTreeDepth is the most levels of a referral tree returned at once
+	MaxReferralTreeDepth = 10
+)
+
+// GetUserReferrals returns the users userID referred directly
+func (h *Handler) GetUserReferrals(ctx context.Context, userID string, logger *log.Entry) ([]*app.ReferralNode, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetUserReferrals")
+	defer span.End()
+
+	return h.getReferralTree(ctx, userID, 1, logger)
+}
+
+// GetUserReferralTree returns the users userID referred, each with the users they referred, down to depth levels
+func (h *Handler) GetUserReferralTree(ctx context.Context, userID string, depth int, logger *log.Entry) ([]*app.ReferralNode, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetUserReferralTree")
+	defer span.End()
+
+	if depth == 0 {
+		depth = DefaultReferralTreeDepth
+	}
+
+	if depth < 1 || depth > MaxReferralTreeDepth {
+		return nil, errors.ErrInvalidReferralTreeDepth
+	}
+
+	nodes, err := h.getReferralTree(ctx, userID, depth, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// nodes come ordered by depth, so every referrer is seen before the users they referred
+	tree := []*app.ReferralNode{}
+	byID := map[string]*app.ReferralNode{}
+	for _, node := range nodes {
+		byID[node.UserID] = node
+		if node.Depth == 1 {
+			tree = append(tree, node)
+			continue
+		}
+
+		if parent, ok := byID[node.ReferrerID]; ok {
+			parent.Referees = append(parent.Referees, node)
+		}
+	}
+	return tree, nil
+}
+
+func (h *Handler) getReferralTree(ctx context.Context, userID string, depth int, logger *log.Entry) ([]*app.ReferralNode, error) {
+	if err := authorizeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.findUser(ctx, userID, logger); err != nil {
+		return nil, err
+	}
+
+	nodes, err := h.userReferralRepository.GetReferralTree(ctx, userID, depth)
+	if err != nil {
+		logger.WithError(err).Error("failed to get referral tree")
+		return nil, errors.ErrGeneric
+	}
+	return nodes, nil
+}
+
+// payUplineBonuses pays the referral program's upline shares of reward, which referrerID just earned, to
+// the users above them. Deactivated and deleted users forfeit their share. It must be called in a transaction.
+func (h *Handler) payUplineBonuses(ctx context.Context, referrerID string, reward int64, reference string, logger *log.Entry) error {
+	if h.referralProgram.UplineDepth() == 0 {
+		return nil
+	}
+
+	upline, err := h.userReferralRepository.GetReferralUpline(ctx, referrerID, h.referralProgram.UplineDepth())
+	if err != nil {
+		logger.WithError(err).Error("failed to get referral upline")
+		return errors.ErrGeneric
+	}
+
+	rewards := h.referralProgram.UplineRewards(reward)
+	for i, user := range upline {
+		if rewards[i] == 0 || !user.Active() {
+			continue
+		}
+
+		err = h.payFromSystemAccount(ctx, app.ReferralBonusExpenseAccount, user.ID, rewards[i], app.ReferralUplineBonusEntry, reference, "referral upline bonus")
+		if err != nil {
+			logger.WithError(err).Error("failed to credit referral upline bonus")
+			return errors.ErrCreditUserFailed
+		}
+
+		err = h.recordEvent(ctx, app.ReferralBonusPaidEvent, user.ID, &app.ReferralBonusPaidPayload{
+			ReferrerID: user.ID,
+			Kind:       app.ReferralUplineBonusEntry,
+			Points:     rewards[i],
+			RefereeIDs: []string{referrerID},
+		})
+		if err != nil {
+			logger.WithError(err).Error("failed to record referral bonus event")
+			return errors.ErrGeneric
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetUserBalance returns the points userID can spend
+func (h *Handler) GetUserBalance(ctx context.Context, userID string, logger *log.Entry) (*BalanceResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetUserBalance")
+	defer span.End()
+
+	if err := authorizeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.findUser(ctx, userID, logger); err != nil {
+		return nil, err
+	}
+
+	balance, err := h.userPointRepository.GetUserPointsBalance(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get user points balance")
+		return nil, errors.ErrGeneric
+	}
+
+	return &BalanceResponse{UserID: userID, Points: balance}, nil
+}
+
+// GetUserSummary returns userID's balance along with their transfer and referral activity
+func (h *Handler) GetUserSummary(ctx context.Context, userID string, logger *log.Entry) (*SummaryResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetUserSummary")
+	defer span.End()
+
+	if err := authorizeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.findUser(ctx, userID, logger); err != nil {
+		return nil, err
+	}
+
+	summary := &SummaryResponse{UserID: userID}
+
+	var err error
+	summary.AvailablePoints, err = h.userPointRepository.GetUserPointsBalance(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get user points balance")
+		return nil, errors.ErrGeneric
+	}
+
+	summary.TotalTransferredPoints, err = h.userPointRepository.GetUserTotalTransferredPoints(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get user total transferred points")
+		return nil, errors.ErrGeneric
+	}
+
+	summary.LifetimeReferralEarnings, err = h.userPointRepository.GetUserReferralEarnings(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get user referral earnings")
+		return nil, errors.ErrGeneric
+	}
+
+	summary.LastActivityAt, err = h.userPointRepository.GetUserLastActivity(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get user last activity")
+		return nil, errors.ErrGeneric
+	}
+
+	pendingSignups, err := h.userReferralRepository.GetUnpaidUserReferralCount(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to get unpaid user referral count")
+		return nil, errors.ErrGeneric
+	}
+
+	pendingTransfers, err := h.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, userID, h.referralProgram.TransferBonusBatchSize())
+	if err != nil {
+		logger.WithError(err).Error("failed to get unpaid referred user transaction bonuses")
+		return nil, errors.ErrGeneric
+	}
+
+	summary.ReferralProgress = h.referralProgram.Progress(pendingSignups, int64(len(pendingTransfers)))
+	return summary, nil
+}
+
+// findUser returns errors.ErrUserNotFound if userID doesn't exist
+func (h *Handler) findUser(ctx context.Context, userID string, logger *log.Entry) (*app.User, error) {
+	user, err := h.userRepository.FindUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrUserNotFound
+		}
+		logger.WithError(err).Error("failed to find user")
+		return nil, errors.ErrGeneric
+	}
+	return user, nil
+}
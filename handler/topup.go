@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// InitializeTopup starts a purchase of input.Points for the authenticated user, the points are
+// credited by VerifyTopup once the user has paid on the returned authorization URL
+func (h *Handler) InitializeTopup(ctx context.Context, input *TopupRequest, logger *log.Entry) (*TopupResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.InitializeTopup")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	if input.Points <= 0 {
+		return nil, errors.ErrNonPositiveTopupAmount
+	}
+
+	if input.Points > math.MaxInt64/h.pointPrice {
+		return nil, errors.ErrTopupTooLarge
+	}
+
+	user, err := h.findActiveUser(ctx, userID, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	topup := &app.Topup{
+		UserID:    userID,
+		Reference: GenReferralCode(24),
+		Points:    input.Points,
+		Amount:    input.Points * h.pointPrice,
+		Status:    app.TopupPending,
+	}
+
+	// the topup is saved before calling Paystack so a payment can always be matched to it
+	committing(ctx)
+	if err = h.topupRepository.CreateTopup(ctx, topup); err != nil {
+		logger.WithError(err).Error("failed to create topup")
+		return nil, errors.ErrGeneric
+	}
+
+	resp, err := h.paystackClient.InitializeTransaction(ctx, &paystack.InitializeTransactionRequest{
+		Email:     user.Email,
+		Amount:    topup.Amount,
+		Reference: topup.Reference,
+		Metadata:  map[string]interface{}{"user_id": userID, "points": topup.Points},
+	})
+	if err != nil {
+		logger.WithError(err).WithField("reference", topup.Reference).Error("failed to initialize paystack transaction")
+
+		topup.Status = app.TopupFailed
+		if err = h.topupRepository.UpdateTopupStatus(ctx, topup); err != nil {
+			logger.WithError(err).Error("failed to mark topup as failed")
+		}
+		return nil, errors.ErrPaymentProviderFailed
+	}
+
+	return &TopupResponse{
+		Reference:        topup.Reference,
+		Status:           topup.Status,
+		Points:           topup.Points,
+		Amount:           topup.Amount,
+		AuthorizationURL: resp.AuthorizationURL,
+	}, nil
+}
+
+// VerifyTopup asks Paystack for the outcome of the authenticated user's topup identified by reference
+// and credits the points if it was paid. Verifying a topup that's no longer pending is a no-op.
+func (h *Handler) VerifyTopup(ctx context.Context, reference string, logger *log.Entry) (*TopupResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.VerifyTopup")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	topup, err := h.topupRepository.FindTopupByReference(ctx, reference)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrTopupNotFound
+		}
+		logger.WithError(err).Error("failed to find topup")
+		return nil, errors.ErrGeneric
+	}
+
+	// other users' topups are reported as missing so references can't be probed
+	if topup.UserID != userID {
+		return nil, errors.ErrTopupNotFound
+	}
+
+	if topup.Status == app.TopupPending {
+		txn, err := h.paystackClient.VerifyTransaction(ctx, reference)
+		if err != nil {
+			logger.WithError(err).WithField("reference", reference).Error("failed to verify paystack transaction")
+			return nil, errors.ErrPaymentProviderFailed
+		}
+
+		if topup, err = h.completeTopup(ctx, txn, logger); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TopupResponse{
+		Reference: topup.Reference,
+		Status:    topup.Status,
+		Points:    topup.Points,
+		Amount:    topup.Amount,
+	}, nil
+}
+
+// completeTopup settles the topup txn paid for in a new transaction
+func (h *Handler) completeTopup(ctx context.Context, txn *paystack.Transaction, logger *log.Entry) (*app.Topup, error) {
+	var topup *app.Topup
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		var err error
+		topup, err = h.settleTopup(ctx, txn, logger)
+		return err
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return topup, nil
+}
+
+// settleTopup applies txn to the pending topup it paid for: a successful payment of the full amount credits
+// the topup's points from app.PointSalesAccount, a failed one marks it failed, and anything else leaves it pending.
+// It must be called in a transaction.
+func (h *Handler) settleTopup(ctx context.Context, txn *paystack.Transaction, logger *log.Entry) (*app.Topup, error) {
+	topup, err := h.topupRepository.LockTopupByReference(ctx, txn.Reference)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrTopupNotFound
+		}
+		logger.WithError(err).Error("failed to lock topup")
+		return nil, errors.ErrGeneric
+	}
+
+	if topup.Status != app.TopupPending {
+		return topup, nil
+	}
+
+	switch txn.Status {
+	case paystack.StatusSuccess:
+		if txn.Amount != topup.Amount {
+			logger.WithFields(log.Fields{"reference": txn.Reference, "paid": txn.Amount, "expected": topup.Amount}).
+				Warn("topup paid with the wrong amount")
+			topup.Status = app.TopupFailed
+			break
+		}
+
+		topup.Status = app.TopupSuccess
+		topup.PaidAt = txn.PaidAt
+		if topup.PaidAt == nil {
+			now := time.Now()
+			topup.PaidAt = &now
+		}
+
+		err = h.payFromSystemAccount(ctx, app.PointSalesAccount, topup.UserID, topup.Points, app.PointPurchaseEntry, topup.ID, "point purchase")
+		if err != nil {
+			logger.WithError(err).Error("failed to credit user with purchased points")
+			return nil, errors.ErrCreditUserFailed
+		}
+	case paystack.StatusFailed, paystack.StatusReversed:
+		topup.Status = app.TopupFailed
+	default:
+		// the payment hasn't concluded yet, an abandoned payment can still be completed
+		return topup, nil
+	}
+
+	if err = h.topupRepository.UpdateTopupStatus(ctx, topup); err != nil {
+		logger.WithError(err).Error("failed to update topup status")
+		return nil, errors.ErrGeneric
+	}
+	return topup, nil
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// GetUserTransactions returns a page of the point movements on userID's account, newest first
+func (h *Handler) GetUserTransactions(ctx context.Context, userID string, input *TransactionHistoryRequest, logger *log.Entry) (*TransactionHistoryResponse, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetUserTransactions")
+	defer span.End()
+
+	if input.Direction != "" && input.Direction != app.SentDirection && input.Direction != app.ReceivedDirection {
+		return nil, errors.ErrInvalidDirection
+	}
+
+	filter := &app.TransactionHistoryFilter{
+		Direction: input.Direction,
+		From:      input.From,
+		To:        input.To,
+		Limit:     input.Limit,
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultHistoryLimit
+	}
+
+	if filter.Limit > maxHistoryLimit {
+		filter.Limit = maxHistoryLimit
+	}
+
+	if input.Cursor != "" {
+		before, id, err := decodeCursor(input.Cursor)
+		if err != nil {
+			return nil, errors.ErrInvalidCursor
+		}
+		filter.Before, filter.BeforeID = &before, id
+	}
+
+	if err := authorizeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if _, err := h.findUser(ctx, userID, logger); err != nil {
+		return nil, err
+	}
+
+	// fetch one extra item to know if there's a next page
+	limit := filter.Limit
+	filter.Limit++
+
+	items, err := h.userPointRepository.ListUserTransactions(ctx, userID, filter)
+	if err != nil {
+		logger.WithError(err).Error("failed to list user transactions")
+		return nil, errors.ErrGeneric
+	}
+
+	resp := &TransactionHistoryResponse{Data: items}
+	if len(items) > limit {
+		resp.Data = items[:limit]
+		last := resp.Data[limit-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	return resp, nil
+}
+
+// encodeCursor builds an opaque keyset cursor pointing at the item created at createdAt with the given id
+func encodeCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	parts := strings.SplitN(string(buf), "|", 2)
+	if len(parts) != 2 || !isID(parts[1]) {
+		return time.Time{}, "", errors.ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return createdAt, parts[1], nil
+}
@@ -1,13 +1,97 @@
 package handler
 
+import (
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+)
+
 type UserRequest struct {
 	Name         string  `json:"name"`
 	Email        string  `json:"email"`
+	Password     string  `json:"password"`
 	ReferralCode *string `json:"referral_code"`
+
+	// IPAddress and DeviceFingerprint identify where the signup came from, they're set from the request's headers
+	IPAddress         string `json:"-"`
+	DeviceFingerprint string `json:"-"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *app.User `json:"user"`
 }
 
+// TransferPointsRequest moves points from the authenticated user to RecipientUserID
 type TransferPointsRequest struct {
-	UserID          string `json:"user_id"`
 	RecipientUserID string `json:"recipient_user_id"`
 	Points          int64  `json:"points"`
 }
+
+type TransactionHistoryRequest struct {
+	Direction string     `json:"direction"`
+	From      *time.Time `json:"from"`
+	To        *time.Time `json:"to"`
+	Cursor    string     `json:"cursor"`
+	Limit     int        `json:"limit"`
+}
+
+type TransactionHistoryResponse struct {
+	Data       []*app.TransactionHistoryItem `json:"data"`
+	NextCursor string                        `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+type BalanceResponse struct {
+	UserID string `json:"user_id"`
+	Points int64  `json:"points"`
+}
+
+type SummaryResponse struct {
+	UserID                   string               `json:"user_id"`
+	AvailablePoints          int64                `json:"available_points"`
+	TotalTransferredPoints   int64                `json:"total_transferred_points"`
+	LifetimeReferralEarnings int64                `json:"lifetime_referral_earnings"`
+	ReferralProgress         []*referral.Progress `json:"referral_progress"`
+	LastActivityAt           *time.Time           `json:"last_activity_at"`
+}
+
+// TopupRequest buys Points for the authenticated user
+type TopupRequest struct {
+	Points int64 `json:"points"`
+}
+
+type TopupResponse struct {
+	Reference        string          `json:"reference"`
+	Status           app.TopupStatus `json:"status"`
+	Points           int64           `json:"points"`
+	Amount           int64           `json:"amount"`                      // in kobo
+	AuthorizationURL string          `json:"authorization_url,omitempty"` // where the user pays, only set when the topup is initialized
+}
+
+// BankRecipientRequest adds a bank account the authenticated user can withdraw to,
+// AccountName defaults to the user's name
+type BankRecipientRequest struct {
+	AccountNumber string `json:"account_number"`
+	BankCode      string `json:"bank_code"`
+	AccountName   string `json:"account_name"`
+}
+
+// WithdrawalRequest cashes Points out to the authenticated user's bank account BankRecipientID
+type WithdrawalRequest struct {
+	BankRecipientID string `json:"bank_recipient_id"`
+	Points          int64  `json:"points"`
+}
+
+// WebhookSubscriptionRequest subscribes the authenticated user to the events of the given types
+// they're a party to, Events defaults to every type
+type WebhookSubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+const paystackProvider = "paystack"
+
+// HandlePaystackEvent applies a webhook Paystack delivered, body must be the raw request body
+// signature was computed over. Each event is applied once, together with the record that it was
+// received, so a redelivered event is acknowledged without changing anything.
+func (h *Handler) HandlePaystackEvent(ctx context.Context, body []byte, signature string, logger *log.Entry) error {
+	ctx, span := tracing.Start(ctx, "Handler.HandlePaystackEvent")
+	defer span.End()
+
+	if !h.paystackClient.VerifySignature(body, signature) {
+		return errors.ErrInvalidWebhookSignature
+	}
+
+	event := &paystack.Event{}
+	if err := json.Unmarshal(body, event); err != nil {
+		return errors.ErrInvalidWebhookPayload
+	}
+
+	// Paystack events carry no ID of their own, the object they're about and the event type identify them
+	var object struct {
+		ID json.Number `json:"id"`
+	}
+	if err := json.Unmarshal(event.Data, &object); err != nil || object.ID == "" {
+		return errors.ErrInvalidWebhookPayload
+	}
+
+	logger = logger.WithFields(log.Fields{"event": event.Event, "object_id": object.ID})
+
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		err := h.webhookEventRepository.CreateWebhookEvent(ctx, &app.WebhookEvent{
+			Provider: paystackProvider,
+			EventID:  event.Event + ":" + object.ID.String(),
+			Event:    event.Event,
+			Payload:  body,
+		})
+		if err != nil {
+			if postgres.IsDuplicateError(err) {
+				logger.Info("ignoring webhook event that was already applied")
+				return nil
+			}
+			logger.WithError(err).Error("failed to save webhook event")
+			return errors.ErrGeneric
+		}
+
+		switch event.Event {
+		case paystack.ChargeSuccess:
+			txn := &paystack.Transaction{}
+			if err = json.Unmarshal(event.Data, txn); err != nil {
+				return errors.ErrInvalidWebhookPayload
+			}
+
+			_, err = h.settleTopup(ctx, txn, logger.WithField("reference", txn.Reference))
+			if errors.Is(err, errors.ErrTopupNotFound) {
+				// not a charge we initialized, there's nothing to credit
+				logger.WithField("reference", txn.Reference).Warn("charge doesn't match any topup")
+				return nil
+			}
+			return err
+		case paystack.TransferSuccess, paystack.TransferFailed, paystack.TransferReversed:
+			transfer := &paystack.Transfer{}
+			if err = json.Unmarshal(event.Data, transfer); err != nil {
+				return errors.ErrInvalidWebhookPayload
+			}
+
+			_, err = h.settleWithdrawal(ctx, transfer, logger.WithField("reference", transfer.Reference))
+			if errors.Is(err, errors.ErrWithdrawalNotFound) {
+				// not a transfer we initiated, there's no hold to settle
+				logger.WithField("reference", transfer.Reference).Warn("transfer doesn't match any withdrawal")
+				return nil
+			}
+			return err
+		default:
+			logger.Info("ignoring unhandled webhook event")
+			return nil
+		}
+	})
+	if err != nil {
+		return txError(err, logger)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/danvixent/aboki-africa-assessment/webhook"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultWebhookDeliveriesLimit is how many deliveries are listed when no limit is given
+	DefaultWebhookDeliveriesLimit = 50
+
+	// MaxWebhookDeliveriesLimit is the most deliveries listed at once
+	MaxWebhookDeliveriesLimit = 200
+)
+
+// CreateWebhookSubscription subscribes the authenticated user to webhooks, the returned subscription
+// holds the secret deliveries are signed with, it isn't shown again
+func (h *Handler) CreateWebhookSubscription(ctx context.Context, input *WebhookSubscriptionRequest, logger *log.Entry) (*app.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "Handler.CreateWebhookSubscription")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	u, err := url.Parse(input.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.ErrInvalidWebhookURL
+	}
+
+	// deliveries are checked again when they're sent, the host may be re-pointed after this
+	if !h.allowPrivateWebhooks {
+		if err = webhook.CheckURL(ctx, u); errors.Is(err, webhook.ErrPrivateAddress) {
+			return nil, errors.ErrPrivateWebhookURL
+		} else if err != nil {
+			logger.WithError(err).Info("failed to resolve webhook url")
+			return nil, errors.ErrUnresolvedWebhookURL
+		}
+	}
+
+	for _, e := range input.Events {
+		if !isEventType(e) {
+			return nil, errors.InvalidField("events", fmt.Sprintf("unknown event %q, events must be some of %s", e, strings.Join(app.EventTypes, ", ")))
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		logger.WithError(err).Error("failed to generate webhook secret")
+		return nil, errors.ErrGeneric
+	}
+
+	subscription := &app.WebhookSubscription{
+		UserID: userID,
+		URL:    u.String(),
+		Events: input.Events,
+		Secret: "whsec_" + hex.EncodeToString(secret),
+	}
+
+	if subscription.Events == nil {
+		subscription.Events = []string{}
+	}
+
+	if err = h.webhookSubscriptionRepository.CreateWebhookSubscription(ctx, subscription); err != nil {
+		logger.WithError(err).Error("failed to create webhook subscription")
+		return nil, errors.ErrGeneric
+	}
+	return subscription, nil
+}
+
+// ListWebhookSubscriptions returns the authenticated user's webhook subscriptions without their secrets
+func (h *Handler) ListWebhookSubscriptions(ctx context.Context, logger *log.Entry) ([]*app.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ListWebhookSubscriptions")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	subscriptions, err := h.webhookSubscriptionRepository.ListUserWebhookSubscriptions(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to list webhook subscriptions")
+		return nil, errors.ErrGeneric
+	}
+
+	for _, s := range subscriptions {
+		s.Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// DeleteWebhookSubscription stops deliveries to the authenticated user's subscription identified by id,
+// its delivery log is kept
+func (h *Handler) DeleteWebhookSubscription(ctx context.Context, id string, logger *log.Entry) error {
+	ctx, span := tracing.Start(ctx, "Handler.DeleteWebhookSubscription")
+	defer span.End()
+
+	if _, err := h.findWebhookSubscription(ctx, id, logger); err != nil {
+		return err
+	}
+
+	err := h.webhookSubscriptionRepository.DeleteWebhookSubscription(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.ErrWebhookSubscriptionNotFound
+		}
+		logger.WithError(err).Error("failed to delete webhook subscription")
+		return errors.ErrGeneric
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries to the authenticated user's subscription identified by id
+func (h *Handler) ListWebhookDeliveries(ctx context.Context, id string, limit int, logger *log.Entry) ([]*app.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ListWebhookDeliveries")
+	defer span.End()
+
+	if limit <= 0 {
+		limit = DefaultWebhookDeliveriesLimit
+	}
+
+	if limit > MaxWebhookDeliveriesLimit {
+		limit = MaxWebhookDeliveriesLimit
+	}
+
+	if _, err := h.findWebhookSubscription(ctx, id, logger); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := h.webhookDeliveryRepository.ListSubscriptionWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		logger.WithError(err).Error("failed to list webhook deliveries")
+		return nil, errors.ErrGeneric
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues a failed delivery to the authenticated user's subscription identified by
+// subscriptionID to be sent again, it gets as many attempts as a new delivery
+func (h *Handler) ReplayWebhookDelivery(ctx context.Context, subscriptionID string, deliveryID string, logger *log.Entry) (*app.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ReplayWebhookDelivery")
+	defer span.End()
+
+	if _, err := h.findWebhookSubscription(ctx, subscriptionID, logger); err != nil {
+		return nil, err
+	}
+
+	if !isID(deliveryID) {
+		return nil, errors.ErrWebhookDeliveryNotFound
+	}
+
+	var delivery *app.WebhookDelivery
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		var err error
+		delivery, err = h.webhookDeliveryRepository.FindWebhookDeliveryByID(ctx, deliveryID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.ErrWebhookDeliveryNotFound
+			}
+			logger.WithError(err).Error("failed to find webhook delivery")
+			return errors.ErrGeneric
+		}
+
+		if delivery.SubscriptionID != subscriptionID {
+			return errors.ErrWebhookDeliveryNotFound
+		}
+
+		if delivery.Status != app.WebhookDeliveryFailed {
+			return errors.ErrWebhookDeliveryNotFailed
+		}
+
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt = app.WebhookDeliveryPending, 0, time.Now()
+		if err = h.webhookDeliveryRepository.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			logger.WithError(err).Error("failed to replay webhook delivery")
+			return errors.ErrGeneric
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return delivery, nil
+}
+
+// findWebhookSubscription returns the authenticated user's subscription identified by id,
+// other users' subscriptions are reported as missing
+func (h *Handler) findWebhookSubscription(ctx context.Context, id string, logger *log.Entry) (*app.WebhookSubscription, error) {
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	if !isID(id) {
+		return nil, errors.ErrWebhookSubscriptionNotFound
+	}
+
+	subscription, err := h.webhookSubscriptionRepository.FindWebhookSubscriptionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrWebhookSubscriptionNotFound
+		}
+		logger.WithError(err).Error("failed to find webhook subscription")
+		return nil, errors.ErrGeneric
+	}
+
+	if subscription.UserID != userID {
+		return nil, errors.ErrWebhookSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+func isEventType(eventType string) bool {
+	for _, t := range app.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
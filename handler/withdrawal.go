@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// AddBankRecipient registers a bank account of the authenticated user with Paystack so points can be withdrawn to it
+func (h *Handler) AddBankRecipient(ctx context.Context, input *BankRecipientRequest, logger *log.Entry) (*app.BankRecipient, error) {
+	ctx, span := tracing.Start(ctx, "Handler.AddBankRecipient")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	user, err := h.findActiveUser(ctx, userID, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	name := input.AccountName
+	if name == "" {
+		name = user.Name
+	}
+
+	resp, err := h.paystackClient.CreateTransferRecipient(ctx, &paystack.CreateTransferRecipientRequest{
+		Type:          "nuban",
+		Name:          name,
+		AccountNumber: input.AccountNumber,
+		BankCode:      input.BankCode,
+		Currency:      "NGN",
+	})
+	if err != nil {
+		var paystackErr *paystack.Error
+		if errors.As(err, &paystackErr) && paystackErr.StatusCode < http.StatusInternalServerError {
+			return nil, errors.ErrUnresolvedBankAccount
+		}
+		logger.WithError(err).Error("failed to create paystack transfer recipient")
+		return nil, errors.ErrPaymentProviderFailed
+	}
+
+	recipient := &app.BankRecipient{
+		UserID:        userID,
+		RecipientCode: resp.RecipientCode,
+		AccountNumber: input.AccountNumber,
+		AccountName:   resp.Details.AccountName,
+		BankCode:      input.BankCode,
+		BankName:      resp.Details.BankName,
+	}
+
+	if recipient.AccountName == "" {
+		recipient.AccountName = name
+	}
+
+	if err = h.bankRecipientRepository.CreateBankRecipient(ctx, recipient); err != nil {
+		if postgres.IsDuplicateError(err) {
+			return nil, errors.ErrBankRecipientExists
+		}
+		logger.WithError(err).Error("failed to save bank recipient")
+		return nil, errors.ErrGeneric
+	}
+
+	return recipient, nil
+}
+
+// ListBankRecipients returns the bank accounts the authenticated user can withdraw to
+func (h *Handler) ListBankRecipients(ctx context.Context, logger *log.Entry) ([]*app.BankRecipient, error) {
+	ctx, span := tracing.Start(ctx, "Handler.ListBankRecipients")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	recipients, err := h.bankRecipientRepository.ListUserBankRecipients(ctx, userID)
+	if err != nil {
+		logger.WithError(err).Error("failed to list bank recipients")
+		return nil, errors.ErrGeneric
+	}
+	return recipients, nil
+}
+
+// RequestWithdrawal holds input.Points of the authenticated user and sends their value to the bank
+// account through a Paystack transfer. The hold is settled when Paystack reports the transfer's outcome,
+// either in its response or later through a webhook.
+func (h *Handler) RequestWithdrawal(ctx context.Context, input *WithdrawalRequest, logger *log.Entry) (*app.Withdrawal, error) {
+	ctx, span := tracing.Start(ctx, "Handler.RequestWithdrawal")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	if err := h.validateWithdrawal(input.Points); err != nil {
+		return nil, err
+	}
+
+	if !isID(input.BankRecipientID) {
+		return nil, errors.ErrBankRecipientNotFound
+	}
+
+	recipient, err := h.bankRecipientRepository.FindBankRecipientByID(ctx, input.BankRecipientID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrBankRecipientNotFound
+		}
+		logger.WithError(err).Error("failed to find bank recipient")
+		return nil, errors.ErrGeneric
+	}
+
+	if recipient.UserID != userID {
+		return nil, errors.ErrBankRecipientNotFound
+	}
+
+	withdrawal := &app.Withdrawal{
+		UserID:          userID,
+		BankRecipientID: recipient.ID,
+		Reference:       GenReferralCode(24),
+		Points:          input.Points,
+		Amount:          input.Points * h.withdrawals.PointRate,
+		Status:          app.WithdrawalPending,
+	}
+
+	err = h.runInTx(ctx, func(ctx context.Context) error {
+		balance, err := h.userPointRepository.LockUserPointsBalance(ctx, userID)
+		if err != nil {
+			logger.WithError(err).Error("failed to get user points balance")
+			return errors.ErrGeneric
+		}
+
+		if _, err = h.findActiveUser(ctx, userID, logger); err != nil {
+			return err
+		}
+
+		if balance < input.Points {
+			return errors.ErrInsufficientFunds
+		}
+
+		if h.withdrawals.DailyLimit > 0 {
+			withdrawn, err := h.withdrawalRepository.GetUserWithdrawnPointsSince(ctx, userID, time.Now().Add(-24*time.Hour))
+			if err != nil {
+				logger.WithError(err).Error("failed to get user withdrawn points")
+				return errors.ErrGeneric
+			}
+
+			if withdrawn+input.Points > h.withdrawals.DailyLimit {
+				return errors.ErrWithdrawalLimitExceeded
+			}
+		}
+
+		if err = h.withdrawalRepository.CreateWithdrawal(ctx, withdrawal); err != nil {
+			logger.WithError(err).Error("failed to create withdrawal")
+			return errors.ErrGeneric
+		}
+
+		err = h.payToSystemAccount(ctx, userID, app.WithdrawalHoldAccount, input.Points, app.WithdrawalHoldEntry, withdrawal.ID, "withdrawal hold")
+		if err != nil {
+			logger.WithError(err).Error("failed to hold withdrawal points")
+			return errors.ErrDebitUserFailed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	logger = logger.WithField("reference", withdrawal.Reference)
+	transfer, err := h.paystackClient.InitiateTransfer(ctx, &paystack.InitiateTransferRequest{
+		Source:    "balance",
+		Amount:    withdrawal.Amount,
+		Recipient: recipient.RecipientCode,
+		Reference: withdrawal.Reference,
+		Reason:    "points withdrawal",
+	})
+	if err != nil {
+		var paystackErr *paystack.Error
+		if !errors.As(err, &paystackErr) || paystackErr.StatusCode >= http.StatusInternalServerError {
+			// we can't tell whether Paystack got the transfer, the hold stays until it reports the outcome
+			logger.WithError(err).Error("failed to initiate paystack transfer")
+			return withdrawal, nil
+		}
+
+		logger.WithError(err).Warn("paystack rejected transfer")
+		transfer = &paystack.Transfer{Reference: withdrawal.Reference, Status: paystack.StatusFailed, Reason: paystackErr.Message}
+	}
+
+	return h.completeWithdrawal(ctx, transfer, logger)
+}
+
+// validateWithdrawal checks points against the configured limits
+func (h *Handler) validateWithdrawal(points int64) error {
+	if points <= 0 {
+		return errors.InvalidField("points", "points must be greater than zero")
+	}
+
+	if points < h.withdrawals.MinPoints {
+		return errors.InvalidField("points", fmt.Sprintf("you must withdraw at least %d points", h.withdrawals.MinPoints))
+	}
+
+	if h.withdrawals.MaxPoints > 0 && points > h.withdrawals.MaxPoints {
+		return errors.InvalidField("points", fmt.Sprintf("you can withdraw at most %d points at once", h.withdrawals.MaxPoints))
+	}
+
+	if points > math.MaxInt64/h.withdrawals.PointRate {
+		return errors.InvalidField("points", "too many points in one withdrawal")
+	}
+	return nil
+}
+
+// GetWithdrawal returns the authenticated user's withdrawal identified by reference
+func (h *Handler) GetWithdrawal(ctx context.Context, reference string, logger *log.Entry) (*app.Withdrawal, error) {
+	ctx, span := tracing.Start(ctx, "Handler.GetWithdrawal")
+	defer span.End()
+
+	userID, ok := auth.UserID(ctx)
+	if !ok {
+		return nil, errors.ErrUnauthenticated
+	}
+
+	withdrawal, err := h.withdrawalRepository.FindWithdrawalByReference(ctx, reference)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrWithdrawalNotFound
+		}
+		logger.WithError(err).Error("failed to find withdrawal")
+		return nil, errors.ErrGeneric
+	}
+
+	if withdrawal.UserID != userID {
+		return nil, errors.ErrWithdrawalNotFound
+	}
+	return withdrawal, nil
+}
+
+// completeWithdrawal settles the withdrawal transfer is for in a new transaction
+func (h *Handler) completeWithdrawal(ctx context.Context, transfer *paystack.Transfer, logger *log.Entry) (*app.Withdrawal, error) {
+	var withdrawal *app.Withdrawal
+	err := h.runInTx(ctx, func(ctx context.Context) error {
+		var err error
+		withdrawal, err = h.settleWithdrawal(ctx, transfer, logger)
+		return err
+	})
+	if err != nil {
+		return nil, txError(err, logger)
+	}
+
+	return withdrawal, nil
+}
+
+// settleWithdrawal applies the outcome of transfer to the withdrawal it's for: a successful transfer moves
+// the held points to app.WithdrawalsPaidAccount, a failed one gives them back to the user and a reversal
+// gives back the points of a withdrawal that had succeeded. It must be called in a transaction.
+func (h *Handler) settleWithdrawal(ctx context.Context, transfer *paystack.Transfer, logger *log.Entry) (*app.Withdrawal, error) {
+	withdrawal, err := h.withdrawalRepository.LockWithdrawalByReference(ctx, transfer.Reference)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.ErrWithdrawalNotFound
+		}
+		logger.WithError(err).Error("failed to lock withdrawal")
+		return nil, errors.ErrGeneric
+	}
+
+	if transfer.TransferCode != "" {
+		withdrawal.TransferCode = transfer.TransferCode
+	}
+
+	now := time.Now()
+	switch {
+	case transfer.Status == paystack.StatusReversed && withdrawal.Status == app.WithdrawalSuccess:
+		err = h.payFromSystemAccount(ctx, app.WithdrawalsPaidAccount, withdrawal.UserID, withdrawal.Points, app.WithdrawalReleaseEntry, withdrawal.ID, "withdrawal reversed")
+		withdrawal.Status, withdrawal.FailureReason, withdrawal.CompletedAt = app.WithdrawalFailed, "transfer reversed", &now
+	case withdrawal.Completed():
+		return withdrawal, nil
+	case transfer.Status == paystack.StatusSuccess:
+		err = h.transferBetweenSystemAccounts(ctx, app.WithdrawalHoldAccount, app.WithdrawalsPaidAccount, withdrawal.Points, app.WithdrawalEntry, withdrawal.ID, "withdrawal")
+		withdrawal.Status, withdrawal.CompletedAt = app.WithdrawalSuccess, &now
+	case transfer.Status == paystack.StatusFailed || transfer.Status == paystack.StatusReversed:
+		err = h.payFromSystemAccount(ctx, app.WithdrawalHoldAccount, withdrawal.UserID, withdrawal.Points, app.WithdrawalReleaseEntry, withdrawal.ID, "withdrawal released")
+		withdrawal.Status, withdrawal.FailureReason, withdrawal.CompletedAt = app.WithdrawalFailed, transfer.Reason, &now
+		if withdrawal.FailureReason == "" {
+			withdrawal.FailureReason = "transfer " + transfer.Status
+		}
+	default:
+		// Paystack accepted the transfer and will report its outcome later
+		withdrawal.Status = app.WithdrawalProcessing
+	}
+
+	if err != nil {
+		logger.WithError(err).Error("failed to settle withdrawal hold")
+		return nil, errors.ErrGeneric
+	}
+
+	if err = h.withdrawalRepository.UpdateWithdrawal(ctx, withdrawal); err != nil {
+		logger.WithError(err).Error("failed to update withdrawal")
+		return nil, errors.ErrGeneric
+	}
+	return withdrawal, nil
+}
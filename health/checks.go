@@ -0,0 +1,77 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+)
+
+// Pinger is a dependency that can be pinged, e.g. a *postgres.Client
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// VersionedSchema is a schema that's migrated to a known version, e.g. a *postgres.Migrator
+type VersionedSchema interface {
+	Version(ctx context.Context) (int64, error)
+	LatestVersion() int64
+}
+
+// PingCheck fails when p can't be reached
+func PingCheck(p Pinger) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, p.Ping(ctx)
+	}
+}
+
+// MigrationCheck fails while schema is behind the version this build expects. A schema that's ahead
+// passes, it's what instances still running the previous build see during a rolling deploy.
+func MigrationCheck(schema VersionedSchema) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		version, err := schema.Version(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		expected := schema.LatestVersion()
+		details := map[string]interface{}{"version": version, "expected_version": expected}
+		if version < expected {
+			return details, fmt.Errorf("schema is at version %d, %d is expected", version, expected)
+		}
+		return details, nil
+	}
+}
+
+// OutboxCheck reports the outbox backlog and when dispatcher last went through it, dispatcher may be nil
+// when it doesn't run in this process. It fails when the oldest pending event is older than maxLag, unless
+// maxLag is zero.
+func OutboxCheck(repository app.OutboxRepository, dispatcher *outbox.Dispatcher, maxLag time.Duration) Check {
+	return func(ctx context.Context) (map[string]interface{}, error) {
+		backlog, err := repository.GetOutboxBacklog(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var lag time.Duration
+		if backlog.OldestCreatedAt != nil {
+			lag = time.Since(*backlog.OldestCreatedAt)
+		}
+
+		details := map[string]interface{}{"pending": backlog.Pending, "lag_seconds": lag.Seconds()}
+		if dispatcher != nil {
+			var last *time.Time
+			if at := dispatcher.LastDispatch(); !at.IsZero() {
+				last = &at
+			}
+			details["last_dispatch_at"] = last
+		}
+
+		if maxLag > 0 && lag > maxLag {
+			return details, fmt.Errorf("the oldest unpublished event is %s old, more than %s", lag.Round(time.Second), maxLag)
+		}
+		return details, nil
+	}
+}
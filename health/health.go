@@ -0,0 +1,118 @@
+// Package health reports whether the service is alive and ready to serve, for load balancers and orchestrators to probe
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+)
+
+const DefaultCheckTimeout = 2 * time.Second
+
+// statuses of a Report and of each of its checks
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check inspects a dependency, the details it returns are reported whether it fails or not
+type Check func(ctx context.Context) (details map[string]interface{}, err error)
+
+// CheckResult is the outcome of a Check
+type CheckResult struct {
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the outcome of every check, its status is ok only when all of theirs are
+type Report struct {
+	Status string                  `json:"status"`
+	Checks map[string]*CheckResult `json:"checks,omitempty"`
+}
+
+// OK reports whether the service is fit to serve
+func (r *Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the readiness checks, once Shutdown is called it reports the service isn't ready without running them
+type Checker struct {
+	checks       []namedCheck
+	timeout      time.Duration
+	shuttingDown int32
+}
+
+// NewChecker returns a Checker without checks, the default timeout is used when cfg doesn't set one
+func NewChecker(cfg *config.HealthConfig) *Checker {
+	c := &Checker{timeout: DefaultCheckTimeout}
+	if cfg != nil && cfg.CheckTimeout > 0 {
+		c.timeout = cfg.CheckTimeout
+	}
+	return c
+}
+
+// Add registers check under name, it must be called before the checker is used
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes every following readiness report fail, so traffic is drained before the server stops
+func (c *Checker) Shutdown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// Live reports the process is up, it's meant to fail only when the process can't answer at all
+func (c *Checker) Live() *Report {
+	return &Report{Status: StatusOK}
+}
+
+// Ready runs every check at once, each with its own timeout, and reports how they went
+func (c *Checker) Ready(ctx context.Context) *Report {
+	if atomic.LoadInt32(&c.shuttingDown) == 1 {
+		return &Report{Status: StatusShuttingDown}
+	}
+
+	report := &Report{Status: StatusOK, Checks: make(map[string]*CheckResult, len(c.checks))}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			result := c.run(ctx, nc.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[nc.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFailing
+			}
+		}(nc)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) *CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := &CheckResult{Status: StatusOK, DurationMS: time.Since(start).Milliseconds(), Details: details}
+	if err != nil {
+		result.Status, result.Error = StatusFailing, err.Error()
+	}
+	return result
+}
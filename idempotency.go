@@ -0,0 +1,36 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyKey stores the outcome of a request made with an Idempotency-Key header,
+// so a retried request can be answered without executing it again
+type IdempotencyKey struct {
+	ID             string    `json:"id"`
+	Scope          string    `json:"scope"` // the route the key was used on, e.g "POST /transaction"
+	Key            string    `json:"key"`
+	RequestHash    string    `json:"request_hash"`    // fingerprint of the request body
+	ResponseStatus int       `json:"response_status"` // zero while the original request is still being processed
+	ResponseBody   []byte    `json:"response_body"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Completed reports whether the response of the original request has been stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.ResponseStatus != 0
+}
+
+type IdempotencyRepository interface {
+	CreateIdempotencyKey(ctx context.Context, key *IdempotencyKey) error
+	FindIdempotencyKey(ctx context.Context, scope string, key string) (*IdempotencyKey, error)
+	SaveIdempotencyKeyResponse(ctx context.Context, scope string, key string, status int, body []byte) error
+	DeleteIdempotencyKey(ctx context.Context, scope string, key string) error
+	// TakeOverIdempotencyKey renews the lease of key when it's still in progress and wasn't updated since
+	// staleBefore, it reports false when it was completed, released or taken over in the meantime
+	TakeOverIdempotencyKey(ctx context.Context, scope string, key string, staleBefore time.Time) (bool, error)
+	// PurgeIdempotencyKeys deletes the keys last updated before before and returns how many there were
+	PurgeIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+}
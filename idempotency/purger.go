@@ -0,0 +1,80 @@
+// Package idempotency holds the defaults of Idempotency-Key handling and purges the keys once they expire
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLease is longer than the longest route timeout in config/config.yml
+	DefaultLease         = 5 * time.Minute
+	DefaultTTL           = 24 * time.Hour
+	DefaultPurgeInterval = time.Hour
+)
+
+// Lease returns how long a request may hold its key before a retry takes it over
+func Lease(cfg *config.IdempotencyConfig) time.Duration {
+	if cfg != nil && cfg.Lease > 0 {
+		return cfg.Lease
+	}
+	return DefaultLease
+}
+
+// Purger deletes the keys that weren't used for longer than their TTL
+type Purger struct {
+	repository    app.IdempotencyRepository
+	ttl           time.Duration
+	purgeInterval time.Duration
+	logger        *log.Entry
+}
+
+// NewPurger returns a Purger, the defaults are used for what cfg doesn't set
+func NewPurger(repository app.IdempotencyRepository, cfg *config.IdempotencyConfig, logger *log.Entry) *Purger {
+	p := &Purger{
+		repository:    repository,
+		ttl:           DefaultTTL,
+		purgeInterval: DefaultPurgeInterval,
+		logger:        logger,
+	}
+
+	if cfg != nil {
+		if cfg.TTL > 0 {
+			p.ttl = cfg.TTL
+		}
+		if cfg.PurgeInterval > 0 {
+			p.purgeInterval = cfg.PurgeInterval
+		}
+	}
+	return p
+}
+
+// Run purges the expired keys right away and then every purge interval until ctx is done
+func (p *Purger) Run(ctx context.Context) {
+	for {
+		if _, err := p.Purge(ctx); err != nil {
+			p.logger.WithError(err).Error("failed to purge idempotency keys")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.purgeInterval):
+		}
+	}
+}
+
+// Purge deletes the keys last updated more than the TTL ago and returns how many there were
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+	purged, err := p.repository.PurgeIdempotencyKeys(ctx, time.Now().Add(-p.ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	p.logger.WithField("purged", purged).Debug("purged idempotency keys")
+	return purged, nil
+}
@@ -0,0 +1,77 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+// LeaderboardPeriod is the stretch of time a leaderboard ranks referrers over, periods are calendar
+// ones in UTC: the current day, the week since Monday and the month since the 1st
+type LeaderboardPeriod string
+
+const (
+	LeaderboardDay     LeaderboardPeriod = "day"
+	LeaderboardWeek    LeaderboardPeriod = "week"
+	LeaderboardMonth   LeaderboardPeriod = "month"
+	LeaderboardAllTime LeaderboardPeriod = "all"
+)
+
+// LeaderboardPeriods are every LeaderboardPeriod
+var LeaderboardPeriods = []LeaderboardPeriod{LeaderboardDay, LeaderboardWeek, LeaderboardMonth, LeaderboardAllTime}
+
+// Start returns when p began at now, the zero time for LeaderboardAllTime
+func (p LeaderboardPeriod) Start(now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch p {
+	case LeaderboardDay:
+		return day
+	case LeaderboardWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case LeaderboardMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// LeaderboardMetric is what a leaderboard ranks referrers by
+type LeaderboardMetric string
+
+const (
+	// LeaderboardByReferrals ranks by the referrals made, held and deleted ones aren't counted
+	LeaderboardByReferrals LeaderboardMetric = "referrals"
+	// LeaderboardByPoints ranks by the points earned from ReferralRewardEntries
+	LeaderboardByPoints LeaderboardMetric = "points"
+)
+
+// LeaderboardEntry is a referrer's standing in a period. Ties on the metric ranked by are broken by the other
+// metric, then by who got to their score first, then by user ID so every entry has its own rank.
+type LeaderboardEntry struct {
+	Rank   int64  `json:"rank"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// Referrals are the users they referred in the period, QualifiedReferrals the referees who
+	// went past the transfer bonus threshold in it
+	Referrals          int64 `json:"referrals"`
+	QualifiedReferrals int64 `json:"qualified_referrals"`
+	Points             int64 `json:"points"`
+}
+
+// Leaderboard is a page of the rankings of a period, as they were when they were last refreshed
+type Leaderboard struct {
+	Period      LeaderboardPeriod   `json:"period"`
+	Metric      LeaderboardMetric   `json:"metric"`
+	RefreshedAt *time.Time          `json:"refreshed_at"`
+	Entries     []*LeaderboardEntry `json:"entries"`
+	NextOffset  *int                `json:"next_offset"`
+}
+
+type LeaderboardRepository interface {
+	// RefreshLeaderboard recomputes the rankings of every period, until it's called again they're served as they are
+	RefreshLeaderboard(ctx context.Context) error
+	// GetLeaderboard returns limit entries of the period's rankings by metric, skipping the first offset.
+	// Users with nothing to show for metric in the period aren't ranked.
+	GetLeaderboard(ctx context.Context, period LeaderboardPeriod, metric LeaderboardMetric, offset int, limit int) (*Leaderboard, error)
+}
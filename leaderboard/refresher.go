@@ -0,0 +1,59 @@
+package leaderboard
+
+import (
+	"context"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultRefreshInterval = 5 * time.Minute
+
+// Refresher keeps the cached leaderboard from getting staler than its refresh interval
+type Refresher struct {
+	repository      app.LeaderboardRepository
+	refreshInterval time.Duration
+	logger          *log.Entry
+}
+
+// NewRefresher returns a Refresher, the default interval is used when cfg doesn't set one
+func NewRefresher(repository app.LeaderboardRepository, cfg *config.LeaderboardConfig, logger *log.Entry) *Refresher {
+	r := &Refresher{
+		repository:      repository,
+		refreshInterval: DefaultRefreshInterval,
+		logger:          logger,
+	}
+
+	if cfg != nil && cfg.RefreshInterval > 0 {
+		r.refreshInterval = cfg.RefreshInterval
+	}
+	return r
+}
+
+// Run refreshes the leaderboard right away and then every refresh interval until ctx is done
+func (r *Refresher) Run(ctx context.Context) {
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			r.logger.WithError(err).Error("failed to refresh leaderboard")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.refreshInterval):
+		}
+	}
+}
+
+// Refresh recomputes the leaderboard
+func (r *Refresher) Refresh(ctx context.Context) error {
+	start := time.Now()
+	if err := r.repository.RefreshLeaderboard(ctx); err != nil {
+		return err
+	}
+
+	r.logger.WithField("took", time.Since(start)).Debug("refreshed leaderboard")
+	return nil
+}
@@ -0,0 +1,153 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+type AccountKind string
+
+const (
+	UserAccountKind   AccountKind = "user"
+	SystemAccountKind AccountKind = "system"
+)
+
+// codes of the system accounts seeded by the migrations
+const (
+	ReferralBonusExpenseAccount = "referral_bonus_expense"
+	OpeningBalanceAccount       = "opening_balance_equity"
+	PointSalesAccount           = "point_sales" // funds points bought through Paystack
+	WithdrawalHoldAccount       = "withdrawal_holds"
+	WithdrawalsPaidAccount      = "withdrawals_paid"           // receives points cashed out through Paystack
+	ReconciliationAccount       = "reconciliation_adjustments" // funds the corrections posted by the reconcile command
+)
+
+type JournalEntryKind string
+
+const (
+	OpeningBalanceEntry               JournalEntryKind = "opening_balance"
+	PointTransferEntry                JournalEntryKind = "point_transfer"
+	ReferralBonusEntry                JournalEntryKind = "referral_bonus"
+	ReferredUserTransactionBonusEntry JournalEntryKind = "referred_user_transaction_bonus"
+	ReferralUplineBonusEntry          JournalEntryKind = "referral_upline_bonus"
+	PointPurchaseEntry                JournalEntryKind = "point_purchase"
+	WithdrawalHoldEntry               JournalEntryKind = "withdrawal_hold"
+	WithdrawalEntry                   JournalEntryKind = "withdrawal"
+	WithdrawalReleaseEntry            JournalEntryKind = "withdrawal_release"
+	ReconciliationAdjustmentEntry     JournalEntryKind = "reconciliation_adjustment"
+)
+
+// ReferralRewardEntries are the kinds of entries paying users for their referrals
+var ReferralRewardEntries = []JournalEntryKind{ReferralBonusEntry, ReferredUserTransactionBonusEntry, ReferralUplineBonusEntry}
+
+// IsReferralReward reports whether k is one of ReferralRewardEntries
+func (k JournalEntryKind) IsReferralReward() bool {
+	for _, kind := range ReferralRewardEntries {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Account is a ledger account, every user has exactly one and the system
+// owns accounts like ReferralBonusExpenseAccount which fund rewards
+type Account struct {
+	ID        string      `json:"id"`
+	Code      string      `json:"code"`
+	Kind      AccountKind `json:"kind"`
+	UserID    *string     `json:"user_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	DeletedAt *time.Time  `json:"deleted_at"`
+}
+
+// JournalEntry records a single point movement, its postings must sum to zero
+type JournalEntry struct {
+	ID          string           `json:"id"`
+	Kind        JournalEntryKind `json:"kind"`
+	Reference   string           `json:"reference"` // ID of the record that caused this entry, e.g a transaction
+	Description string           `json:"description"`
+	Postings    []*Posting       `json:"postings"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// Posting is one leg of a JournalEntry. A positive amount credits the account,
+// a negative amount debits it, so an account's balance is the sum of its postings
+type Posting struct {
+	ID             string    `json:"id"`
+	JournalEntryID string    `json:"journal_entry_id"`
+	AccountID      string    `json:"account_id"`
+	Amount         int64     `json:"amount"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// UserAccountCode returns the code of the ledger account owned by userID
+func UserAccountCode(userID string) string {
+	return "user:" + userID
+}
+
+// NewTransferEntry builds a balanced entry moving points from one account to another
+func NewTransferEntry(kind JournalEntryKind, reference, description, fromAccountID, toAccountID string, points int64) *JournalEntry {
+	return &JournalEntry{
+		Kind:        kind,
+		Reference:   reference,
+		Description: description,
+		Postings: []*Posting{
+			{AccountID: fromAccountID, Amount: -points},
+			{AccountID: toAccountID, Amount: points},
+		},
+	}
+}
+
+// IsBalanced reports whether e has at least two non-zero postings summing to zero
+func (e *JournalEntry) IsBalanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+
+	var sum int64
+	for _, p := range e.Postings {
+		if p.Amount == 0 {
+			return false
+		}
+		sum += p.Amount
+	}
+	return sum == 0
+}
+
+// BalanceDiscrepancy is a user whose cached balance disagrees with the postings on their ledger accounts
+type BalanceDiscrepancy struct {
+	UserID        string `json:"user_id"`
+	CachedBalance int64  `json:"cached_balance"` // UserPoints.Points
+	LedgerBalance int64  `json:"ledger_balance"`
+}
+
+// Difference is how many points the cached balance is over the ledger balance
+func (d *BalanceDiscrepancy) Difference() int64 {
+	return d.CachedBalance - d.LedgerBalance
+}
+
+// UserPosting is a posting on a user's account along with the entry it belongs to
+type UserPosting struct {
+	JournalEntryID string `json:"journal_entry_id"`
+	Reference      string `json:"reference"` // JournalEntry.Reference
+	UserID         string `json:"user_id"`
+	Amount         int64  `json:"amount"`
+}
+
+type LedgerRepository interface {
+	CreateAccount(ctx context.Context, account *Account) error
+	FindAccountByCode(ctx context.Context, code string) (*Account, error)
+	FindAccountByUserID(ctx context.Context, userID string) (*Account, error)
+	PostJournalEntry(ctx context.Context, entry *JournalEntry) error
+	GetAccountBalance(ctx context.Context, accountID string) (int64, error)
+	// ListBalanceDiscrepancies returns the users whose cached balance disagrees with the ledger
+	ListBalanceDiscrepancies(ctx context.Context) ([]*BalanceDiscrepancy, error)
+	// ResyncUserBalance locks userID's cached balance and sets it to their ledger balance, it returns
+	// the discrepancy it corrected or nil when there was none. It must be called in a transaction.
+	ResyncUserBalance(ctx context.Context, userID string) (*BalanceDiscrepancy, error)
+	// ListUserPostings returns the postings on user accounts made by entries of kind, oldest first,
+	// only those of userID when it isn't empty
+	ListUserPostings(ctx context.Context, kind JournalEntryKind, userID string) ([]*UserPosting, error)
+}
@@ -0,0 +1,31 @@
+// Package logging carries a request's logger through its context, so everything
+// that runs for the request logs with the same fields
+package logging
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type contextKey string
+
+const loggerContextKey contextKey = "logger"
+
+// WithLogger returns a copy of ctx carrying logger
+func WithLogger(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext returns the logger in ctx, or one without fields if there's none
+func FromContext(ctx context.Context) *log.Entry {
+	if logger, ok := ctx.Value(loggerContextKey).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithFields returns a copy of ctx whose logger has fields added to it
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithLogger(ctx, FromContext(ctx).WithFields(fields))
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are the metrics the service exports, Registry holds them all along with the Go runtime and process metrics
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec   // by method, route and status
+	HTTPRequestDuration *prometheus.HistogramVec // by method and route
+
+	Registrations     prometheus.Counter
+	Referrals         *prometheus.CounterVec // by whether the referral was held
+	ReferralBonuses   *prometheus.CounterVec // referrals and referees paid for, by bonus, signup or transaction
+	PointTransfers    prometheus.Counter
+	PointsTransferred prometheus.Counter
+}
+
+// New returns Metrics registered on a new Registry. It doesn't use the default registry so every test
+// server gets its own.
+func New() *Metrics {
+	r := prometheus.NewRegistry()
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	f := promauto.With(r)
+	return &Metrics{
+		Registry: r,
+
+		HTTPRequests: f.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total", Help: "HTTP requests served."},
+			[]string{"method", "route", "status"}),
+		HTTPRequestDuration: f.NewHistogramVec(prometheus.HistogramOpts{Name: "http_request_duration_seconds", Help: "Time taken to serve HTTP requests.", Buckets: prometheus.DefBuckets},
+			[]string{"method", "route"}),
+
+		Registrations:     f.NewCounter(prometheus.CounterOpts{Name: "aboki_registrations_total", Help: "Users registered."}),
+		Referrals:         f.NewCounterVec(prometheus.CounterOpts{Name: "aboki_referrals_total", Help: "Referred signups."}, []string{"held"}),
+		ReferralBonuses:   f.NewCounterVec(prometheus.CounterOpts{Name: "aboki_referral_bonuses_paid_total", Help: "Referrals and qualifying referees whose bonus was paid to the referrer."}, []string{"bonus"}),
+		PointTransfers:    f.NewCounter(prometheus.CounterOpts{Name: "aboki_point_transfers_total", Help: "Point transfers between users."}),
+		PointsTransferred: f.NewCounter(prometheus.CounterOpts{Name: "aboki_points_transferred_total", Help: "Points transferred between users."}),
+	}
+}
+
+// Handler serves every metric of m's Registry to Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
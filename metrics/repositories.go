@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+// The repositories below count the writes they pass on once they succeed and the transaction they were
+// made in commits, which needs the transaction to be started by a TxRunner from InstrumentTxRunner.
+
+type userRepository struct {
+	app.UserRepository
+	metrics *Metrics
+}
+
+// InstrumentUserRepository counts the users registered through repo
+func InstrumentUserRepository(repo app.UserRepository, m *Metrics) app.UserRepository {
+	return &userRepository{UserRepository: repo, metrics: m}
+}
+
+func (u *userRepository) CreateUser(ctx context.Context, user *app.User) error {
+	if err := u.UserRepository.CreateUser(ctx, user); err != nil {
+		return err
+	}
+
+	count(ctx, u.metrics.Registrations.Inc)
+	return nil
+}
+
+type userReferralRepository struct {
+	app.UserReferralRepository
+	metrics *Metrics
+}
+
+// InstrumentUserReferralRepository counts the referrals created and the referral bonuses paid through repo,
+// a payout of several batches counts every referral or referee it pays for
+func InstrumentUserReferralRepository(repo app.UserReferralRepository, m *Metrics) app.UserReferralRepository {
+	return &userReferralRepository{UserReferralRepository: repo, metrics: m}
+}
+
+func (u *userReferralRepository) CreateUserReferral(ctx context.Context, referral *app.UserReferral) error {
+	if err := u.UserReferralRepository.CreateUserReferral(ctx, referral); err != nil {
+		return err
+	}
+
+	count(ctx, u.metrics.Referrals.WithLabelValues(strconv.FormatBool(referral.Held)).Inc)
+	return nil
+}
+
+func (u *userReferralRepository) MarkPendingReferralsAsPaid(ctx context.Context, referrerID string, limit int64) ([]string, error) {
+	refereeIDs, err := u.UserReferralRepository.MarkPendingReferralsAsPaid(ctx, referrerID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	count(ctx, func() { u.metrics.ReferralBonuses.WithLabelValues("signup").Add(float64(len(refereeIDs))) })
+	return refereeIDs, nil
+}
+
+func (u *userReferralRepository) PayReferralsTransactionsBonuses(ctx context.Context, ids []string) error {
+	if err := u.UserReferralRepository.PayReferralsTransactionsBonuses(ctx, ids); err != nil {
+		return err
+	}
+
+	count(ctx, func() { u.metrics.ReferralBonuses.WithLabelValues("transaction").Add(float64(len(ids))) })
+	return nil
+}
+
+type userPointRepository struct {
+	app.UserPointRepository
+	metrics *Metrics
+}
+
+// InstrumentUserPointRepository counts the point transfers made through repo
+func InstrumentUserPointRepository(repo app.UserPointRepository, m *Metrics) app.UserPointRepository {
+	return &userPointRepository{UserPointRepository: repo, metrics: m}
+}
+
+func (u *userPointRepository) CreatePointTransaction(ctx context.Context, txn *app.Transaction) error {
+	if err := u.UserPointRepository.CreatePointTransaction(ctx, txn); err != nil {
+		return err
+	}
+
+	count(ctx, func() {
+		u.metrics.PointTransfers.Inc()
+		u.metrics.PointsTransferred.Add(float64(txn.Points))
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+)
+
+type pendingKey struct{}
+
+// pending holds the counts made in a transaction until it commits
+type pending struct {
+	counts []func()
+}
+
+// InstrumentTxRunner returns a TxRunner that applies the counts of the repositories below only once the
+// transaction they were made in commits. An attempt that's rolled back or retried drops its counts, and a
+// savepoint passes its counts on to the transaction around it only if it succeeds.
+func InstrumentTxRunner(runInTx app.TxRunner) app.TxRunner {
+	return func(ctx context.Context, fn func(ctx context.Context) error) error {
+		var p *pending
+		err := runInTx(ctx, func(ctx context.Context) error {
+			p = &pending{}
+			return fn(context.WithValue(ctx, pendingKey{}, p))
+		})
+		if err != nil {
+			return err
+		}
+
+		if parent, ok := ctx.Value(pendingKey{}).(*pending); ok {
+			parent.counts = append(parent.counts, p.counts...)
+			return nil
+		}
+
+		for _, count := range p.counts {
+			count()
+		}
+		return nil
+	}
+}
+
+// count runs fn once the transaction in ctx commits, straight away when ctx has no transaction
+// started by InstrumentTxRunner since the write it counts has already been committed then
+func count(ctx context.Context, fn func()) {
+	if p, ok := ctx.Value(pendingKey{}).(*pending); ok {
+		p.counts = append(p.counts, fn)
+		return
+	}
+	fn()
+}
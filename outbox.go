@@ -0,0 +1,107 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// types of an OutboxEvent
+const (
+	UserRegisteredEvent    = "user.registered"
+	PointsTransferredEvent = "points.transferred"
+	ReferralBonusPaidEvent = "referral.bonus_paid"
+)
+
+// EventTypes are the types of OutboxEvent there are
+var EventTypes = []string{UserRegisteredEvent, PointsTransferredEvent, ReferralBonusPaidEvent}
+
+// OutboxEvent is a domain event saved in the same transaction as the change it describes,
+// it's published to the outside world afterwards so it's never lost nor sent for a change
+// that was rolled back
+type OutboxEvent struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"` // ID of the record the event is about, e.g a user
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"` // failed attempts to publish the event
+	LastError   string          `json:"last_error"`
+	AvailableAt time.Time       `json:"available_at"` // the event isn't published before this
+	PublishedAt *time.Time      `json:"published_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// UserIDs returns the users the event concerns, e.g both parties of a transfer
+func (e *OutboxEvent) UserIDs() ([]string, error) {
+	switch e.Type {
+	case UserRegisteredEvent:
+		p := &UserRegisteredPayload{}
+		if err := json.Unmarshal(e.Payload, p); err != nil {
+			return nil, err
+		}
+
+		if p.ReferrerID != nil {
+			return []string{p.UserID, *p.ReferrerID}, nil
+		}
+		return []string{p.UserID}, nil
+	case PointsTransferredEvent:
+		p := &PointsTransferredPayload{}
+		if err := json.Unmarshal(e.Payload, p); err != nil {
+			return nil, err
+		}
+		return []string{p.UserID, p.RecipientUserID}, nil
+	case ReferralBonusPaidEvent:
+		p := &ReferralBonusPaidPayload{}
+		if err := json.Unmarshal(e.Payload, p); err != nil {
+			return nil, err
+		}
+		return []string{p.ReferrerID}, nil
+	default:
+		return nil, nil
+	}
+}
+
+type OutboxRepository interface {
+	CreateOutboxEvent(ctx context.Context, event *OutboxEvent) error
+	// ClaimOutboxEvents returns up to limit unpublished events that are available, oldest first.
+	// They're locked until the transaction in ctx ends so concurrent dispatchers skip them.
+	ClaimOutboxEvents(ctx context.Context, limit int) ([]*OutboxEvent, error)
+	MarkOutboxEventPublished(ctx context.Context, id string) error
+	// MarkOutboxEventFailed records a failed attempt, the event is retried from retryAt
+	MarkOutboxEventFailed(ctx context.Context, id string, reason string, retryAt time.Time) error
+	// GetOutboxBacklog counts the events that haven't been published yet
+	GetOutboxBacklog(ctx context.Context) (*OutboxBacklog, error)
+}
+
+// OutboxBacklog are the events waiting to be published
+type OutboxBacklog struct {
+	Pending         int64      `json:"pending"`
+	OldestCreatedAt *time.Time `json:"oldest_created_at"` // nil when nothing is pending
+}
+
+// UserRegisteredPayload is the payload of a UserRegisteredEvent
+type UserRegisteredPayload struct {
+	UserID     string  `json:"user_id"`
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	ReferrerID *string `json:"referrer_id"` // set when the user signed up with a referral code
+}
+
+// PointsTransferredPayload is the payload of a PointsTransferredEvent
+type PointsTransferredPayload struct {
+	TransactionID   string `json:"transaction_id"`
+	UserID          string `json:"user_id"`
+	RecipientUserID string `json:"recipient_user_id"`
+	Points          int64  `json:"points"`
+}
+
+// ReferralBonusPaidPayload is the payload of a ReferralBonusPaidEvent
+type ReferralBonusPaidPayload struct {
+	ReferrerID string           `json:"referrer_id"`
+	Kind       JournalEntryKind `json:"kind"` // ReferralBonusEntry, ReferredUserTransactionBonusEntry or ReferralUplineBonusEntry
+	Points     int64            `json:"points"`
+	// RefereeIDs are the referees whose signups earned a ReferralBonusEntry or whose transfers earned a
+	// ReferredUserTransactionBonusEntry, oldest first, for a ReferralUplineBonusEntry it's the user in
+	// ReferrerID's downline who earned the reward shared
+	RefereeIDs []string `json:"referee_ids"`
+}
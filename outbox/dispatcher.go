@@ -0,0 +1,153 @@
+// Package outbox publishes the events handlers save to the outbox, see app.OutboxEvent
+package outbox
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 100
+	DefaultMaxBackoff   = 10 * time.Minute
+)
+
+// Dispatcher delivers outbox events to its publishers at least once. Events are claimed and marked
+// published in one transaction, so dispatchers on several instances never publish the same event
+// concurrently, and an event stays in the outbox until every publisher has accepted it.
+type Dispatcher struct {
+	outboxRepository app.OutboxRepository
+	publishers       []Publisher
+	runInTx          app.TxRunner
+	pollInterval     time.Duration
+	batchSize        int
+	maxBackoff       time.Duration
+	logger           *log.Entry
+	lastDispatch     int64 // unix nanoseconds of the last batch dispatched without an error
+}
+
+// NewDispatcher returns a Dispatcher, defaults are used for the fields of cfg that aren't set
+// and a LogPublisher is used when no publisher is given
+func NewDispatcher(outboxRepository app.OutboxRepository, runInTx app.TxRunner, cfg *config.OutboxConfig, logger *log.Entry, publishers ...Publisher) *Dispatcher {
+	d := &Dispatcher{
+		outboxRepository: outboxRepository,
+		publishers:       publishers,
+		runInTx:          runInTx,
+		pollInterval:     DefaultPollInterval,
+		batchSize:        DefaultBatchSize,
+		maxBackoff:       DefaultMaxBackoff,
+		logger:           logger,
+	}
+
+	if cfg != nil {
+		if cfg.PollInterval > 0 {
+			d.pollInterval = cfg.PollInterval
+		}
+		if cfg.BatchSize > 0 {
+			d.batchSize = cfg.BatchSize
+		}
+		if cfg.MaxBackoff > 0 {
+			d.maxBackoff = cfg.MaxBackoff
+		}
+	}
+
+	if len(d.publishers) == 0 {
+		d.publishers = []Publisher{NewLogPublisher(logger)}
+	}
+	return d
+}
+
+// Run publishes events until ctx is done, a full batch is followed by another one right away
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.Dispatch(ctx)
+		if err != nil {
+			d.logger.WithError(err).Error("failed to dispatch outbox events")
+		}
+
+		wait := d.pollInterval
+		if err == nil && n == d.batchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Dispatch publishes one batch of events and returns how many it claimed. An event a publisher
+// rejects is retried after a backoff that doubles with every attempt, up to the configured maximum.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	var n int
+	err := d.runInTx(ctx, func(ctx context.Context) error {
+		events, err := d.outboxRepository.ClaimOutboxEvents(ctx, d.batchSize)
+		if err != nil {
+			return err
+		}
+		n = len(events)
+
+		for _, event := range events {
+			// each event is published in a savepoint, a publisher's failed query would otherwise abort the
+			// claim transaction and the failure couldn't be recorded, leaving the event first in line forever
+			err = d.runInTx(ctx, func(ctx context.Context) error {
+				if err := d.publish(ctx, event); err != nil {
+					return err
+				}
+				return d.outboxRepository.MarkOutboxEventPublished(ctx, event.ID)
+			})
+			if err != nil {
+				logger := d.logger.WithFields(log.Fields{"event_id": event.ID, "type": event.Type, "attempts": event.Attempts + 1})
+				logger.WithError(err).Warn("failed to publish outbox event")
+
+				err = d.outboxRepository.MarkOutboxEventFailed(ctx, event.ID, err.Error(), time.Now().Add(d.backoff(event.Attempts)))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		atomic.StoreInt64(&d.lastDispatch, time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// LastDispatch returns when a batch was last dispatched without an error, the zero time if none has been
+func (d *Dispatcher) LastDispatch() time.Time {
+	nanos := atomic.LoadInt64(&d.lastDispatch)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// publish hands event to every publisher, stopping at the first one that fails
+func (d *Dispatcher) publish(ctx context.Context, event *app.OutboxEvent) error {
+	for _, p := range d.publishers {
+		if err := p.Publish(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff returns the wait before retrying an event that failed attempts times before
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.pollInterval
+	for i := 0; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,40 @@
+package outbox
+
+import (
+	"context"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	log "github.com/sirupsen/logrus"
+)
+
+// Publisher delivers outbox events outside the database. An event may be delivered more than once,
+// e.g when the transaction marking it published fails, so publishers should be idempotent on event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, event *app.OutboxEvent) error
+}
+
+// PublisherFunc lets a function be used as a Publisher
+type PublisherFunc func(ctx context.Context, event *app.OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event *app.OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// LogPublisher writes events to a logger, it's the publisher used when none is configured
+type LogPublisher struct {
+	logger *log.Entry
+}
+
+func NewLogPublisher(logger *log.Entry) *LogPublisher {
+	return &LogPublisher{logger: logger}
+}
+
+func (l *LogPublisher) Publish(ctx context.Context, event *app.OutboxEvent) error {
+	l.logger.WithFields(log.Fields{
+		"event_id":     event.ID,
+		"type":         event.Type,
+		"aggregate_id": event.AggregateID,
+		"payload":      string(event.Payload),
+	}).Info("published outbox event")
+	return nil
+}
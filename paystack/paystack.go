@@ -0,0 +1,150 @@
+// Package paystack is a minimal client for the parts of the Paystack API used to sell points,
+// see https://paystack.com/docs/api/transaction
+package paystack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/pkg/errors"
+)
+
+const DefaultBaseURL = "https://api.paystack.co"
+
+// statuses of a Transaction
+const (
+	StatusSuccess   = "success"
+	StatusFailed    = "failed"
+	StatusAbandoned = "abandoned" // the customer hasn't completed the payment yet
+	StatusReversed  = "reversed"
+)
+
+// Client calls the Paystack API authenticated with a secret key
+type Client struct {
+	baseURL    string
+	secretKey  string
+	httpClient *http.Client
+}
+
+// NewClient returns a Client for the API at baseURL, DefaultBaseURL is used when baseURL is empty
+func NewClient(secretKey string, baseURL string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type InitializeTransactionRequest struct {
+	Email       string                 `json:"email"`
+	Amount      int64                  `json:"amount"` // in the currency's subunit, e.g kobo
+	Reference   string                 `json:"reference"`
+	CallbackURL string                 `json:"callback_url,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type InitializeTransactionResponse struct {
+	AuthorizationURL string `json:"authorization_url"` // where the customer completes the payment
+	AccessCode       string `json:"access_code"`
+	Reference        string `json:"reference"`
+}
+
+// Transaction is a payment as reported by Paystack
+type Transaction struct {
+	ID        int64      `json:"id"`
+	Status    string     `json:"status"`
+	Reference string     `json:"reference"`
+	Amount    int64      `json:"amount"`
+	Currency  string     `json:"currency"`
+	PaidAt    *time.Time `json:"paid_at"`
+}
+
+// Error is returned when Paystack rejects a request
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("paystack responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// envelope is the shape of every Paystack response
+type envelope struct {
+	Status  bool            `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// InitializeTransaction starts a payment, the customer pays on the returned AuthorizationURL
+func (c *Client) InitializeTransaction(ctx context.Context, req *InitializeTransactionRequest) (*InitializeTransactionResponse, error) {
+	resp := &InitializeTransactionResponse{}
+	if err := c.do(ctx, http.MethodPost, "/transaction/initialize", req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// VerifyTransaction fetches the payment identified by reference
+func (c *Client) VerifyTransaction(ctx context.Context, reference string) (*Transaction, error) {
+	txn := &Transaction{}
+	if err := c.do(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(reference), nil, txn); err != nil {
+		return nil, err
+	}
+	return txn, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, data interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return errors.Wrap(err, "failed to encode request body")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &buf)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	tracing.Inject(ctx, req.Header)
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", method, path)
+	}
+	defer resp.Body.Close()
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+
+	env := &envelope{}
+	if err = json.Unmarshal(raw, env); err != nil {
+		return &Error{StatusCode: resp.StatusCode, Message: string(raw)}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest || !env.Status {
+		return &Error{StatusCode: resp.StatusCode, Message: env.Message}
+	}
+
+	if err = json.Unmarshal(env.Data, data); err != nil {
+		return errors.Wrap(err, "failed to decode response data")
+	}
+	return nil
+}
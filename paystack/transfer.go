@@ -0,0 +1,69 @@
+package paystack
+
+import (
+	"context"
+	"net/http"
+)
+
+// statuses of a Transfer besides StatusSuccess, StatusFailed and StatusReversed
+const (
+	StatusPending = "pending"
+	StatusOTP     = "otp" // the transfer waits for an OTP, only when OTPs are enabled on the integration
+)
+
+type CreateTransferRecipientRequest struct {
+	Type          string `json:"type"` // "nuban" for Nigerian bank accounts
+	Name          string `json:"name"`
+	AccountNumber string `json:"account_number"`
+	BankCode      string `json:"bank_code"`
+	Currency      string `json:"currency"`
+}
+
+// TransferRecipient is a bank account transfers can be sent to
+type TransferRecipient struct {
+	RecipientCode string `json:"recipient_code"`
+	Name          string `json:"name"`
+	Details       struct {
+		AccountNumber string `json:"account_number"`
+		AccountName   string `json:"account_name"`
+		BankCode      string `json:"bank_code"`
+		BankName      string `json:"bank_name"`
+	} `json:"details"`
+}
+
+type InitiateTransferRequest struct {
+	Source    string `json:"source"` // "balance", the Paystack balance the transfer is paid from
+	Amount    int64  `json:"amount"` // in kobo
+	Recipient string `json:"recipient"`
+	Reference string `json:"reference"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Transfer is a payout as reported by Paystack, webhooks about transfers carry one too
+type Transfer struct {
+	ID           int64  `json:"id"`
+	TransferCode string `json:"transfer_code"`
+	Reference    string `json:"reference"`
+	Amount       int64  `json:"amount"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason"`
+}
+
+// CreateTransferRecipient saves a bank account transfers can be sent to
+func (c *Client) CreateTransferRecipient(ctx context.Context, req *CreateTransferRecipientRequest) (*TransferRecipient, error) {
+	recipient := &TransferRecipient{}
+	if err := c.do(ctx, http.MethodPost, "/transferrecipient", req, recipient); err != nil {
+		return nil, err
+	}
+	return recipient, nil
+}
+
+// InitiateTransfer sends money from the Paystack balance to a recipient, the outcome is usually
+// only known once Paystack delivers a TransferSuccess or TransferFailed event
+func (c *Client) InitiateTransfer(ctx context.Context, req *InitiateTransferRequest) (*Transfer, error) {
+	transfer := &Transfer{}
+	if err := c.do(ctx, http.MethodPost, "/transfer", req, transfer); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
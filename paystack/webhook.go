@@ -0,0 +1,38 @@
+package paystack
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// SignatureHeader carries the HMAC-SHA512 of a webhook's body, keyed with the secret key
+const SignatureHeader = "x-paystack-signature"
+
+// types of an Event
+const (
+	ChargeSuccess    = "charge.success"
+	TransferSuccess  = "transfer.success"
+	TransferFailed   = "transfer.failed"
+	TransferReversed = "transfer.reversed"
+)
+
+// Event is a webhook Paystack delivers, Data holds the object the event is about,
+// e.g a Transaction for ChargeSuccess
+type Event struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// VerifySignature reports whether signature is the one Paystack computes for body
+func (c *Client) VerifySignature(body []byte, signature string) bool {
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha512.New, []byte(c.secretKey))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), got)
+}
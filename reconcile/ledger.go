@@ -0,0 +1,239 @@
+package reconcile
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// LedgerDiscrepancy is a transfer or referred user transaction bonus whose journal entries don't move
+// the points it records to or from one of its users
+type LedgerDiscrepancy struct {
+	Kind       app.JournalEntryKind `json:"kind"`      // kind of the entries recording it
+	Reference  string               `json:"reference"` // ID of the transaction or bonus
+	UserID     string               `json:"user_id"`
+	Expected   int64                `json:"expected"`   // points the record moves to the user, negative when it takes them
+	Posted     int64                `json:"posted"`     // points its entries and earlier adjustments moved
+	Difference int64                `json:"difference"` // posted minus expected
+	Status     string               `json:"status"`     // Fixed once an adjustment entry made up the difference
+}
+
+// posting identifies the points one record moves for one user
+type posting struct {
+	kind      app.JournalEntryKind
+	reference string
+	userID    string
+}
+
+// recorded is what the ledger holds for a posting
+type recorded struct {
+	entries  []int64 // points moved by each entry, oldest first
+	adjusted int64   // points moved by the adjustments made to them
+}
+
+func (r *recorded) total() int64 {
+	if r == nil {
+		return 0
+	}
+
+	total := r.adjusted
+	for _, amount := range r.entries {
+		total += amount
+	}
+	return total
+}
+
+// adjustmentReference is the reference of the adjustment entries made for the record of kind with ID reference
+func adjustmentReference(kind app.JournalEntryKind, reference string) string {
+	return string(kind) + ":" + reference
+}
+
+// checkLedger compares each transfer and paid transaction bonus with the entries recording it. The ledger is
+// read before the records, so a record written meanwhile can only look unposted, fixing it finds it Resolved.
+func (r *Reconciler) checkLedger(ctx context.Context) ([]*LedgerDiscrepancy, error) {
+	found, err := r.ledgerPostings(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := r.expectedPostings(ctx, found)
+	if err != nil {
+		return nil, err
+	}
+
+	// entries without a record are expected to move nothing
+	for p := range found {
+		if _, ok := expected[p]; !ok {
+			expected[p] = 0
+		}
+	}
+
+	discrepancies := []*LedgerDiscrepancy{}
+	for p, points := range expected {
+		if posted := found[p].total(); posted != points {
+			discrepancies = append(discrepancies, &LedgerDiscrepancy{
+				Kind:       p.kind,
+				Reference:  p.reference,
+				UserID:     p.userID,
+				Expected:   points,
+				Posted:     posted,
+				Difference: posted - points,
+				Status:     Open,
+			})
+		}
+	}
+
+	sort.Slice(discrepancies, func(i, j int) bool {
+		a, b := discrepancies[i], discrepancies[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Reference != b.Reference {
+			return a.Reference < b.Reference
+		}
+		return a.UserID < b.UserID
+	})
+	return discrepancies, nil
+}
+
+// ledgerPostings collects what the ledger moved for each record, to userID only when it isn't empty.
+// A transaction bonus entry pays for every bonus in its reference, each gets an even share of it.
+func (r *Reconciler) ledgerPostings(ctx context.Context, userID string) (map[posting]*recorded, error) {
+	found := map[posting]*recorded{}
+	get := func(p posting) *recorded {
+		if found[p] == nil {
+			found[p] = &recorded{}
+		}
+		return found[p]
+	}
+
+	transfers, err := r.ledgerRepository.ListUserPostings(ctx, app.PointTransferEntry, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list point transfer postings")
+	}
+
+	for _, p := range transfers {
+		rec := get(posting{kind: app.PointTransferEntry, reference: p.Reference, userID: p.UserID})
+		rec.entries = append(rec.entries, p.Amount)
+	}
+
+	bonuses, err := r.ledgerRepository.ListUserPostings(ctx, app.ReferredUserTransactionBonusEntry, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list transaction bonus postings")
+	}
+
+	for _, p := range bonuses {
+		ids := strings.Split(p.Reference, ",")
+		for _, id := range ids {
+			rec := get(posting{kind: app.ReferredUserTransactionBonusEntry, reference: id, userID: p.UserID})
+			rec.entries = append(rec.entries, p.Amount/int64(len(ids)))
+		}
+	}
+
+	adjustments, err := r.ledgerRepository.ListUserPostings(ctx, app.ReconciliationAdjustmentEntry, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list adjustment postings")
+	}
+
+	for _, p := range adjustments {
+		parts := strings.SplitN(p.Reference, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		get(posting{kind: app.JournalEntryKind(parts[0]), reference: parts[1], userID: p.UserID}).adjusted += p.Amount
+	}
+	return found, nil
+}
+
+// expectedPostings returns the points each transfer and paid transaction bonus moves for its users. A bonus
+// is worth what the program paid for it then, so it's expected to match its first entry, a bonus with no
+// entry is owed the current program's rate.
+func (r *Reconciler) expectedPostings(ctx context.Context, found map[posting]*recorded) (map[posting]int64, error) {
+	expected := map[posting]int64{}
+
+	txns, err := r.userPointRepository.ListPointTransactions(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list point transactions")
+	}
+
+	for _, t := range txns {
+		expected[posting{kind: app.PointTransferEntry, reference: t.ID, userID: t.UserID}] -= t.Points
+		expected[posting{kind: app.PointTransferEntry, reference: t.ID, userID: t.RecipientUserID}] += t.Points
+	}
+
+	bonuses, err := r.userReferralRepository.ListPaidReferredUserTransactionBonuses(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list paid transaction bonuses")
+	}
+
+	var rate int64
+	if size := r.referralProgram.TransferBonusBatchSize(); size > 0 {
+		reward, _ := r.referralProgram.TransferReward(size)
+		rate = reward / size
+	}
+
+	for _, b := range bonuses {
+		p := posting{kind: app.ReferredUserTransactionBonusEntry, reference: b.ID, userID: b.ReferrerID}
+		if rec := found[p]; rec != nil && len(rec.entries) > 0 {
+			expected[p] = rec.entries[0]
+		} else {
+			expected[p] = rate
+		}
+	}
+	return expected, nil
+}
+
+// adjust posts an entry between d's user and app.ReconciliationAccount making up the difference. The user's
+// balance is locked and their postings read again first, d is Resolved when the difference is gone.
+func (r *Reconciler) adjust(ctx context.Context, d *LedgerDiscrepancy) error {
+	status := Resolved
+	err := r.runInTx(ctx, func(ctx context.Context) error {
+		status = Resolved
+
+		if _, err := r.userPointRepository.LockUserPointsBalance(ctx, d.UserID); err != nil {
+			return errors.Wrap(err, "failed to lock user balance")
+		}
+
+		found, err := r.ledgerPostings(ctx, d.UserID)
+		if err != nil {
+			return err
+		}
+
+		points := d.Expected - found[posting{kind: d.Kind, reference: d.Reference, userID: d.UserID}].total()
+		if points == 0 {
+			return nil
+		}
+
+		user, err := r.ledgerRepository.FindAccountByUserID(ctx, d.UserID)
+		if err != nil {
+			return errors.Wrap(err, "failed to find user account")
+		}
+
+		system, err := r.ledgerRepository.FindAccountByCode(ctx, app.ReconciliationAccount)
+		if err != nil {
+			return errors.Wrap(err, "failed to find reconciliation account")
+		}
+
+		from, to := system.ID, user.ID
+		if points < 0 {
+			from, to, points = to, from, -points
+		}
+
+		entry := app.NewTransferEntry(app.ReconciliationAdjustmentEntry, adjustmentReference(d.Kind, d.Reference), "reconciliation adjustment", from, to, points)
+		if err = r.ledgerRepository.PostJournalEntry(ctx, entry); err != nil {
+			return err
+		}
+
+		status = Fixed
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.Status = status
+	return nil
+}
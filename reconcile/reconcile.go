@@ -0,0 +1,170 @@
+// Package reconcile checks the ledger against the transfers and bonuses it records, and the
+// balances cached in user_points against the ledger they're derived from
+package reconcile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+)
+
+// statuses of a reported discrepancy
+const (
+	Open     = "open"
+	Fixed    = "fixed"    // corrected by the run that reported it
+	Resolved = "resolved" // gone by the time it was to be fixed, e.g because it was read mid-transfer
+)
+
+// Discrepancy is a user whose cached balance disagreed with the ledger
+type Discrepancy struct {
+	UserID        string `json:"user_id"`
+	CachedBalance int64  `json:"cached_balance"`
+	LedgerBalance int64  `json:"ledger_balance"`
+	Difference    int64  `json:"difference"` // cached minus ledger balance
+	Status        string `json:"status"`     // Fixed once the cached balance was set to the ledger balance
+}
+
+type Report struct {
+	CheckedAt           time.Time            `json:"checked_at"`
+	LedgerDiscrepancies []*LedgerDiscrepancy `json:"ledger_discrepancies"`
+	Discrepancies       []*Discrepancy       `json:"discrepancies"`
+}
+
+// Unfixed returns how many discrepancies are left
+func (r *Report) Unfixed() int {
+	var n int
+	for _, d := range r.LedgerDiscrepancies {
+		if d.Status == Open {
+			n++
+		}
+	}
+	for _, d := range r.Discrepancies {
+		if d.Status == Open {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteJSON writes r to w as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes a header and a row for each discrepancy of r to w. The check column holds the kind
+// of a ledger discrepancy, or cached_balance for a balance one whose expected value is the ledger
+// balance and actual value the cached balance.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"check", "user_id", "reference", "expected", "actual", "difference", "status"})
+	for _, d := range r.LedgerDiscrepancies {
+		cw.Write([]string{
+			string(d.Kind),
+			d.UserID,
+			d.Reference,
+			strconv.FormatInt(d.Expected, 10),
+			strconv.FormatInt(d.Posted, 10),
+			strconv.FormatInt(d.Difference, 10),
+			d.Status,
+		})
+	}
+	for _, d := range r.Discrepancies {
+		cw.Write([]string{
+			"cached_balance",
+			d.UserID,
+			"",
+			strconv.FormatInt(d.LedgerBalance, 10),
+			strconv.FormatInt(d.CachedBalance, 10),
+			strconv.FormatInt(d.Difference, 10),
+			d.Status,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Reconciler finds transfers and transaction bonuses the ledger doesn't record as they happened, and
+// users whose cached balance drifted from the ledger. The ledger holds every transfer, bonus, purchase
+// and withdrawal as a journal entry, so once it agrees with those records it's the balance users are owed.
+type Reconciler struct {
+	ledgerRepository       app.LedgerRepository
+	userPointRepository    app.UserPointRepository
+	userReferralRepository app.UserReferralRepository
+	referralProgram        *referral.Program
+	runInTx                app.TxRunner
+}
+
+func NewReconciler(ledgerRepository app.LedgerRepository, userPointRepository app.UserPointRepository, userReferralRepository app.UserReferralRepository, referralProgram *referral.Program, runInTx app.TxRunner) *Reconciler {
+	return &Reconciler{
+		ledgerRepository:       ledgerRepository,
+		userPointRepository:    userPointRepository,
+		userReferralRepository: userReferralRepository,
+		referralProgram:        referralProgram,
+		runInTx:                runInTx,
+	}
+}
+
+// Run reports every discrepancy. With fix, each ledger discrepancy is made up by an adjustment entry
+// against app.ReconciliationAccount, then the cached balance of each user is set to the ledger balance;
+// the cache is derived from the ledger, so it's corrected rather than posted against. Each discrepancy
+// is fixed in its own transaction with the user's balance locked, one that's gone by then is reported
+// as Resolved.
+func (r *Reconciler) Run(ctx context.Context, fix bool) (*Report, error) {
+	report := &Report{CheckedAt: time.Now(), LedgerDiscrepancies: []*LedgerDiscrepancy{}, Discrepancies: []*Discrepancy{}}
+
+	ledger, err := r.checkLedger(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check the ledger")
+	}
+
+	for _, d := range ledger {
+		report.LedgerDiscrepancies = append(report.LedgerDiscrepancies, d)
+
+		if !fix {
+			continue
+		}
+
+		if err = r.adjust(ctx, d); err != nil && !errors.Is(err, errors.ErrInsufficientFunds) {
+			return report, errors.Wrap(err, "failed to adjust "+string(d.Kind)+" "+d.Reference)
+		}
+	}
+
+	found, err := r.ledgerRepository.ListBalanceDiscrepancies(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list balance discrepancies")
+	}
+
+	for _, f := range found {
+		d := &Discrepancy{UserID: f.UserID, CachedBalance: f.CachedBalance, LedgerBalance: f.LedgerBalance, Difference: f.Difference(), Status: Open}
+		report.Discrepancies = append(report.Discrepancies, d)
+
+		if !fix {
+			continue
+		}
+
+		var resynced *app.BalanceDiscrepancy
+		err = r.runInTx(ctx, func(ctx context.Context) error {
+			var err error
+			resynced, err = r.ledgerRepository.ResyncUserBalance(ctx, d.UserID)
+			return err
+		})
+		if err != nil {
+			return report, errors.Wrap(err, "failed to fix balance of user "+d.UserID)
+		}
+
+		d.Status = Resolved
+		if resynced != nil {
+			d.Status = Fixed
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,171 @@
+package referral
+
+import (
+	"fmt"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// events a referral rule can be triggered by
+const (
+	// RefereeRegistered fires when a user signs up with a referral code
+	RefereeRegistered = "referee_registered"
+
+	// RefereeTransferred fires when a referred user transfers points
+	RefereeTransferred = "referee_transferred"
+)
+
+// Program evaluates the rules of a config.ReferralProgram, a nil rule means the event pays nothing
+type Program struct {
+	signup       *config.ReferralRule
+	transfer     *config.ReferralRule
+	uplineShares []int64
+}
+
+// DefaultProgram is the program used when none is configured, it pays 50 points for
+// every 3 referees who sign up and 50 points for every 3 referees who transfer more than 200 points
+func DefaultProgram() *config.ReferralProgram {
+	return &config.ReferralProgram{
+		Rules: []*config.ReferralRule{
+			{Name: "signup_bonus", Event: RefereeRegistered, BatchSize: 3, Reward: 50},
+			{Name: "transfer_bonus", Event: RefereeTransferred, Threshold: 200, BatchSize: 3, Reward: 50},
+		},
+	}
+}
+
+// NewProgram validates cfg and builds a Program from it, DefaultProgram is used when cfg is nil
+func NewProgram(cfg *config.ReferralProgram) (*Program, error) {
+	if cfg == nil {
+		cfg = DefaultProgram()
+	}
+
+	p := &Program{}
+	for _, rule := range cfg.Rules {
+		if rule.BatchSize < 1 {
+			return nil, errors.New(fmt.Sprintf("referral rule %q: batch_size must be at least 1", rule.Name))
+		}
+
+		if rule.Reward < 1 {
+			return nil, errors.New(fmt.Sprintf("referral rule %q: reward must be at least 1", rule.Name))
+		}
+
+		switch rule.Event {
+		case RefereeRegistered:
+			if p.signup != nil {
+				return nil, errors.New(fmt.Sprintf("referral rule %q: only one rule may handle %s", rule.Name, rule.Event))
+			}
+			p.signup = rule
+		case RefereeTransferred:
+			if p.transfer != nil {
+				return nil, errors.New(fmt.Sprintf("referral rule %q: only one rule may handle %s", rule.Name, rule.Event))
+			}
+			if rule.Threshold < 0 {
+				return nil, errors.New(fmt.Sprintf("referral rule %q: threshold cannot be negative", rule.Name))
+			}
+			p.transfer = rule
+		default:
+			return nil, errors.New(fmt.Sprintf("referral rule %q: unknown event %q", rule.Name, rule.Event))
+		}
+	}
+
+	var total int64
+	for _, share := range cfg.UplineShares {
+		if share < 0 {
+			return nil, errors.New("referral program: upline shares cannot be negative")
+		}
+		total += share
+	}
+
+	if total > 100 {
+		return nil, errors.New("referral program: upline shares cannot add up to more than 100 percent")
+	}
+
+	p.uplineShares = append([]int64(nil), cfg.UplineShares...)
+	return p, nil
+}
+
+// SignupReward returns the points due to a referrer who now has pending unpaid referrals and how many of
+// them they pay for, zero if nothing is due yet. Every full batch is paid, so a backlog left by held
+// referrals being released or a smaller batch size is paid out at once and the remainder stays pending.
+func (p *Program) SignupReward(pending int64) (reward int64, referrals int64) {
+	if p.signup == nil || pending < p.signup.BatchSize {
+		return 0, 0
+	}
+	batches := pending / p.signup.BatchSize
+	return batches * p.signup.Reward, batches * p.signup.BatchSize
+}
+
+// QualifyingTransfer reports whether a referee's total transferred points went past the
+// transfer rule's threshold, before is the total prior to the transfer and after includes it
+func (p *Program) QualifyingTransfer(before, after int64) bool {
+	if p.transfer == nil {
+		return false
+	}
+	return before <= p.transfer.Threshold && after > p.transfer.Threshold
+}
+
+// TransferBonusBatchSize is the number of qualifying referees paid out together
+func (p *Program) TransferBonusBatchSize() int64 {
+	if p.transfer == nil {
+		return 0
+	}
+	return p.transfer.BatchSize
+}
+
+// TransferReward returns the points due to a referrer with pending unpaid referred user transaction bonuses
+// and how many of them they pay for, every full batch is paid like SignupReward does
+func (p *Program) TransferReward(pending int64) (reward int64, bonuses int64) {
+	if p.transfer == nil || pending < p.transfer.BatchSize {
+		return 0, 0
+	}
+	batches := pending / p.transfer.BatchSize
+	return batches * p.transfer.Reward, batches * p.transfer.BatchSize
+}
+
+// UplineDepth is how many levels above a referrer share in their rewards
+func (p *Program) UplineDepth() int {
+	return len(p.uplineShares)
+}
+
+// UplineRewards returns the points paid to each level above a referrer who earned reward, the first is
+// the grand-referrer's. Shares are rounded down, a level whose share rounds to zero gets nothing.
+func (p *Program) UplineRewards(reward int64) []int64 {
+	rewards := make([]int64, len(p.uplineShares))
+	for i, share := range p.uplineShares {
+		rewards[i] = reward * share / 100
+	}
+	return rewards
+}
+
+// Progress describes how far a referrer is from the next reward of a rule
+type Progress struct {
+	Rule      string `json:"rule"`
+	Event     string `json:"event"`
+	Pending   int64  `json:"pending"` // qualifying referees not paid out yet
+	BatchSize int64  `json:"batch_size"`
+	Reward    int64  `json:"reward"`
+}
+
+// Progress reports the referrer's progress toward each configured rule, pendingSignups and
+// pendingTransfers are the unpaid referrals and unpaid referred user transaction bonuses
+func (p *Program) Progress(pendingSignups, pendingTransfers int64) []*Progress {
+	progress := []*Progress{}
+	for _, r := range []struct {
+		rule    *config.ReferralRule
+		pending int64
+	}{{p.signup, pendingSignups}, {p.transfer, pendingTransfers}} {
+		if r.rule == nil {
+			continue
+		}
+
+		progress = append(progress, &Progress{
+			Rule:      r.rule.Name,
+			Event:     r.rule.Event,
+			Pending:   r.pending,
+			BatchSize: r.rule.BatchSize,
+			Reward:    r.rule.Reward,
+		})
+	}
+	return progress
+}
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/logging"
+	"github.com/dimfeld/httptreemux"
+	log "github.com/sirupsen/logrus"
+)
+
+// authenticated rejects requests without a valid bearer token, the authenticated
+// user's ID is stored in the request's context and added to its logger
+func authenticated(h *handler.Handler, next httptreemux.HandlerFunc) httptreemux.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			writeError(w, errors.ErrUnauthenticated)
+			return
+		}
+
+		userID, err := h.Authenticate(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		ctx := logging.WithFields(auth.WithUserID(r.Context(), userID), log.Fields{"user_id": userID})
+		next(w, r.WithContext(ctx), params)
+	}
+}
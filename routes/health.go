@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/dimfeld/httptreemux"
+)
+
+// setupHealthRoutes registers the probes on mux directly, like /metrics they're polled too often to be traced or counted
+func setupHealthRoutes(mux *httptreemux.TreeMux, checker *health.Checker) {
+	mux.GET("/healthz", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		writeReport(w, checker.Live())
+	})
+
+	mux.GET("/readyz", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		writeReport(w, checker.Ready(r.Context()))
+	})
+}
+
+// writeReport responds with report, with a 503 status unless it's ok
+func writeReport(w http.ResponseWriter, report *health.Report) {
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	buf, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
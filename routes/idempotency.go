@@ -0,0 +1,98 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/logging"
+	"github.com/dimfeld/httptreemux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotent makes next safe to retry. Requests carrying an Idempotency-Key header are executed once,
+// replays get the stored response and reusing a key with a different body is rejected with a conflict.
+func idempotent(h *handler.Handler, next httptreemux.HandlerFunc) httptreemux.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r, params)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, errors.Validation("failed to read request body"))
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+
+		// keys are per caller, two users picking the same key must not see each other's responses
+		scope := r.Method + " " + r.URL.Path
+		if userID, ok := auth.UserID(r.Context()); ok {
+			scope += " " + userID
+		}
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"idempotency_key": key, "scope": scope})
+
+		// the key must be settled even if the request is canceled, only its trace and logger are carried over
+		ctx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(r.Context()))
+		ctx = logging.WithLogger(ctx, logger)
+		stored, err := h.BeginIdempotentRequest(ctx, scope, key, hex.EncodeToString(sum[:]), logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if stored != nil {
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.ResponseStatus)
+			w.Write(stored.ResponseBody)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(handler.TrackCommits(r.Context()))
+		next(rec, r, params)
+
+		// a server error from before anything was committed frees the key so the client may retry, one that may
+		// have come after a commit is stored like any other response since running the request again could apply it twice.
+		// The response is already sent, a key that isn't settled stays held until its lease runs out
+		if rec.status >= http.StatusInternalServerError && !handler.MayHaveCommitted(r.Context()) {
+			if err := h.ReleaseIdempotencyKey(ctx, scope, key, logger); err != nil {
+				logger.WithError(err).Warn("retries of the request are refused until the idempotency key's lease runs out")
+			}
+			return
+		}
+
+		if err := h.CompleteIdempotentRequest(ctx, scope, key, rec.status, rec.body.Bytes(), logger); err != nil {
+			logger.WithError(err).Error("the response can't be replayed, a retry after the idempotency key's lease runs out executes the request again")
+		}
+	}
+}
+
+// responseRecorder passes a response through to the client while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
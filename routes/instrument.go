@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/logging"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/dimfeld/httptreemux"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader identifies a request in logs, a valid one sent by the client is kept and any other is replaced
+const RequestIDHeader = "X-Request-ID"
+
+// DefaultRequestTimeout is how long a request may take when config.ServerConfig doesn't say
+const DefaultRequestTimeout = 30 * time.Second
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// instrumentedRouter registers routes on a TreeMux, counting, timing and tracing the requests served by each.
+// Requests are labelled with the route's pattern rather than their path so IDs don't make new series.
+// Every request gets an ID, a context that's canceled when it times out or the client goes away, and a
+// logger carried by that context with the request ID, route and client IP.
+type instrumentedRouter struct {
+	mux      *httptreemux.TreeMux
+	handler  *handler.Handler
+	metrics  *metrics.Metrics
+	timeouts *config.ServerConfig
+}
+
+func (i *instrumentedRouter) GET(path string, handler httptreemux.HandlerFunc) {
+	i.mux.GET(path, i.instrument(http.MethodGet, path, handler))
+}
+
+func (i *instrumentedRouter) POST(path string, handler httptreemux.HandlerFunc) {
+	i.mux.POST(path, i.instrument(http.MethodPost, path, handler))
+}
+
+func (i *instrumentedRouter) DELETE(path string, handler httptreemux.HandlerFunc) {
+	i.mux.DELETE(path, i.instrument(http.MethodDelete, path, handler))
+}
+
+func (i *instrumentedRouter) instrument(method, route string, next httptreemux.HandlerFunc) httptreemux.HandlerFunc {
+	duration := i.metrics.HTTPRequestDuration.WithLabelValues(method, route)
+	timeout := i.timeout(method + " " + route)
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(method), semconv.HTTPRoute(route), semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+				attribute.String("http.request_id", requestID)),
+		)
+		defer span.End()
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		ctx = logging.WithFields(ctx, log.Fields{
+			"request_id": requestID,
+			"method":     method,
+			"route":      route,
+			"remote_ip":  i.handler.ClientIP(r),
+		})
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(ctx), params)
+
+		duration.Observe(time.Since(start).Seconds())
+		i.metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(rec.status)).Inc()
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	}
+}
+
+// timeout returns how long requests to route, given as "METHOD /pattern", may take, zero if there's no limit
+func (i *instrumentedRouter) timeout(route string) time.Duration {
+	timeout := DefaultRequestTimeout
+	if i.timeouts != nil {
+		if i.timeouts.RequestTimeout != 0 {
+			timeout = i.timeouts.RequestTimeout
+		}
+		if t, ok := i.timeouts.RouteTimeouts[route]; ok {
+			timeout = t
+		}
+	}
+
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code a handler responded with
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status, s.wroteHeader = status, true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
@@ -1,85 +1,541 @@
 package routes
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
 	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/danvixent/aboki-africa-assessment/logging"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
 	"github.com/dimfeld/httptreemux"
-	log "github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func SetupRoutes(router *httptreemux.TreeMux, h *handler.Handler) {
-	router.POST("/register", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+// SetupRoutes registers the API on mux along with the /metrics endpoint serving m and the /healthz and
+// /readyz probes answered by checker, cfg sets how long requests may take
+func SetupRoutes(mux *httptreemux.TreeMux, h *handler.Handler, m *metrics.Metrics, checker *health.Checker, cfg *config.ServerConfig) {
+	setupHealthRoutes(mux, checker)
+
+	metricsHandler := m.Handler()
+	mux.GET("/metrics", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		metricsHandler.ServeHTTP(w, r)
+	})
+
+	router := &instrumentedRouter{mux: mux, handler: h, metrics: m, timeouts: cfg}
+
+	router.POST("/register", idempotent(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
 		req := &handler.UserRequest{}
 		err := getRequestBody(r.Body, req)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to parse request body: %v", err), http.StatusBadRequest)
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
 			return
 		}
 
 		if req.Name == "" {
-			http.Error(w, "name is required", http.StatusBadRequest)
+			writeError(w, errors.InvalidField("name", "name is required"))
 			return
 		}
 
 		if req.Email == "" {
-			http.Error(w, "email is required", http.StatusBadRequest)
+			writeError(w, errors.InvalidField("email", "email is required"))
+			return
+		}
+
+		if len(req.Password) < 8 {
+			writeError(w, errors.InvalidField("password", "password must be at least 8 characters"))
 			return
 		}
 
-		logger := log.WithFields(map[string]interface{}{})
-		user, err := h.RegisterUser(context.Background(), req, logger)
+		req.IPAddress = h.ClientIP(r)
+		req.DeviceFingerprint = r.Header.Get(fraud.DeviceFingerprintHeader)
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"ip_address": req.IPAddress})
+		user, err := h.RegisterUser(r.Context(), req, logger)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
 			return
 		}
 
-		buf, err := json.Marshal(user)
+		writeJSON(w, user)
+	}))
+
+	router.POST("/login", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		req := &handler.LoginRequest{}
+		err := getRequestBody(r.Body, req)
 		if err != nil {
-			http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write(buf)
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.Login(r.Context(), req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
 	})
 
-	router.POST("/transaction", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	router.POST("/transaction", authenticated(h, idempotent(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
 		req := &handler.TransferPointsRequest{}
 		err := getRequestBody(r.Body, req)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("failed to parse request body: %v", err), http.StatusBadRequest)
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
 			return
 		}
 
-		if req.UserID == "" {
-			http.Error(w, "user id is required", http.StatusBadRequest)
+		if req.RecipientUserID == "" {
+			writeError(w, errors.InvalidField("recipient_user_id", "recipient user id is required"))
 			return
 		}
 
-		if req.RecipientUserID == "" {
-			http.Error(w, "recipient user id is required", http.StatusBadRequest)
+		if req.Points <= 0 {
+			writeError(w, errors.ErrNonPositiveTransferAmount)
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		err = h.TransferPoints(r.Context(), req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	router.POST("/topups", authenticated(h, idempotent(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		req := &handler.TopupRequest{}
+		err := getRequestBody(r.Body, req)
+		if err != nil {
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.InitializeTopup(r.Context(), req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	})))
+
+	router.POST("/topups/:reference/verify", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"reference": params["reference"]})
+		resp, err := h.VerifyTopup(r.Context(), params["reference"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/bank-accounts", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		req := &handler.BankRecipientRequest{}
+		err := getRequestBody(r.Body, req)
+		if err != nil {
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
+			return
+		}
+
+		if req.AccountNumber == "" {
+			writeError(w, errors.InvalidField("account_number", "account number is required"))
 			return
 		}
 
-		if req.Points == 0 {
-			http.Error(w, "points cannot be zero is required", http.StatusBadRequest)
+		if req.BankCode == "" {
+			writeError(w, errors.InvalidField("bank_code", "bank code is required"))
 			return
 		}
 
-		logger := log.WithFields(map[string]interface{}{})
-		err = h.TransferPoints(context.Background(), req, logger)
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.AddBankRecipient(r.Context(), req, logger)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/bank-accounts", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.ListBankRecipients(r.Context(), logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/withdrawals", authenticated(h, idempotent(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		req := &handler.WithdrawalRequest{}
+		err := getRequestBody(r.Body, req)
+		if err != nil {
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
+			return
+		}
+
+		if req.BankRecipientID == "" {
+			writeError(w, errors.InvalidField("bank_recipient_id", "bank recipient id is required"))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.RequestWithdrawal(r.Context(), req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	})))
+
+	router.GET("/withdrawals/:reference", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"reference": params["reference"]})
+		resp, err := h.GetWithdrawal(r.Context(), params["reference"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/webhooks/paystack", func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, errors.Validation("failed to read request body"))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"provider": "paystack"})
+		err = h.HandlePaystackEvent(r.Context(), body, r.Header.Get(paystack.SignatureHeader), logger)
+		if err != nil {
+			writeError(w, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 	})
+
+	router.POST("/webhooks/subscriptions", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		req := &handler.WebhookSubscriptionRequest{}
+		err := getRequestBody(r.Body, req)
+		if err != nil {
+			writeError(w, errors.Validation(fmt.Sprintf("failed to parse request body: %v", err)))
+			return
+		}
+
+		if req.URL == "" {
+			writeError(w, errors.InvalidField("url", "url is required"))
+			return
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.CreateWebhookSubscription(r.Context(), req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/webhooks/subscriptions", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.ListWebhookSubscriptions(r.Context(), logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.DELETE("/webhooks/subscriptions/:id", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"subscription_id": params["id"]})
+		err := h.DeleteWebhookSubscription(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	router.GET("/webhooks/subscriptions/:id/deliveries", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		var limit int
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil {
+				writeError(w, errors.InvalidField("limit", "limit must be a number"))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"subscription_id": params["id"]})
+		resp, err := h.ListWebhookDeliveries(r.Context(), params["id"], limit, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/webhooks/subscriptions/:id/deliveries/:delivery_id/replay", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"subscription_id": params["id"], "delivery_id": params["delivery_id"]})
+		resp, err := h.ReplayWebhookDelivery(r.Context(), params["id"], params["delivery_id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/admin/users/:id/deactivate", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"user_id": params["id"]})
+		resp, err := h.DeactivateUser(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.DELETE("/admin/users/:id", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"user_id": params["id"]})
+		resp, err := h.DeleteUser(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/admin/users/:id/restore", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"user_id": params["id"]})
+		resp, err := h.RestoreUser(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/admin/signup-checks", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		var limit int
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil {
+				writeError(w, errors.InvalidField("limit", "limit must be a number"))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.ListSignupChecks(r.Context(), r.URL.Query().Get("decision"), limit, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/admin/signup-checks/:id/release", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"signup_check_id": params["id"]})
+		resp, err := h.ReleaseHeldReferral(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.POST("/admin/signup-checks/:id/reject", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"signup_check_id": params["id"]})
+		resp, err := h.RejectHeldReferral(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/users/:id/balance", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.GetUserBalance(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/users/:id/summary", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.GetUserSummary(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/users/:id/referrals", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"user_id": params["id"]})
+		resp, err := h.GetUserReferrals(r.Context(), params["id"], logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/users/:id/referral-tree", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		var depth int
+		if d := r.URL.Query().Get("depth"); d != "" {
+			var err error
+			if depth, err = strconv.Atoi(d); err != nil {
+				writeError(w, errors.InvalidField("depth", "depth must be a number"))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{"user_id": params["id"]})
+		resp, err := h.GetUserReferralTree(r.Context(), params["id"], depth, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/leaderboard", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		query := r.URL.Query()
+		var offset, limit int
+		if o := query.Get("offset"); o != "" {
+			var err error
+			if offset, err = strconv.Atoi(o); err != nil {
+				writeError(w, errors.InvalidField("offset", "offset must be a number"))
+				return
+			}
+		}
+
+		if l := query.Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil {
+				writeError(w, errors.InvalidField("limit", "limit must be a number"))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.GetLeaderboard(r.Context(), query.Get("period"), query.Get("metric"), offset, limit, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+
+	router.GET("/users/:id/transactions", authenticated(h, func(w http.ResponseWriter, r *http.Request, params map[string]string) {
+		query := r.URL.Query()
+		req := &handler.TransactionHistoryRequest{
+			Direction: query.Get("direction"),
+			Cursor:    query.Get("cursor"),
+		}
+
+		var err error
+		if req.From, err = parseTimeParam(query.Get("from")); err != nil {
+			writeError(w, errors.InvalidField("from", "from must be an RFC3339 timestamp"))
+			return
+		}
+
+		if req.To, err = parseTimeParam(query.Get("to")); err != nil {
+			writeError(w, errors.InvalidField("to", "to must be an RFC3339 timestamp"))
+			return
+		}
+
+		if limit := query.Get("limit"); limit != "" {
+			if req.Limit, err = strconv.Atoi(limit); err != nil {
+				writeError(w, errors.InvalidField("limit", "limit must be a number"))
+				return
+			}
+		}
+
+		logger := logging.FromContext(r.Context()).WithFields(map[string]interface{}{})
+		resp, err := h.GetUserTransactions(r.Context(), params["id"], req, logger)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, resp)
+	}))
+}
+
+// writeJSON responds with data encoded as JSON and a 200 status
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		writeError(w, errors.Internal("failed to marshal response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
+
+// writeError responds with err as a {code, message, details} JSON body and its HTTP status,
+// errors that aren't an *errors.Error are reported as a generic internal error
+func writeError(w http.ResponseWriter, err error) {
+	e := errors.ToError(err)
+
+	buf, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	w.Write(buf)
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
 }
 
 func getRequestBody(respBody io.ReadCloser, data interface{}) error {
@@ -1,5 +1,10 @@
 #!/bin/bash
 set -e
 
+# no token secret is committed, a random one is used when none is set so tokens don't outlive the run
+if [ -z "$ABOKI_AUTH_TOKEN_SECRET" ] && [ -z "$ABOKI_AUTH_TOKEN_SECRET_FILE" ]; then
+  export ABOKI_AUTH_TOKEN_SECRET="$(head -c 32 /dev/urandom | od -An -tx1 | tr -d ' \n')"
+fi
+
 cd cmd
-go run main.go -config_path="../config/config.yml"
+go run . -config_path="../config/config.yml"
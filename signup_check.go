@@ -0,0 +1,56 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+// ReferralDecision is what the fraud checks made of a referred signup
+type ReferralDecision string
+
+const (
+	// ReferralAllowed referrals count towards their referrer's bonuses straight away
+	ReferralAllowed ReferralDecision = "allow"
+	// ReferralHeld referrals don't count until an admin releases them
+	ReferralHeld ReferralDecision = "hold"
+	// ReferralBlocked signups are registered without their referral
+	ReferralBlocked ReferralDecision = "block"
+)
+
+// SignupCheck records the identity signals of a registration and, for referred
+// ones, the decision the fraud checks made about the referral
+type SignupCheck struct {
+	ID                string           `json:"id"`
+	UserID            string           `json:"user_id"`
+	ReferrerID        *string          `json:"referrer_id"`
+	NormalizedEmail   string           `json:"normalized_email"` // the email without aliasing, see fraud.NormalizeEmail
+	IPAddress         string           `json:"ip_address"`
+	DeviceFingerprint string           `json:"device_fingerprint"`
+	Decision          ReferralDecision `json:"decision"`
+	Reasons           []string         `json:"reasons"`     // the rules that flagged the signup
+	ReviewedAt        *time.Time       `json:"reviewed_at"` // when an admin released or rejected a held referral
+	CreatedAt         time.Time        `json:"created_at"`
+}
+
+// SignupMatches counts earlier signups sharing a signal with a new one, empty signals match nothing
+type SignupMatches struct {
+	SameEmail  int64 // signups with the same normalized email
+	SameIP     int64
+	SameDevice int64
+}
+
+type SignupCheckRepository interface {
+	CreateSignupCheck(ctx context.Context, check *SignupCheck) error
+	FindSignupCheckByID(ctx context.Context, id string) (*SignupCheck, error)
+	// FindUserSignupCheck returns the check made when userID registered
+	FindUserSignupCheck(ctx context.Context, userID string) (*SignupCheck, error)
+	// CountSignupMatches counts the signups since since sharing a signal with check, the email is compared
+	// against every signup whenever it happened
+	CountSignupMatches(ctx context.Context, check *SignupCheck, since time.Time) (*SignupMatches, error)
+	// CountReferrerSignups counts the signups that used referrerID's code since since
+	CountReferrerSignups(ctx context.Context, referrerID string, since time.Time) (int64, error)
+	// ListSignupChecks returns the most recent checks that made decision, newest first
+	ListSignupChecks(ctx context.Context, decision ReferralDecision, limit int) ([]*SignupCheck, error)
+	// UpdateSignupCheckDecision saves the Decision and ReviewedAt of check
+	UpdateSignupCheckDecision(ctx context.Context, check *SignupCheck) error
+}
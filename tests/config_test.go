@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	pool "github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigYAML = `
+serve_port: "8081"
+postgres:
+  database: postgres
+  username: postgres
+  password: from-yaml
+  host: localhost
+  port: "5432"
+  max_conn: 3
+auth:
+  token_secret: secret
+`
+
+// writeFile writes contents to name in dir and returns its path
+func writeFile(t *testing.T, dir string, name string, contents string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.yml", testConfigYAML)
+
+	environ := []string{
+		"ABOKI_POSTGRES_HOST=db.internal",
+		"ABOKI_POSTGRES_MAX_CONN=10",
+		"ABOKI_AUTH_ADMIN_USER_IDS=a, b",
+		"ABOKI_SERVE_PORT=9000",
+		"HOME=/root",
+	}
+	args := []string{"-config_path", path, "-serve_port", "9090", "-fraud.trust_forwarded_for", "migrate", "up"}
+
+	cfg, rest, err := config.Load(args, environ)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"migrate", "up"}, rest)
+	assert.Equal(t, "9090", cfg.ServePort, "flags win over the environment")
+	assert.Equal(t, "db.internal", cfg.Postgres.Host, "the environment wins over the file")
+	assert.Equal(t, 10, cfg.Postgres.MaxConn)
+	assert.Equal(t, "postgres", cfg.Postgres.Database, "the file is used for what isn't overridden")
+	assert.Equal(t, []string{"a", "b"}, cfg.Auth.AdminUserIDs)
+	assert.True(t, cfg.Fraud.TrustForwardedFor)
+}
+
+func TestLoadConfig_ConfigPathFromEnvironment(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yml", testConfigYAML)
+
+	cfg, _, err := config.Load(nil, []string{config.ConfigPathEnv + "=" + path})
+	require.NoError(t, err)
+	assert.Equal(t, "from-yaml", cfg.Postgres.Password)
+}
+
+func TestLoadConfig_SecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.yml", testConfigYAML)
+	passwordFile := writeFile(t, dir, "password", "p@ss/w:rd?#%\n")
+	keyFile := writeFile(t, dir, "paystack", "sk_test_123\n")
+	secretFile := writeFile(t, dir, "token_secret", "from-file\n")
+
+	environ := []string{
+		"ABOKI_POSTGRES_PASSWORD_FILE=" + passwordFile,
+		"ABOKI_PAYSTACK_API_KEY_FILE=" + keyFile,
+		"ABOKI_AUTH_TOKEN_SECRET_FILE=" + secretFile,
+	}
+	cfg, _, err := config.Load([]string{"-config_path", path}, environ)
+	require.NoError(t, err)
+
+	assert.Equal(t, "p@ss/w:rd?#%", cfg.Postgres.Password, "the file wins over the password in the YAML")
+	assert.Equal(t, "sk_test_123", cfg.PaystackAPIKey)
+	assert.Equal(t, "from-file", cfg.Auth.TokenSecret)
+
+	// the DSN must survive the characters URLs give a meaning to
+	cfg.Postgres.SSLMode = "require"
+	poolConfig, err := pool.ParseConfig(cfg.Postgres.DSN())
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss/w:rd?#%", poolConfig.ConnConfig.Password)
+	assert.Equal(t, "postgres", poolConfig.ConnConfig.User)
+	assert.Equal(t, "localhost", poolConfig.ConnConfig.Host)
+	assert.Equal(t, "postgres", poolConfig.ConnConfig.Database)
+	assert.Equal(t, int32(3), poolConfig.MaxConns)
+	assert.NotNil(t, poolConfig.ConnConfig.TLSConfig)
+}
+
+func TestLoadConfig_AggregatesErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.yml", testConfigYAML+"tracing:\n  exporter: jaeger\n")
+
+	environ := []string{
+		"ABOKI_POSTGRES_PASWORD=typo",
+		"ABOKI_POSTGRES_MAX_CONN=many",
+		"ABOKI_POSTGRES_PASSWORD_FILE=" + filepath.Join(dir, "missing"),
+	}
+	_, _, err := config.Load([]string{"-config_path", path, "-postgres.sslmode", "always", "-serve_port", "0"}, environ)
+	require.Error(t, err)
+
+	errs, ok := err.(config.Errors)
+	require.True(t, ok, "expected config.Errors, got %T", err)
+	assert.Len(t, errs, 6)
+	for _, want := range []string{
+		"ABOKI_POSTGRES_PASWORD: no such setting",
+		"ABOKI_POSTGRES_MAX_CONN: invalid integer",
+		"postgres.password_file:",
+		"serve_port:",
+		"postgres.sslmode:",
+		"tracing.exporter:",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestLoadConfig_RejectsUnknownYAMLFields(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "config.yml", testConfigYAML+"postgress:\n  host: typo\n")
+
+	_, _, err := config.Load([]string{"-config_path", path}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "postgress")
+}
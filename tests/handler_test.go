@@ -1,16 +1,18 @@
+//go:build integration
+// +build integration
+
 package tests
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"net/http"
+	"testing"
+
 	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
 	"github.com/danvixent/aboki-africa-assessment/handler"
 	"github.com/stretchr/testify/assert"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"testing"
 )
 
 func TestRegisterUser(t *testing.T) {
@@ -43,6 +45,7 @@ func TestRegisterUser(t *testing.T) {
 			requestBody: &handler.UserRequest{
 				Name:         "Daniel",
 				Email:        "daniel@gmail.com",
+				Password:     "password",
 				ReferralCode: &user1.ReferralCode,
 			},
 			checkData: true,
@@ -52,6 +55,7 @@ func TestRegisterUser(t *testing.T) {
 			requestBody: &handler.UserRequest{
 				Name:         "Dave",
 				Email:        "daniel1@gmail.com",
+				Password:     "password",
 				ReferralCode: &user1.ReferralCode,
 			},
 			wantCode: http.StatusOK,
@@ -60,6 +64,7 @@ func TestRegisterUser(t *testing.T) {
 			requestBody: &handler.UserRequest{
 				Name:         "West",
 				Email:        "daniel2@gmail.com",
+				Password:     "password",
 				ReferralCode: &user1.ReferralCode,
 			},
 			checkData: true,
@@ -69,6 +74,7 @@ func TestRegisterUser(t *testing.T) {
 			requestBody: &handler.UserRequest{
 				Name:         "",
 				Email:        "daniel1@gmail.com",
+				Password:     "password",
 				ReferralCode: &user1.ReferralCode,
 			},
 			checkData: false,
@@ -194,8 +200,7 @@ func TestTransaction(t *testing.T) {
 			return
 		}
 
-		resp, err := transaction(&handler.TransferPointsRequest{
-			UserID:          test.user.ID,
+		resp, err := transaction(tokenFor(test.user.ID), &handler.TransferPointsRequest{
 			RecipientUserID: user1.ID,
 			Points:          210,
 		})
@@ -217,50 +222,164 @@ func TestTransaction(t *testing.T) {
 	assert.EqualValues(t, 50, pp)
 }
 
-func getResponseBody(respBody io.ReadCloser, data interface{}) error {
-	buf, err := ioutil.ReadAll(respBody)
-	if err != nil {
-		return err
+func TestTransactionIdempotency(t *testing.T) {
+	err := deleteAllFromTable("idempotency_keys")
+	if !assert.NoError(t, err) {
+		return
 	}
 
-	fmt.Printf("response body: %+v", string(buf))
-	if err = json.Unmarshal(buf, data); err != nil {
-		return err
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
 	}
 
-	return nil
-}
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := &handler.TransferPointsRequest{
+		RecipientUserID: recipient.ID,
+		Points:          30,
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	pp, err := testHandler.userPointRepository.GetUserPointsBalance(context.Background(), sender.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, 70, pp)
 
-func registerUser(req *handler.UserRequest) (*http.Response, error) {
-	return http.Post(url+"/register", "application/json", serialize(req))
+	req.Points = 40
+	resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
 }
 
-func transaction(req *handler.TransferPointsRequest) (*http.Response, error) {
-	return http.Post(url+"/transaction", "application/json", serialize(req))
+func TestConcurrentTransactions(t *testing.T) {
+	sender, err := seedOneUser("Sender", "concurrent.sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "concurrent.recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	codes := concurrentTransactions(tokenFor(sender.ID), &handler.TransferPointsRequest{
+		RecipientUserID: recipient.ID,
+		Points:          30,
+	}, 10)
+
+	// only three transfers of 30 fit in a balance of 100, the rest must not overdraw it
+	succeeded := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+			continue
+		}
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	}
+	assert.Equal(t, 3, succeeded)
+
+	pp, err := testHandler.userPointRepository.GetUserPointsBalance(context.Background(), sender.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, 10, pp)
 }
 
-func seedOneUser(name string, email string) (*app.User, error) {
-	user := &app.User{
-		Name:         name,
-		Email:        email,
-		ReferralCode: handler.GenReferralCode(6),
+func TestCreateUserDuplicates(t *testing.T) {
+	ctx := context.Background()
+
+	existing, err := seedOneUser("Existing", "existing@gmail.com")
+	if !assert.NoError(t, err) {
+		return
 	}
 
-	err := testHandler.userRepository.CreateUser(context.Background(), user)
-	if err != nil {
-		return nil, err
+	// a taken referral code doesn't abort the transaction, another one can be tried in it
+	user := &app.User{Name: "New", Email: "new@gmail.com", ReferralCode: existing.ReferralCode}
+	err = testClient.RunInTx(ctx, func(ctx context.Context) error {
+		if err := testHandler.userRepository.CreateUser(ctx, user); !errors.Is(err, errors.ErrDuplicateReferralCode) {
+			return fmt.Errorf("expected a duplicate referral code, got %v", err)
+		}
+
+		user.ReferralCode = handler.GenReferralCode(6)
+		return testHandler.userRepository.CreateUser(ctx, user)
+	})
+	if !assert.NoError(t, err) {
+		return
 	}
-	return user, nil
+	assert.NotEmpty(t, user.ID)
+
+	err = testHandler.userRepository.CreateUser(ctx, &app.User{Name: "Other", Email: existing.Email, ReferralCode: handler.GenReferralCode(6)})
+	assert.True(t, errors.Is(err, errors.ErrEmailTaken), "got %v", err)
 }
 
-func seedPointBalanceForUser(userID string, points int64) (*app.UserPoints, error) {
-	p := &app.UserPoints{
-		UserID: userID,
-		Points: points,
+func TestCreateReferredUserTransactionBonusDuplicate(t *testing.T) {
+	ctx := context.Background()
+
+	referrer, err := seedOneUser("Referrer", "bonus-referrer@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	referee, err := seedOneUser("Referee", "bonus-referee@gmail.com")
+	if !assert.NoError(t, err) {
+		return
 	}
-	err := testHandler.userPointRepository.CreateUserPoint(context.Background(), p)
-	if err != nil {
-		return nil, err
+
+	// the duplicate doesn't abort the transaction, the bonus created before it is still committed
+	err = testClient.RunInTx(ctx, func(ctx context.Context) error {
+		bonus := &app.ReferredUserTransactionBonus{ReferrerID: referrer.ID, RefereeID: referee.ID}
+		if err := testHandler.userReferralRepository.CreateReferredUserTransactionBonus(ctx, bonus); err != nil {
+			return err
+		}
+
+		duplicate := &app.ReferredUserTransactionBonus{ReferrerID: referrer.ID, RefereeID: referee.ID}
+		if err := testHandler.userReferralRepository.CreateReferredUserTransactionBonus(ctx, duplicate); !errors.Is(err, errors.ErrDuplicate) {
+			return fmt.Errorf("expected a duplicate bonus, got %v", err)
+		}
+
+		_, err := testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrer.ID, 10)
+		return err
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	bonuses, err := testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrer.ID, 10)
+	if assert.NoError(t, err) {
+		assert.Len(t, bonuses, 1)
 	}
-	return p, nil
 }
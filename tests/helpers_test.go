@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	log "github.com/sirupsen/logrus"
+)
+
+type TestHandler struct {
+	userRepository         app.UserRepository
+	userReferralRepository app.UserReferralRepository
+	userPointRepository    app.UserPointRepository
+	ledgerRepository       app.LedgerRepository
+	idempotencyRepository  app.IdempotencyRepository
+	signupCheckRepository  app.SignupCheckRepository
+	leaderboardRepository  app.LeaderboardRepository
+	tokenIssuer            *auth.TokenIssuer
+	healthChecker          *health.Checker
+	dispatcher             *outbox.Dispatcher
+}
+
+var testHandler *TestHandler
+
+var paystackServer *fakePaystack
+
+// serialize obj into json bytes
+func serialize(obj interface{}) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(obj); err != nil {
+		log.Fatalf("unable to serialize obj: %v", err)
+	}
+	return buf
+}
+
+func getResponseBody(respBody io.ReadCloser, data interface{}) error {
+	buf, err := ioutil.ReadAll(respBody)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(buf, data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func registerUser(req *handler.UserRequest) (*http.Response, error) {
+	return http.Post(url+"/register", "application/json", serialize(req))
+}
+
+// registerUserFrom registers req as if it was sent from ip on the device with fingerprint
+func registerUserFrom(ip string, fingerprint string, req *handler.UserRequest) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodPost, url+"/register", serialize(req))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("X-Forwarded-For", ip)
+	r.Header.Set(fraud.DeviceFingerprintHeader, fingerprint)
+	return http.DefaultClient.Do(r)
+}
+
+func login(req *handler.LoginRequest) (*http.Response, error) {
+	return http.Post(url+"/login", "application/json", serialize(req))
+}
+
+// transaction transfers points from the user token was issued to
+func transaction(token string, req *handler.TransferPointsRequest) (*http.Response, error) {
+	return idempotentTransaction(token, "", req)
+}
+
+func idempotentTransaction(token string, key string, req *handler.TransferPointsRequest) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodPost, url+"/transaction", serialize(req))
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(r)
+}
+
+// concurrentTransactions sends n copies of req at once and returns the status codes they got
+func concurrentTransactions(token string, req *handler.TransferPointsRequest, n int) []int {
+	codes := make([]int, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := transaction(token, req)
+			if err != nil {
+				log.Errorf("transaction failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			codes[i] = resp.StatusCode
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+// authenticatedGet requests path as the user token was issued to
+func authenticatedGet(token string, path string) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodGet, url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(r)
+}
+
+// authenticatedPost posts body as JSON to path as the user token was issued to
+func authenticatedPost(token string, path string, body interface{}) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodPost, url+path, serialize(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(r)
+}
+
+// authenticatedDelete deletes path as the user token was issued to
+func authenticatedDelete(token string, path string) (*http.Response, error) {
+	r, err := http.NewRequest(http.MethodDelete, url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(r)
+}
+
+// tokenFor issues a bearer token for userID
+func tokenFor(userID string) string {
+	token, _, err := testHandler.tokenIssuer.Issue(userID)
+	if err != nil {
+		log.Fatalf("unable to issue token: %v", err)
+	}
+	return token
+}
+
+func seedOneUser(name string, email string) (*app.User, error) {
+	user := &app.User{
+		Name:         name,
+		Email:        email,
+		ReferralCode: handler.GenReferralCode(6),
+	}
+
+	err := testHandler.userRepository.CreateUser(context.Background(), user)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func seedPointBalanceForUser(userID string, points int64) (*app.UserPoints, error) {
+	p := &app.UserPoints{
+		UserID: userID,
+		Points: points,
+	}
+	err := testHandler.userPointRepository.CreateUserPoint(context.Background(), p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -1,58 +1,108 @@
+//go:build integration
+// +build integration
+
 package tests
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	app "github.com/danvixent/aboki-africa-assessment"
 	"github.com/danvixent/aboki-africa-assessment/routes"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/danvixent/aboki-africa-assessment/auth"
 	"github.com/danvixent/aboki-africa-assessment/config"
 	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
 	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/referral"
 	"github.com/dimfeld/httptreemux"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v2"
 )
 
 var url = "http://localhost:%s"
 
-type TestHandler struct {
-	userRepository         app.UserRepository
-	userReferralRepository app.UserReferralRepository
-	userPointRepository    app.UserPointRepository
-	client                 *postgres.Client
-}
-
-var testHandler *TestHandler
+var testClient *postgres.Client
 
 func TestMain(m *testing.M) {
-	file, err := os.Open("../config/config.yml")
+	cfg, _, err := config.Load([]string{"-config_path", "../config/config.yml", "-auth.token_secret", "test-secret"}, os.Environ())
 	if err != nil {
-		log.Fatalf("unable to open config file: %v", err)
+		log.Fatalf("failed to load config: %v", err)
 	}
 
-	cfg := &config.BaseConfig{}
-	err = yaml.NewDecoder(file).Decode(cfg)
+	postgresClient := postgres.New(context.Background(), cfg.Postgres)
+	serviceMetrics := metrics.New()
+	postgresClient.RegisterMetrics(serviceMetrics.Registry)
+	userRepo := metrics.InstrumentUserRepository(postgres.NewUserRepository(postgresClient), serviceMetrics)
+	userReferralRepo := metrics.InstrumentUserReferralRepository(postgres.NewUserReferralRepository(postgresClient), serviceMetrics)
+	userPointsRepo := metrics.InstrumentUserPointRepository(postgres.NewUserPointsRepository(postgresClient), serviceMetrics)
+	ledgerRepo := postgres.NewLedgerRepository(postgresClient)
+	idempotencyRepo := postgres.NewIdempotencyRepository(postgresClient)
+	topupRepo := postgres.NewTopupRepository(postgresClient)
+	webhookEventRepo := postgres.NewWebhookEventRepository(postgresClient)
+	bankRecipientRepo := postgres.NewBankRecipientRepository(postgresClient)
+	withdrawalRepo := postgres.NewWithdrawalRepository(postgresClient)
+	outboxRepo := postgres.NewOutboxRepository(postgresClient)
+	webhookSubscriptionRepo := postgres.NewWebhookSubscriptionRepository(postgresClient)
+	webhookDeliveryRepo := postgres.NewWebhookDeliveryRepository(postgresClient)
+	signupCheckRepo := postgres.NewSignupCheckRepository(postgresClient)
+	leaderboardRepo := postgres.NewLeaderboardRepository(postgresClient)
+
+	program, err := referral.NewProgram(cfg.ReferralProgram)
 	if err != nil {
-		log.Fatalf("failed to decode config file: %v", err)
+		log.Fatalf("invalid referral program: %v", err)
 	}
 
-	postgresClient := postgres.New(context.Background(), cfg.Postgres)
-	userRepo := postgres.NewUserRepository(postgresClient)
-	userReferralRepo := postgres.NewUserReferralRepository(postgresClient)
-	userPointsRepo := postgres.NewUserPointsRepository(postgresClient)
+	tokenIssuer := auth.NewTokenIssuer("test-secret", time.Hour)
+	paystackServer = newFakePaystack()
+	paystackClient := paystack.NewClient(testPaystackKey, paystackServer.URL)
+
+	h := handler.NewHandler(handler.Dependencies{
+		UserRepository:                userRepo,
+		UserReferralRepository:        userReferralRepo,
+		UserPointRepository:           userPointsRepo,
+		LedgerRepository:              ledgerRepo,
+		IdempotencyRepository:         idempotencyRepo,
+		TopupRepository:               topupRepo,
+		WebhookEventRepository:        webhookEventRepo,
+		BankRecipientRepository:       bankRecipientRepo,
+		WithdrawalRepository:          withdrawalRepo,
+		OutboxRepository:              outboxRepo,
+		WebhookSubscriptionRepository: webhookSubscriptionRepo,
+		WebhookDeliveryRepository:     webhookDeliveryRepo,
+		SignupCheckRepository:         signupCheckRepo,
+		LeaderboardRepository:         leaderboardRepo,
+		ReferralProgram:               program,
+		FraudChecker:                  fraud.NewChecker(signupCheckRepo, cfg.Fraud),
+		TokenIssuer:                   tokenIssuer,
+		PaystackClient:                paystackClient,
+		RunInTx:                       metrics.InstrumentTxRunner(postgresClient.RunInTx),
+	}, handler.Options{
+		PointPrice:   100,
+		Withdrawals:  cfg.Withdrawals,
+		Webhooks:     cfg.Webhooks,
+		Idempotency:  cfg.Idempotency,
+		AdminUserIDs: cfg.Auth.AdminUserIDs,
+	})
+
+	migrator, err := postgres.NewMigrator(postgresClient)
+	if err != nil {
+		log.Fatalf("failed to create migrator: %v", err)
+	}
 
-	h := handler.NewHandler(userRepo, userReferralRepo, userPointsRepo, postgresClient.BeginTx)
+	checker := health.NewChecker(cfg.Health)
+	checker.Add("postgres", health.PingCheck(postgresClient))
+	checker.Add("migrations", health.MigrationCheck(migrator))
+	checker.Add("outbox", health.OutboxCheck(outboxRepo, nil, 0))
 
 	router := httptreemux.New()
 
-	routes.SetupRoutes(router, h)
+	routes.SetupRoutes(router, h, serviceMetrics, checker, cfg.Server)
 
 	url = fmt.Sprintf(url, cfg.ServePort)
 	srv := &http.Server{
@@ -73,29 +123,28 @@ func TestMain(m *testing.M) {
 		userRepository:         userRepo,
 		userReferralRepository: userReferralRepo,
 		userPointRepository:    userPointsRepo,
-		client:                 postgresClient,
+		ledgerRepository:       ledgerRepo,
+		idempotencyRepository:  idempotencyRepo,
+		signupCheckRepository:  signupCheckRepo,
+		leaderboardRepository:  leaderboardRepo,
+		tokenIssuer:            tokenIssuer,
+		healthChecker:          checker,
 	}
+	testClient = postgresClient
 	// run the tests
 	code := m.Run()
 
-	ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("unable to shutdown server gracefully: %v", err)
 	}
+	paystackServer.Close()
 
 	os.Exit(code)
 }
 
-// serialize obj into json bytes
-func serialize(obj interface{}) *bytes.Buffer {
-	buf := &bytes.Buffer{}
-	if err := json.NewEncoder(buf).Encode(obj); err != nil {
-		log.Fatalf("unable to serialize obj: %v", err)
-	}
-	return buf
-}
-
 func deleteAllFromTable(name string) error {
-	_, err := testHandler.client.Exec(context.Background(), fmt.Sprintf("DELETE FROM %s", name))
+	_, err := testClient.Exec(context.Background(), fmt.Sprintf("DELETE FROM %s", name))
 	return err
 }
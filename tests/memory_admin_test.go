@@ -0,0 +1,116 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserLifecycle(t *testing.T) {
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	referrer, err := seedOneUser("Referrer", "referrer@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(referrer.ID, 100); !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := registerUser(&handler.UserRequest{
+		Name:         "Daniel",
+		Email:        "dan@gmail.com",
+		Password:     "correct horse",
+		ReferralCode: &referrer.ReferralCode,
+	})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	user := &app.User{}
+	if !assert.NoError(t, getResponseBody(resp.Body, user)) {
+		return
+	}
+
+	resp, err = transaction(tokenFor(referrer.ID), &handler.TransferPointsRequest{RecipientUserID: user.ID, Points: 50})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	// only configured admins manage accounts
+	resp, err = authenticatedPost(tokenFor(referrer.ID), "/admin/users/"+user.ID+"/deactivate", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	admin := tokenFor(testAdminID)
+	resp, err = authenticatedPost(admin, "/admin/users/"+user.ID+"/deactivate", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	resp, err = login(&handler.LoginRequest{Email: "dan@gmail.com", Password: "correct horse"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	// points can't leave nor reach a deactivated account
+	resp, err = transaction(tokenFor(user.ID), &handler.TransferPointsRequest{RecipientUserID: referrer.ID, Points: 10})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	resp, err = transaction(tokenFor(referrer.ID), &handler.TransferPointsRequest{RecipientUserID: user.ID, Points: 10})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+	assertBalance(t, user.ID, 50)
+	assertBalance(t, referrer.ID, 50)
+
+	// deleting the user takes their unpaid referral away from the referrer, the balance stays
+	resp, err = authenticatedDelete(admin, "/admin/users/"+user.ID)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	_, err = testHandler.userRepository.FindUserByID(ctx, user.ID)
+	assert.True(t, errors.Is(err, pgx.ErrNoRows))
+
+	count, err := testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), count)
+	}
+
+	resp, err = authenticatedPost(admin, "/admin/users/"+user.ID+"/restore", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	count, err = testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1), count)
+	}
+
+	resp, err = login(&handler.LoginRequest{Email: "dan@gmail.com", Password: "correct horse"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = transaction(tokenFor(user.ID), &handler.TransferPointsRequest{RecipientUserID: referrer.ID, Points: 10})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assertBalance(t, user.ID, 40)
+	assertBalance(t, referrer.ID, 60)
+}
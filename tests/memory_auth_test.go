@@ -0,0 +1,65 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLoginAndTransfer(t *testing.T) {
+	setupMemoryServer(t)
+
+	resp, err := registerUser(&handler.UserRequest{
+		Name:     "Daniel",
+		Email:    "dan@gmail.com",
+		Password: "correct horse",
+	})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	resp, err = login(&handler.LoginRequest{Email: "dan@gmail.com", Password: "wrong horse"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp, err = login(&handler.LoginRequest{Email: "dan@gmail.com", Password: "correct horse"})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	session := &handler.LoginResponse{}
+	if !assert.NoError(t, getResponseBody(resp.Body, session)) {
+		return
+	}
+	assert.NotEmpty(t, session.Token)
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := &handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 10}
+
+	// points always leave the account of the token's owner, who has none to send
+	resp, err = transaction(session.Token, req)
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	}
+	assertBalance(t, recipient.ID, 100)
+
+	resp, err = transaction("forged.token", req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
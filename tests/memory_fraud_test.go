@@ -0,0 +1,280 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryReferralFraudChecks(t *testing.T) {
+	setupMemoryServer(t)
+	ctx := context.Background()
+	admin := tokenFor(testAdminID)
+
+	resp, err := registerUserFrom("10.0.0.1", "referrer-phone", &handler.UserRequest{
+		Name:     "Daniel",
+		Email:    "Dan.Iel@gmail.com",
+		Password: "password",
+	})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	referrer := &app.User{}
+	if !assert.NoError(t, getResponseBody(resp.Body, referrer)) {
+		return
+	}
+
+	signups := []struct {
+		ip, fingerprint, email string
+		decision               app.ReferralDecision
+		reason                 string
+	}{
+		// an alias of the referrer's own mailbox, and a new address on the referrer's phone
+		{"10.0.0.2", "laptop", "daniel+bonus@googlemail.com", app.ReferralBlocked, fraud.SelfReferral},
+		{"10.0.0.3", "referrer-phone", "someone.else@gmail.com", app.ReferralBlocked, fraud.SelfReferral},
+		// one device registering over and over
+		{"10.0.1.1", "farm", "farm1@gmail.com", app.ReferralAllowed, ""},
+		{"10.0.1.2", "farm", "farm2@gmail.com", app.ReferralAllowed, ""},
+		{"10.0.1.3", "farm", "farm3@gmail.com", app.ReferralHeld, fraud.RepeatedDevice},
+		// the code was used five times within the hour
+		{"10.0.2.1", "tablet", "late@gmail.com", app.ReferralHeld, fraud.SignupBurst},
+	}
+
+	checks := map[string]*app.SignupCheck{}
+	for _, s := range signups {
+		resp, err = registerUserFrom(s.ip, s.fingerprint, &handler.UserRequest{
+			Name:         "Referee",
+			Email:        s.email,
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode, s.email) {
+			return
+		}
+
+		user := &app.User{}
+		if !assert.NoError(t, getResponseBody(resp.Body, user)) {
+			return
+		}
+
+		check, err := testHandler.signupCheckRepository.FindUserSignupCheck(ctx, user.ID)
+		if !assert.NoError(t, err) {
+			return
+		}
+		checks[s.email] = check
+
+		assert.Equal(t, s.decision, check.Decision, s.email)
+		if s.reason != "" {
+			assert.Contains(t, check.Reasons, s.reason, s.email)
+		}
+	}
+
+	// held and blocked referrals don't count towards the signup bonus
+	count, err := testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), count)
+	}
+
+	resp, err = authenticatedGet(tokenFor(referrer.ID), "/admin/signup-checks")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	resp, err = authenticatedGet(admin, "/admin/signup-checks?decision=hold")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	held := []*app.SignupCheck{}
+	if assert.NoError(t, getResponseBody(resp.Body, &held)) {
+		assert.Len(t, held, 2)
+	}
+
+	// releasing the third referral completes the batch and pays the referrer
+	farm3 := checks["farm3@gmail.com"]
+	resp, err = authenticatedPost(admin, "/admin/signup-checks/"+farm3.ID+"/release", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	assertBalance(t, referrer.ID, 50)
+
+	resp, err = authenticatedPost(admin, "/admin/signup-checks/"+farm3.ID+"/reject", nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	}
+
+	late := checks["late@gmail.com"]
+	resp, err = authenticatedPost(admin, "/admin/signup-checks/"+late.ID+"/reject", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	_, err = testHandler.userReferralRepository.GetUserReferrer(ctx, late.UserID)
+	assert.Error(t, err)
+
+	count, err = testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(0), count)
+	}
+}
+
+func TestMemoryHeldReferralTransactionBonus(t *testing.T) {
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	resp, err := registerUserFrom("10.0.0.1", "referrer-phone", &handler.UserRequest{Name: "Daniel", Email: "daniel@gmail.com", Password: "password"})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	referrer := &app.User{}
+	if !assert.NoError(t, getResponseBody(resp.Body, referrer)) {
+		return
+	}
+
+	funder, err := seedOneUser("Funder", "funder@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(funder.ID, 1000); !assert.NoError(t, err) {
+		return
+	}
+
+	// the third referee registers from the same device as the first two, so their referral is held
+	var check *app.SignupCheck
+	for i := 1; i <= 3; i++ {
+		resp, err = registerUserFrom(fmt.Sprintf("10.0.1.%d", i), "farm", &handler.UserRequest{
+			Name:         "Referee",
+			Email:        fmt.Sprintf("farm%d@gmail.com", i),
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		referee := &app.User{}
+		if !assert.NoError(t, getResponseBody(resp.Body, referee)) {
+			return
+		}
+
+		if check, err = testHandler.signupCheckRepository.FindUserSignupCheck(ctx, referee.ID); !assert.NoError(t, err) {
+			return
+		}
+
+		resp, err = transaction(tokenFor(funder.ID), &handler.TransferPointsRequest{RecipientUserID: referee.ID, Points: 210})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = transaction(tokenFor(referee.ID), &handler.TransferPointsRequest{RecipientUserID: funder.ID, Points: 210})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			return
+		}
+	}
+	assert.Equal(t, app.ReferralHeld, check.Decision)
+
+	// the held referee's bonus is recorded, it isn't paid while the referral is held
+	assertBalance(t, referrer.ID, 0)
+	pending, err := testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrer.ID, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, pending, 2)
+	}
+
+	// releasing the referral completes both the signup and the transaction batch
+	resp, err = authenticatedPost(tokenFor(testAdminID), "/admin/signup-checks/"+check.ID+"/release", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	assertBalance(t, referrer.ID, 100)
+
+	pending, err = testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(ctx, referrer.ID, 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, pending)
+	}
+}
+
+func TestMemoryFraudChecks_SpoofedForwardedFor(t *testing.T) {
+	previous := testFraud
+	testFraud = &config.FraudConfig{TrustForwardedFor: true, MaxSignupsPerIP: 2}
+	t.Cleanup(func() { testFraud = previous })
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	resp, err := registerUserFrom("10.0.0.1", "referrer-phone", &handler.UserRequest{
+		Name:     "Daniel",
+		Email:    "daniel@gmail.com",
+		Password: "password",
+	})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	referrer := &app.User{}
+	if !assert.NoError(t, getResponseBody(resp.Body, referrer)) {
+		return
+	}
+
+	// a new address is made up for every signup, the proxy appends the one it really came from
+	decisions := []app.ReferralDecision{app.ReferralAllowed, app.ReferralAllowed, app.ReferralHeld}
+	for i, decision := range decisions {
+		spoofed := fmt.Sprintf("1.2.3.%d, 10.0.9.9", i+4)
+		resp, err = registerUserFrom(spoofed, fmt.Sprintf("device-%d", i), &handler.UserRequest{
+			Name:         "Referee",
+			Email:        fmt.Sprintf("referee%d@gmail.com", i),
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		user := &app.User{}
+		if !assert.NoError(t, getResponseBody(resp.Body, user)) {
+			return
+		}
+
+		check, err := testHandler.signupCheckRepository.FindUserSignupCheck(ctx, user.ID)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "10.0.9.9", check.IPAddress)
+		assert.Equal(t, decision, check.Decision, spoofed)
+	}
+}
+
+func TestFraudClientIP(t *testing.T) {
+	request := func(forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:4321"
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return r
+	}
+
+	untrusted := fraud.NewChecker(nil, nil)
+	assert.Equal(t, "192.0.2.1", untrusted.ClientIP(request("1.2.3.4")))
+
+	oneProxy := fraud.NewChecker(nil, &config.FraudConfig{TrustForwardedFor: true})
+	assert.Equal(t, "10.0.0.7", oneProxy.ClientIP(request("1.2.3.4, 10.0.0.7")))
+	assert.Equal(t, "10.0.0.7", oneProxy.ClientIP(request("1.2.3.4", "10.0.0.7")))
+	assert.Equal(t, "192.0.2.1", oneProxy.ClientIP(request()))
+
+	twoProxies := fraud.NewChecker(nil, &config.FraudConfig{TrustForwardedFor: true, TrustedProxies: 2})
+	assert.Equal(t, "10.0.0.7", twoProxies.ClientIP(request("1.2.3.4, 10.0.0.7, 172.16.0.1")))
+	assert.Equal(t, "10.0.0.7", twoProxies.ClientIP(request("10.0.0.7")))
+}
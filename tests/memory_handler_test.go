@@ -0,0 +1,650 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/idempotency"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRegisterUserReferralBonus(t *testing.T) {
+	setupMemoryServer(t)
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	emails := []string{"daniel@gmail.com", "daniel1@gmail.com", "daniel2@gmail.com"}
+	for _, email := range emails {
+		resp, err := registerUser(&handler.UserRequest{
+			Name:         "Referee",
+			Email:        email,
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body := &app.User{}
+		if !assert.NoError(t, getResponseBody(resp.Body, body)) {
+			return
+		}
+		assert.NotEmpty(t, body.ID)
+		assert.Equal(t, email, body.Email)
+	}
+
+	assertBalance(t, referrer.ID, 50)
+
+	resp, err := registerUser(&handler.UserRequest{Email: "noname@gmail.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	unknown := "NOPE00"
+	resp, err = registerUser(&handler.UserRequest{
+		Name:         "Referee",
+		Email:        "unknown@gmail.com",
+		Password:     "password",
+		ReferralCode: &unknown,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body := &errors.Error{}
+	if !assert.NoError(t, getResponseBody(resp.Body, body)) {
+		return
+	}
+	assert.Equal(t, errors.CodeValidation, body.Code)
+	assert.Equal(t, "referral_code", body.Details["field"])
+}
+
+func TestMemoryRegisterUserReferralBonusBacklog(t *testing.T) {
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a backlog past the batch size, like held referrals being released or the batch size being lowered leave
+	for _, email := range []string{"a@gmail.com", "b@gmail.com", "c@gmail.com", "d@gmail.com", "e@gmail.com"} {
+		referee, err := seedOneUser("Referee", email)
+		if !assert.NoError(t, err) {
+			return
+		}
+		err = testHandler.userReferralRepository.CreateUserReferral(ctx, &app.UserReferral{ReferrerID: referrer.ID, RefereeID: referee.ID})
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	register := func(email string) {
+		resp, err := registerUser(&handler.UserRequest{Name: "Referee", Email: email, Password: "password", ReferralCode: &referrer.ReferralCode})
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+		}
+	}
+
+	// six pending referrals are two full batches
+	register("f@gmail.com")
+	assertBalance(t, referrer.ID, 100)
+
+	pending, err := testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, pending)
+	}
+
+	// a referral short of a batch stays pending
+	register("g@gmail.com")
+	assertBalance(t, referrer.ID, 100)
+
+	pending, err = testHandler.userReferralRepository.GetUnpaidUserReferralCount(ctx, referrer.ID)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 1, pending)
+	}
+}
+
+func TestMemoryRegisterUserDuplicates(t *testing.T) {
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	existing, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = testHandler.userRepository.CreateUser(ctx, &app.User{Name: "New", Email: "new@gmail.com", ReferralCode: existing.ReferralCode})
+	assert.True(t, errors.Is(err, errors.ErrDuplicateReferralCode), "got %v", err)
+
+	err = testHandler.userRepository.CreateUser(ctx, &app.User{Name: "New", Email: existing.Email, ReferralCode: handler.GenReferralCode(6)})
+	assert.True(t, errors.Is(err, errors.ErrEmailTaken), "got %v", err)
+
+	resp, err := registerUser(&handler.UserRequest{Name: "Daniel", Email: existing.Email, Password: "password"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	body := &errors.Error{}
+	if assert.NoError(t, getResponseBody(resp.Body, body)) {
+		assert.Equal(t, errors.ErrEmailTaken.Message, body.Message)
+	}
+}
+
+func TestMemoryTransactionReferralBonus(t *testing.T) {
+	setupMemoryServer(t)
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	emails := []string{"da@gmail.com", "danny@gmail.com", "danboy@gmail.com"}
+	for i, email := range emails {
+		referee, err := seedOneUser("Referee", email)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		_, err = seedPointBalanceForUser(referee.ID, 4000)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		err = testHandler.userReferralRepository.CreateUserReferral(context.Background(), &app.UserReferral{
+			ReferrerID: referrer.ID,
+			RefereeID:  referee.ID,
+			PaidOut:    true,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		resp, err := transaction(tokenFor(referee.ID), &handler.TransferPointsRequest{
+			RecipientUserID: recipient.ID,
+			Points:          210,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assertBalance(t, referee.ID, 3790)
+
+		// the bonus is only paid once the third referee qualifies
+		if i < len(emails)-1 {
+			assertBalance(t, referrer.ID, 0)
+		}
+	}
+
+	assertBalance(t, referrer.ID, 50)
+	assertBalance(t, recipient.ID, 630)
+}
+
+func TestMemoryTransactionReferralBonusBacklog(t *testing.T) {
+	setupMemoryServer(t)
+	admin := tokenFor(testAdminID)
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	qualify := func(email string) {
+		referee, err := seedOneUser("Referee", email)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		_, err = seedPointBalanceForUser(referee.ID, 1000)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		err = testHandler.userReferralRepository.CreateUserReferral(context.Background(), &app.UserReferral{ReferrerID: referrer.ID, RefereeID: referee.ID, PaidOut: true})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		resp, err := transaction(tokenFor(referee.ID), &handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 210})
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}
+
+	// the bonuses of referees qualifying while their referrer is deactivated or deleted are kept for later
+	resp, err := authenticatedPost(admin, "/admin/users/"+referrer.ID+"/deactivate", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		qualify(fmt.Sprintf("referee%d@gmail.com", i))
+	}
+
+	resp, err = authenticatedDelete(admin, "/admin/users/"+referrer.ID)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	for i := 3; i < 6; i++ {
+		qualify(fmt.Sprintf("referee%d@gmail.com", i))
+	}
+	assertBalance(t, referrer.ID, 0)
+
+	pending, err := testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(context.Background(), referrer.ID, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, pending, 6)
+	}
+
+	resp, err = authenticatedPost(admin, "/admin/users/"+referrer.ID+"/restore", nil)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	// the next referee to qualify releases both full batches, the bonus left over waits for the next one
+	qualify("referee6@gmail.com")
+	assertBalance(t, referrer.ID, 100)
+
+	pending, err = testHandler.userReferralRepository.GetUnpaidReferredUserTransactionBonus(context.Background(), referrer.ID, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, pending, 1)
+	}
+}
+
+func TestMemoryTransactionInsufficientFunds(t *testing.T) {
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := transaction(tokenFor(sender.ID), &handler.TransferPointsRequest{
+		RecipientUserID: recipient.ID,
+		Points:          20,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	body := &errors.Error{}
+	if !assert.NoError(t, getResponseBody(resp.Body, body)) {
+		return
+	}
+	assert.Equal(t, errors.CodeInsufficientFunds, body.Code)
+
+	assertBalance(t, sender.ID, 10)
+	assertBalance(t, recipient.ID, 0)
+}
+
+func TestMemoryConcurrentTransactions(t *testing.T) {
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	codes := concurrentTransactions(tokenFor(sender.ID), &handler.TransferPointsRequest{
+		RecipientUserID: recipient.ID,
+		Points:          30,
+	}, 10)
+
+	// only three transfers of 30 fit in a balance of 100, the rest must not overdraw it
+	succeeded := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+			continue
+		}
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	}
+	assert.Equal(t, 3, succeeded)
+
+	assertBalance(t, sender.ID, 10)
+	assertBalance(t, recipient.ID, 90)
+}
+
+func TestMemoryTransactionIdempotency(t *testing.T) {
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := &handler.TransferPointsRequest{
+		RecipientUserID: recipient.ID,
+		Points:          30,
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	assertBalance(t, sender.ID, 70)
+	assertBalance(t, recipient.ID, 30)
+
+	req.Points = 40
+	resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestMemoryTransactionIdempotencyExpiry(t *testing.T) {
+	testIdempotency = &config.IdempotencyConfig{Lease: 50 * time.Millisecond, TTL: time.Hour}
+	t.Cleanup(func() { testIdempotency = nil })
+	setupMemoryServer(t)
+	ctx := context.Background()
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := &handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 30}
+
+	// the key of a request that crashed before it was settled
+	sum := sha256.Sum256(serialize(req).Bytes())
+	err = testHandler.idempotencyRepository.CreateIdempotencyKey(ctx, &app.IdempotencyKey{
+		Scope:       "POST /transaction " + sender.ID,
+		Key:         "transfer-1",
+		RequestHash: hex.EncodeToString(sum[:]),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assertBalance(t, sender.ID, 100)
+
+	// once its lease runs out a retry takes it over, and the response it gets is replayed after that
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		resp, err = idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assertBalance(t, sender.ID, 70)
+
+	// keys are kept for their TTL
+	purger := idempotency.NewPurger(testHandler.idempotencyRepository, testIdempotency, log.NewEntry(log.New()))
+	purged, err := purger.Purge(ctx)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, purged)
+	}
+
+	purger = idempotency.NewPurger(testHandler.idempotencyRepository, &config.IdempotencyConfig{TTL: time.Nanosecond}, log.NewEntry(log.New()))
+	purged, err = purger.Purge(ctx)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 1, purged)
+	}
+
+	// a purged key can be used again
+	resp, err = idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assertBalance(t, sender.ID, 40)
+}
+
+func TestMemoryTransactionIdempotencyServerError(t *testing.T) {
+	// fault is how the next transaction fails: "begin" before it runs and "commit" once it has committed,
+	// like a connection lost before the database reported the outcome
+	fault := ""
+	testTxRunner = func(runInTx app.TxRunner) app.TxRunner {
+		return func(ctx context.Context, fn func(ctx context.Context) error) error {
+			switch fault {
+			case "begin":
+				return errors.New("connection refused")
+			case "commit":
+				if err := runInTx(ctx, fn); err != nil {
+					return err
+				}
+				return errors.New("connection reset")
+			}
+			return runInTx(ctx, fn)
+		}
+	}
+	t.Cleanup(func() { testTxRunner = nil })
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req := &handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 30}
+
+	// nothing was committed, the key is freed and the retry goes through
+	fault = "begin"
+	resp, err := idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	fault = ""
+	resp, err = idempotentTransaction(tokenFor(sender.ID), "transfer-1", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assertBalance(t, sender.ID, 70)
+
+	// the transfer may have been committed, its error is replayed instead of moving the points again
+	fault = "commit"
+	resp, err = idempotentTransaction(tokenFor(sender.ID), "transfer-2", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	fault = ""
+	resp, err = idempotentTransaction(tokenFor(sender.ID), "transfer-2", req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	assertBalance(t, sender.ID, 40)
+}
+
+func TestMemoryTransactionRollback(t *testing.T) {
+	store := setupMemoryServer(t)
+
+	tx, err := store.BeginTx()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ctx := context.WithValue(context.Background(), app.TxContextKey, tx)
+	user := &app.User{Name: "Daniel", Email: "dan@gmail.com", ReferralCode: handler.GenReferralCode(6)}
+
+	err = testHandler.userRepository.CreateUser(ctx, user)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = testHandler.userRepository.FindUserByReferralCode(ctx, user.ReferralCode)
+	assert.NoError(t, err)
+
+	assert.NoError(t, tx.Rollback(ctx))
+
+	_, err = testHandler.userRepository.FindUserByReferralCode(context.Background(), user.ReferralCode)
+	assert.Error(t, err)
+}
+
+// assertBalance checks both the cached balance of userID and the balance of their ledger account
+func assertBalance(t *testing.T, userID string, want int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	balance, err := testHandler.userPointRepository.GetUserPointsBalance(ctx, userID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, want, balance)
+
+	account, err := testHandler.ledgerRepository.FindAccountByUserID(ctx, userID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	balance, err = testHandler.ledgerRepository.GetAccountBalance(ctx, account.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, want, balance)
+}
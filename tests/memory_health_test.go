@@ -0,0 +1,117 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/stretchr/testify/assert"
+)
+
+// probe GETs path and decodes the health report it responds with
+func probe(t *testing.T, path string) (int, *health.Report) {
+	resp, err := http.Get(url + path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+
+	report := &health.Report{}
+	if !assert.NoError(t, getResponseBody(resp.Body, report)) {
+		t.FailNow()
+	}
+	return resp.StatusCode, report
+}
+
+func TestMemoryHealth(t *testing.T) {
+	setupMemoryServer(t)
+
+	status, report := probe(t, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+
+	resp, err := registerUser(&handler.UserRequest{Name: "Ada", Email: "ada@gmail.com", Password: "password123"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+
+	// the registration's event waits in the outbox until it's dispatched
+	status, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, health.StatusOK, report.Status)
+	if assert.Contains(t, report.Checks, "outbox") {
+		outboxCheck := report.Checks["outbox"]
+		assert.Equal(t, health.StatusOK, outboxCheck.Status)
+		assert.EqualValues(t, 1, outboxCheck.Details["pending"])
+		assert.Nil(t, outboxCheck.Details["last_dispatch_at"])
+	}
+
+	_, err = testHandler.dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, report = probe(t, "/readyz")
+	if assert.Contains(t, report.Checks, "outbox") {
+		assert.EqualValues(t, 0, report.Checks["outbox"].Details["pending"])
+		assert.NotNil(t, report.Checks["outbox"].Details["last_dispatch_at"])
+	}
+
+	// one failing check fails readiness, the others are still reported
+	testHandler.healthChecker.Add("postgres", func(ctx context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	status, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusFailing, report.Status)
+	if assert.Contains(t, report.Checks, "postgres") {
+		assert.Equal(t, health.StatusFailing, report.Checks["postgres"].Status)
+		assert.Equal(t, "connection refused", report.Checks["postgres"].Error)
+	}
+	assert.Equal(t, health.StatusOK, report.Checks["outbox"].Status)
+
+	// readiness fails as soon as shutdown starts, liveness doesn't
+	testHandler.healthChecker.Shutdown()
+	status, report = probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+
+	status, _ = probe(t, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestMemoryHealth_OutboxLag(t *testing.T) {
+	testMaxOutboxLag = time.Millisecond
+	t.Cleanup(func() { testMaxOutboxLag = 0 })
+	setupMemoryServer(t)
+
+	resp, err := registerUser(&handler.UserRequest{Name: "Ada", Email: "ada@gmail.com", Password: "password123"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	status, report := probe(t, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	if assert.Contains(t, report.Checks, "outbox") {
+		assert.Equal(t, health.StatusFailing, report.Checks["outbox"].Status)
+		assert.Contains(t, report.Checks["outbox"].Error, "oldest unpublished event")
+	}
+
+	_, err = testHandler.dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	status, _ = probe(t, "/readyz")
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,107 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryLeaderboard(t *testing.T) {
+	setupMemoryServer(t)
+
+	// every referee signs up from their own address so none of the referrals are held
+	signups := 0
+	referrer := func(name string, referrals int) *app.User {
+		user, err := seedOneUser(name, name+"@gmail.com")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		if _, err = seedPointBalanceForUser(user.ID, 0); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		for i := 0; i < referrals; i++ {
+			email := fmt.Sprintf("%s-referee-%d@gmail.com", name, i)
+			signups++
+			resp, err := registerUserFrom(fmt.Sprintf("10.0.0.%d", signups), email, &handler.UserRequest{Name: email, Email: email, Password: "password", ReferralCode: &user.ReferralCode})
+			if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+				t.FailNow()
+			}
+		}
+		return user
+	}
+
+	// ada and bola both complete a signup batch, ada does it first so she wins the tie
+	ada := referrer("ada", 3)
+	bola := referrer("bola", 3)
+	chidi := referrer("chidi", 1)
+
+	token := tokenFor(chidi.ID)
+	get := func(path string) *app.Leaderboard {
+		resp, err := authenticatedGet(token, path)
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			t.FailNow()
+		}
+
+		board := &app.Leaderboard{}
+		if !assert.NoError(t, getResponseBody(resp.Body, board)) {
+			t.FailNow()
+		}
+		return board
+	}
+
+	// the leaderboard is served from a cache, nothing is ranked until it's refreshed
+	board := get("/leaderboard")
+	assert.Nil(t, board.RefreshedAt)
+	assert.Empty(t, board.Entries)
+
+	if !assert.NoError(t, testHandler.leaderboardRepository.RefreshLeaderboard(context.Background())) {
+		return
+	}
+
+	board = get("/leaderboard?period=week&limit=2")
+	assert.Equal(t, app.LeaderboardWeek, board.Period)
+	assert.Equal(t, app.LeaderboardByReferrals, board.Metric)
+	assert.NotNil(t, board.RefreshedAt)
+	if assert.Len(t, board.Entries, 2) && assert.NotNil(t, board.NextOffset) {
+		assert.Equal(t, app.LeaderboardEntry{Rank: 1, UserID: ada.ID, Name: ada.Name, Referrals: 3, Points: 50}, *board.Entries[0])
+		assert.Equal(t, app.LeaderboardEntry{Rank: 2, UserID: bola.ID, Name: bola.Name, Referrals: 3, Points: 50}, *board.Entries[1])
+
+		board = get(fmt.Sprintf("/leaderboard?period=week&limit=2&offset=%d", *board.NextOffset))
+		if assert.Len(t, board.Entries, 1) {
+			assert.Equal(t, app.LeaderboardEntry{Rank: 3, UserID: chidi.ID, Name: chidi.Name, Referrals: 1}, *board.Entries[0])
+		}
+		assert.Nil(t, board.NextOffset)
+	}
+
+	// chidi has earned nothing, so he isn't ranked by points
+	board = get("/leaderboard?metric=points")
+	if assert.Len(t, board.Entries, 2) {
+		assert.Equal(t, ada.ID, board.Entries[0].UserID)
+		assert.Equal(t, bola.ID, board.Entries[1].UserID)
+	}
+
+	// pages by points end with the last user who earned any, the unranked aren't counted towards offsets
+	board = get("/leaderboard?metric=points&limit=1&offset=1")
+	if assert.Len(t, board.Entries, 1) {
+		assert.Equal(t, int64(2), board.Entries[0].Rank)
+		assert.Equal(t, bola.ID, board.Entries[0].UserID)
+	}
+	assert.Nil(t, board.NextOffset)
+
+	for _, query := range []string{"period=year", "metric=transfers", "offset=-1", "limit=ten"} {
+		resp, err := authenticatedGet(token, "/leaderboard?"+query)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	}
+}
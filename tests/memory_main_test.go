@@ -0,0 +1,143 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/auth"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/memory"
+	"github.com/danvixent/aboki-africa-assessment/fraud"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/health"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	"github.com/danvixent/aboki-africa-assessment/routes"
+	"github.com/dimfeld/httptreemux"
+	log "github.com/sirupsen/logrus"
+)
+
+var url string
+
+// testAdminID is the only user allowed to call admin endpoints, it needn't exist to be authenticated
+const testAdminID = "00000000-0000-4000-8000-000000000001"
+
+// testReferralProgram is the program setupMemoryServer runs, referral.DefaultProgram when it's nil
+var testReferralProgram *config.ReferralProgram
+
+// testFraud trusts X-Forwarded-For so tests can sign up from different addresses
+var testFraud = &config.FraudConfig{TrustForwardedFor: true}
+
+// testServer is the server config setupMemoryServer serves with, nil for the defaults
+var testServer *config.ServerConfig
+
+// testMaxOutboxLag fails readiness when events wait longer than it to be published, zero disables it
+var testMaxOutboxLag time.Duration
+
+// testWebhooks lets subscriptions point at the loopback httptest servers the tests subscribe
+var testWebhooks = &config.WebhookConfig{AllowPrivateAddresses: true}
+
+// testIdempotency is the idempotency config setupMemoryServer serves with, nil for the defaults
+var testIdempotency *config.IdempotencyConfig
+
+// testTxRunner wraps the TxRunner setupMemoryServer serves with when it's set, to fail transactions
+var testTxRunner func(app.TxRunner) app.TxRunner
+
+var testWithdrawals = &config.WithdrawalConfig{PointRate: 80, MinPoints: 10, MaxPoints: 500, DailyLimit: 600}
+
+// setupMemoryServer serves the routes from an httptest server backed by a fresh memory.Store and
+// fakePaystack, it points url, testHandler and paystackServer at them for the duration of the test
+func setupMemoryServer(t *testing.T) *memory.Store {
+	store := memory.New()
+	m := metrics.New()
+	userRepo := metrics.InstrumentUserRepository(memory.NewUserRepository(store), m)
+	userReferralRepo := metrics.InstrumentUserReferralRepository(memory.NewUserReferralRepository(store), m)
+	userPointsRepo := metrics.InstrumentUserPointRepository(memory.NewUserPointsRepository(store), m)
+	ledgerRepo := memory.NewLedgerRepository(store)
+	idempotencyRepo := memory.NewIdempotencyRepository(store)
+	topupRepo := memory.NewTopupRepository(store)
+	webhookEventRepo := memory.NewWebhookEventRepository(store)
+	bankRecipientRepo := memory.NewBankRecipientRepository(store)
+	withdrawalRepo := memory.NewWithdrawalRepository(store)
+	outboxRepo := memory.NewOutboxRepository(store)
+	webhookSubscriptionRepo := memory.NewWebhookSubscriptionRepository(store)
+	webhookDeliveryRepo := memory.NewWebhookDeliveryRepository(store)
+	signupCheckRepo := memory.NewSignupCheckRepository(store)
+	leaderboardRepo := memory.NewLeaderboardRepository(store)
+
+	program, err := referral.NewProgram(testReferralProgram)
+	if err != nil {
+		t.Fatalf("invalid referral program: %v", err)
+	}
+
+	tokenIssuer := auth.NewTokenIssuer("test-secret", time.Hour)
+	paystackServer = newFakePaystack()
+	t.Cleanup(paystackServer.Close)
+	paystackClient := paystack.NewClient(testPaystackKey, paystackServer.URL)
+
+	runInTx := metrics.InstrumentTxRunner(store.RunInTx)
+	if testTxRunner != nil {
+		runInTx = testTxRunner(runInTx)
+	}
+
+	h := handler.NewHandler(handler.Dependencies{
+		UserRepository:                userRepo,
+		UserReferralRepository:        userReferralRepo,
+		UserPointRepository:           userPointsRepo,
+		LedgerRepository:              ledgerRepo,
+		IdempotencyRepository:         idempotencyRepo,
+		TopupRepository:               topupRepo,
+		WebhookEventRepository:        webhookEventRepo,
+		BankRecipientRepository:       bankRecipientRepo,
+		WithdrawalRepository:          withdrawalRepo,
+		OutboxRepository:              outboxRepo,
+		WebhookSubscriptionRepository: webhookSubscriptionRepo,
+		WebhookDeliveryRepository:     webhookDeliveryRepo,
+		SignupCheckRepository:         signupCheckRepo,
+		LeaderboardRepository:         leaderboardRepo,
+		ReferralProgram:               program,
+		FraudChecker:                  fraud.NewChecker(signupCheckRepo, testFraud),
+		TokenIssuer:                   tokenIssuer,
+		PaystackClient:                paystackClient,
+		RunInTx:                       runInTx,
+	}, handler.Options{
+		PointPrice:   100,
+		Withdrawals:  testWithdrawals,
+		Webhooks:     testWebhooks,
+		Idempotency:  testIdempotency,
+		AdminUserIDs: []string{testAdminID},
+	})
+
+	// the dispatcher isn't run, tests dispatch with it when they need events published
+	dispatcher := outbox.NewDispatcher(outboxRepo, store.RunInTx, nil, log.NewEntry(log.New()))
+	checker := health.NewChecker(nil)
+	checker.Add("outbox", health.OutboxCheck(outboxRepo, dispatcher, testMaxOutboxLag))
+
+	router := httptreemux.New()
+	routes.SetupRoutes(router, h, m, checker, testServer)
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	url = srv.URL
+	testHandler = &TestHandler{
+		userRepository:         userRepo,
+		userReferralRepository: userReferralRepo,
+		userPointRepository:    userPointsRepo,
+		ledgerRepository:       ledgerRepo,
+		idempotencyRepository:  idempotencyRepo,
+		signupCheckRepository:  signupCheckRepo,
+		leaderboardRepository:  leaderboardRepo,
+		tokenIssuer:            tokenIssuer,
+		healthChecker:          checker,
+		dispatcher:             dispatcher,
+	}
+	return store
+}
@@ -0,0 +1,106 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	store := setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(sender.ID, 100); !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := registerUser(&handler.UserRequest{Name: "Referee", Email: "referee@gmail.com", Password: "password", ReferralCode: &sender.ReferralCode})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	referee := &struct {
+		ID string `json:"id"`
+	}{}
+	if !assert.NoError(t, getResponseBody(resp.Body, referee)) {
+		return
+	}
+
+	resp, err = transaction(tokenFor(sender.ID), &handler.TransferPointsRequest{RecipientUserID: referee.ID, Points: 30})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	// transfers written in a transaction that's rolled back, or in a savepoint that is, aren't counted
+	runInTx := metrics.InstrumentTxRunner(store.RunInTx)
+	transfer := func(ctx context.Context) error {
+		return testHandler.userPointRepository.CreatePointTransaction(ctx, &app.Transaction{UserID: sender.ID, RecipientUserID: referee.ID, Points: 5})
+	}
+
+	err = runInTx(context.Background(), func(ctx context.Context) error {
+		if err := transfer(ctx); err != nil {
+			return err
+		}
+		return errors.New("rolled back")
+	})
+	assert.Error(t, err)
+
+	err = runInTx(context.Background(), func(ctx context.Context) error {
+		return runInTx(ctx, func(ctx context.Context) error {
+			if err := transfer(ctx); err != nil {
+				return err
+			}
+			return errors.New("rolled back")
+		})
+	})
+	assert.Error(t, err)
+
+	resp, err = http.Get(url + "/users/" + sender.ID + "/balance")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusUnauthorized, resp.StatusCode) {
+		return
+	}
+
+	resp, err = http.Get(url + "/metrics")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the sender was seeded through the instrumented repository, so they count as a registration too
+	for _, line := range []string{
+		"# TYPE aboki_registrations_total counter",
+		"aboki_registrations_total 2",
+		`aboki_referrals_total{held="false"} 1`,
+		"aboki_point_transfers_total 1",
+		"aboki_points_transferred_total 30",
+		`http_requests_total{method="POST",route="/register",status="200"} 1`,
+		`http_requests_total{method="POST",route="/transaction",status="200"} 1`,
+		`http_requests_total{method="GET",route="/users/:id/balance",status="401"} 1`,
+		"# TYPE http_request_duration_seconds histogram",
+		`http_request_duration_seconds_bucket{method="GET",route="/users/:id/balance",le="+Inf"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/register"} 1`,
+		"# TYPE go_goroutines gauge",
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
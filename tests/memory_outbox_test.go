@@ -0,0 +1,238 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/memory"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	"github.com/jackc/pgconn"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryOutboxEvents(t *testing.T) {
+	store := setupMemoryServer(t)
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, email := range []string{"daniel@gmail.com", "daniel1@gmail.com", "daniel2@gmail.com"} {
+		resp, err := registerUser(&handler.UserRequest{
+			Name:         "Referee",
+			Email:        email,
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err := transaction(tokenFor(referrer.ID), &handler.TransferPointsRequest{RecipientUserID: referrer.ID, Points: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a rejected transfer must not record an event")
+
+	var published []*app.OutboxEvent
+	dispatcher := outbox.NewDispatcher(memory.NewOutboxRepository(store), store.RunInTx, nil, log.NewEntry(log.New()),
+		outbox.PublisherFunc(func(ctx context.Context, event *app.OutboxEvent) error {
+			published = append(published, event)
+			return nil
+		}))
+
+	n, err := dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 4, n)
+
+	types := []string{}
+	for _, e := range published {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{app.UserRegisteredEvent, app.UserRegisteredEvent, app.UserRegisteredEvent, app.ReferralBonusPaidEvent}, types)
+
+	refereeIDs := []string{}
+	for i, e := range published[:3] {
+		registered := &app.UserRegisteredPayload{}
+		if !assert.NoError(t, json.Unmarshal(e.Payload, registered)) {
+			return
+		}
+		if i == 0 {
+			assert.Equal(t, "daniel@gmail.com", registered.Email)
+			assert.Equal(t, &referrer.ID, registered.ReferrerID)
+		}
+		refereeIDs = append(refereeIDs, registered.UserID)
+	}
+
+	// the signup bonus lists every referee in the batch it paid for
+	bonus := &app.ReferralBonusPaidPayload{}
+	if assert.NoError(t, json.Unmarshal(published[3].Payload, bonus)) {
+		assert.Equal(t, referrer.ID, bonus.ReferrerID)
+		assert.EqualValues(t, 50, bonus.Points)
+		assert.Equal(t, refereeIDs, bonus.RefereeIDs)
+	}
+
+	// published events aren't delivered again
+	n, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err = transaction(tokenFor(referrer.ID), &handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 20})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	published = nil
+	_, err = dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) || !assert.Len(t, published, 1) {
+		return
+	}
+
+	transferred := &app.PointsTransferredPayload{}
+	assert.Equal(t, app.PointsTransferredEvent, published[0].Type)
+	if assert.NoError(t, json.Unmarshal(published[0].Payload, transferred)) {
+		assert.Equal(t, referrer.ID, transferred.UserID)
+		assert.Equal(t, recipient.ID, transferred.RecipientUserID)
+		assert.EqualValues(t, 20, transferred.Points)
+		assert.Equal(t, published[0].AggregateID, transferred.TransactionID)
+	}
+}
+
+func TestMemoryOutboxRetries(t *testing.T) {
+	store := setupMemoryServer(t)
+	outboxRepo := memory.NewOutboxRepository(store)
+
+	resp, err := registerUser(&handler.UserRequest{Name: "Daniel", Email: "dan@gmail.com", Password: "password"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	down := true
+	var delivered int
+	cfg := &config.OutboxConfig{PollInterval: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	dispatcher := outbox.NewDispatcher(outboxRepo, store.RunInTx, cfg, log.NewEntry(log.New()),
+		outbox.PublisherFunc(func(ctx context.Context, event *app.OutboxEvent) error {
+			if down {
+				return errors.New("broker unavailable")
+			}
+			delivered++
+			return nil
+		}))
+
+	_, err = dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the failed event waits out its backoff before it's retried
+	n, err := dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(cfg.PollInterval)
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+
+	var events []*app.OutboxEvent
+	err = store.RunInTx(context.Background(), func(ctx context.Context) error {
+		events, err = outboxRepo.ClaimOutboxEvents(ctx, 10)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Len(t, events, 0, "the event is still backing off")
+
+	down = false
+	time.Sleep(cfg.MaxBackoff)
+	_, err = dispatcher.Dispatch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*cfg.PollInterval)
+	defer cancel()
+	dispatcher.Run(ctx)
+	assert.Equal(t, 1, delivered, "a published event must not be delivered again")
+}
+
+func TestMemoryOutboxPublisherDatabaseError(t *testing.T) {
+	store := setupMemoryServer(t)
+	outboxRepo := memory.NewOutboxRepository(store)
+
+	for _, email := range []string{"dan@gmail.com", "ada@gmail.com"} {
+		resp, err := registerUser(&handler.UserRequest{Name: "User", Email: email, Password: "password"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// the first event's publisher writes to the database, then fails like a constraint would
+	var first string
+	var published []string
+	dispatcher := outbox.NewDispatcher(outboxRepo, store.RunInTx, nil, log.NewEntry(log.New()),
+		outbox.PublisherFunc(func(ctx context.Context, event *app.OutboxEvent) error {
+			if first == "" || first == event.ID {
+				first = event.ID
+				err := outboxRepo.CreateOutboxEvent(ctx, &app.OutboxEvent{Type: "partial.write", Payload: []byte("{}")})
+				if err != nil {
+					return err
+				}
+				return &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+			}
+			published = append(published, event.ID)
+			return nil
+		}))
+
+	n, err := dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, n)
+	assert.Len(t, published, 1, "the rest of the batch is published")
+
+	// the failure is recorded and what the publisher wrote before failing is rolled back
+	backlog, err := outboxRepo.GetOutboxBacklog(context.Background())
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 1, backlog.Pending)
+	}
+
+	var events []*app.OutboxEvent
+	err = store.RunInTx(context.Background(), func(ctx context.Context) error {
+		events, err = outboxRepo.ClaimOutboxEvents(ctx, 10)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Len(t, events, 0, "the failed event backs off instead of being claimed first again")
+}
@@ -0,0 +1,171 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/reconcile"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryReconcile(t *testing.T) {
+	store := setupMemoryServer(t)
+	ctx := context.Background()
+
+	healthy, err := seedOneUser("Healthy", "healthy@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(healthy.ID, 100); !assert.NoError(t, err) {
+		return
+	}
+
+	drifted, err := seedOneUser("Drifted", "drifted@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// points posted before the user had a cached balance, e.g imported from an older system,
+	// are in the ledger but not in user_points
+	legacy := &app.Account{Code: "legacy:" + drifted.ID, Kind: app.UserAccountKind, UserID: &drifted.ID}
+	if !assert.NoError(t, testHandler.ledgerRepository.CreateAccount(ctx, legacy)) {
+		return
+	}
+
+	equity, err := testHandler.ledgerRepository.FindAccountByCode(ctx, app.OpeningBalanceAccount)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	entry := app.NewTransferEntry(app.OpeningBalanceEntry, drifted.ID, "imported balance", equity.ID, legacy.ID, 30)
+	if !assert.NoError(t, testHandler.ledgerRepository.PostJournalEntry(ctx, entry)) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(drifted.ID, 0); !assert.NoError(t, err) {
+		return
+	}
+
+	// a transfer and a paid transaction bonus that never made it to the ledger
+	txn := &app.Transaction{UserID: healthy.ID, RecipientUserID: drifted.ID, Points: 10}
+	if !assert.NoError(t, testHandler.userPointRepository.CreatePointTransaction(ctx, txn)) {
+		return
+	}
+
+	bonus := &app.ReferredUserTransactionBonus{ReferrerID: healthy.ID, RefereeID: drifted.ID}
+	if !assert.NoError(t, testHandler.userReferralRepository.CreateReferredUserTransactionBonus(ctx, bonus)) ||
+		!assert.NoError(t, testHandler.userReferralRepository.PayReferralsTransactionsBonuses(ctx, []string{bonus.ID})) {
+		return
+	}
+
+	program, err := referral.NewProgram(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	newReconciler := func(ledgerRepository app.LedgerRepository) *reconcile.Reconciler {
+		return reconcile.NewReconciler(ledgerRepository, testHandler.userPointRepository, testHandler.userReferralRepository, program, store.RunInTx)
+	}
+	reconciler := newReconciler(testHandler.ledgerRepository)
+
+	report, err := reconciler.Run(ctx, false)
+	if !assert.NoError(t, err) || !assert.Len(t, report.Discrepancies, 1) || !assert.Len(t, report.LedgerDiscrepancies, 3) {
+		return
+	}
+
+	want := map[string]reconcile.LedgerDiscrepancy{
+		healthy.ID + string(app.PointTransferEntry): {Kind: app.PointTransferEntry, Reference: txn.ID, UserID: healthy.ID, Expected: -10, Difference: 10, Status: reconcile.Open},
+		drifted.ID + string(app.PointTransferEntry): {Kind: app.PointTransferEntry, Reference: txn.ID, UserID: drifted.ID, Expected: 10, Difference: -10, Status: reconcile.Open},
+		// the default program pays 50 points for 3 bonuses, a bonus missing from the ledger is owed a third of that
+		healthy.ID + string(app.ReferredUserTransactionBonusEntry): {Kind: app.ReferredUserTransactionBonusEntry, Reference: bonus.ID, UserID: healthy.ID, Expected: 16, Difference: -16, Status: reconcile.Open},
+	}
+	for _, d := range report.LedgerDiscrepancies {
+		assert.Equal(t, want[d.UserID+string(d.Kind)], *d)
+	}
+
+	d := report.Discrepancies[0]
+	assert.Equal(t, drifted.ID, d.UserID)
+	assert.EqualValues(t, 0, d.CachedBalance)
+	assert.EqualValues(t, 30, d.LedgerBalance)
+	assert.EqualValues(t, -30, d.Difference)
+	assert.Equal(t, reconcile.Open, d.Status)
+	assert.Equal(t, 4, report.Unfixed())
+	assertCachedBalance(t, drifted.ID, 0)
+
+	buf := &bytes.Buffer{}
+	if assert.NoError(t, report.WriteCSV(buf)) {
+		records, err := csv.NewReader(buf).ReadAll()
+		if assert.NoError(t, err) && assert.Len(t, records, 5) {
+			assert.Equal(t, []string{"check", "user_id", "reference", "expected", "actual", "difference", "status"}, records[0])
+			assert.Equal(t, []string{"referred_user_transaction_bonus", healthy.ID, bonus.ID, "16", "0", "-16", "open"}, records[3])
+			assert.Equal(t, []string{"cached_balance", drifted.ID, "", "30", "0", "-30", "open"}, records[4])
+		}
+	}
+
+	// the ledger is adjusted first and the cached balances follow it
+	report, err = reconciler.Run(ctx, true)
+	if !assert.NoError(t, err) || !assert.Len(t, report.Discrepancies, 1) || !assert.Len(t, report.LedgerDiscrepancies, 3) {
+		return
+	}
+	for _, d := range report.LedgerDiscrepancies {
+		assert.Equal(t, reconcile.Fixed, d.Status)
+	}
+	assert.Equal(t, reconcile.Fixed, report.Discrepancies[0].Status)
+	assert.Equal(t, 0, report.Unfixed())
+	assertBalance(t, drifted.ID, 40)
+	assertBalance(t, healthy.ID, 106)
+
+	system, err := testHandler.ledgerRepository.FindAccountByCode(ctx, app.ReconciliationAccount)
+	if assert.NoError(t, err) {
+		balance, err := testHandler.ledgerRepository.GetAccountBalance(ctx, system.ID)
+		assert.NoError(t, err)
+		assert.EqualValues(t, -16, balance)
+	}
+
+	report, err = reconciler.Run(ctx, false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.LedgerDiscrepancies)
+	assert.Empty(t, report.Discrepancies)
+
+	// a discrepancy that's gone once the balance is locked, e.g because it was read mid-transfer, isn't fixed
+	stale := &staleLedgerRepository{
+		LedgerRepository: testHandler.ledgerRepository,
+		discrepancy:      &app.BalanceDiscrepancy{UserID: healthy.ID, CachedBalance: 106, LedgerBalance: 90},
+	}
+
+	report, err = newReconciler(stale).Run(ctx, true)
+	if assert.NoError(t, err) && assert.Len(t, report.Discrepancies, 1) {
+		assert.Equal(t, reconcile.Resolved, report.Discrepancies[0].Status)
+		assert.Equal(t, 0, report.Unfixed())
+	}
+	assertBalance(t, healthy.ID, 106)
+}
+
+// staleLedgerRepository lists a discrepancy that's no longer there
+type staleLedgerRepository struct {
+	app.LedgerRepository
+	discrepancy *app.BalanceDiscrepancy
+}
+
+func (s *staleLedgerRepository) ListBalanceDiscrepancies(context.Context) ([]*app.BalanceDiscrepancy, error) {
+	return []*app.BalanceDiscrepancy{s.discrepancy}, nil
+}
+
+// assertCachedBalance checks the balance of userID cached in user_points, unlike assertBalance it
+// doesn't expect it to match the ledger
+func assertCachedBalance(t *testing.T, userID string, want int64) {
+	t.Helper()
+
+	balance, err := testHandler.userPointRepository.GetUserPointsBalance(context.Background(), userID)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, want, balance)
+	}
+}
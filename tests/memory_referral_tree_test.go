@@ -0,0 +1,105 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/referral"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryReferralTree(t *testing.T) {
+	testReferralProgram = referral.DefaultProgram()
+	testReferralProgram.UplineShares = []int64{10, 5}
+	t.Cleanup(func() { testReferralProgram = nil })
+	setupMemoryServer(t)
+
+	root, err := seedOneUser("Root", "root@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(root.ID, 0); !assert.NoError(t, err) {
+		return
+	}
+
+	register := func(email string, code string) *app.User {
+		resp, err := registerUser(&handler.UserRequest{Name: email, Email: email, Password: "password", ReferralCode: &code})
+		if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+			t.FailNow()
+		}
+
+		user := &app.User{}
+		if !assert.NoError(t, getResponseBody(resp.Body, user)) {
+			t.FailNow()
+		}
+		return user
+	}
+
+	child := register("child@gmail.com", root.ReferralCode)
+	grandchild := register("grandchild@gmail.com", child.ReferralCode)
+	for _, email := range []string{"a@gmail.com", "b@gmail.com", "c@gmail.com"} {
+		register(email, grandchild.ReferralCode)
+	}
+
+	// the grandchild completed a signup batch, the two levels above them get their share of it
+	assertBalance(t, grandchild.ID, 50)
+	assertBalance(t, child.ID, 5)
+	assertBalance(t, root.ID, 2)
+
+	token := tokenFor(root.ID)
+	resp, err := authenticatedGet(token, "/users/"+root.ID+"/referrals")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	referrals := []*app.ReferralNode{}
+	if assert.NoError(t, getResponseBody(resp.Body, &referrals)) && assert.Len(t, referrals, 1) {
+		assert.Equal(t, child.ID, referrals[0].UserID)
+		assert.Equal(t, app.ReferralPending, referrals[0].Status)
+		assert.Empty(t, referrals[0].Referees)
+	}
+
+	resp, err = authenticatedGet(token, "/users/"+root.ID+"/referral-tree")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	tree := []*app.ReferralNode{}
+	if assert.NoError(t, getResponseBody(resp.Body, &tree)) && assert.Len(t, tree, 1) {
+		assert.Len(t, tree[0].Referees, 1)
+		assert.Equal(t, grandchild.ID, tree[0].Referees[0].UserID)
+		assert.Equal(t, 2, tree[0].Referees[0].Depth)
+
+		leaves := tree[0].Referees[0].Referees
+		if assert.Len(t, leaves, 3) {
+			assert.Equal(t, "a@gmail.com", leaves[0].Name)
+			assert.Equal(t, app.ReferralPaid, leaves[0].Status)
+		}
+	}
+
+	resp, err = authenticatedGet(token, "/users/"+root.ID+"/referral-tree?depth=2")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	tree = []*app.ReferralNode{}
+	if assert.NoError(t, getResponseBody(resp.Body, &tree)) && assert.Len(t, tree, 1) && assert.Len(t, tree[0].Referees, 1) {
+		assert.Empty(t, tree[0].Referees[0].Referees)
+	}
+
+	resp, err = authenticatedGet(token, "/users/"+root.ID+"/referral-tree?depth=11")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = authenticatedGet(token, "/users/"+child.ID+"/referral-tree")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+}
@@ -0,0 +1,86 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/routes"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRequestContext(t *testing.T) {
+	// the leaderboard times out right away, every other route gets the default timeout
+	testServer = &config.ServerConfig{RouteTimeouts: map[string]time.Duration{"GET /leaderboard": time.Nanosecond}}
+	t.Cleanup(func() { testServer = nil })
+	setupMemoryServer(t)
+
+	previousHooks := log.StandardLogger().ReplaceHooks(make(log.LevelHooks))
+	t.Cleanup(func() { log.StandardLogger().ReplaceHooks(previousHooks) })
+	hook := test.NewLocal(log.StandardLogger())
+
+	user, err := seedOneUser("Caller", "caller@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(user.ID, 10); !assert.NoError(t, err) {
+		return
+	}
+
+	get := func(path string, requestID string) *http.Response {
+		r, err := http.NewRequest(http.MethodGet, url+path, nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		r.Header.Set("Authorization", "Bearer "+tokenFor(user.ID))
+		if requestID != "" {
+			r.Header.Set(routes.RequestIDHeader, requestID)
+		}
+
+		resp, err := http.DefaultClient.Do(r)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return resp
+	}
+
+	// a valid ID from the client is kept, anything else is replaced with a new one
+	resp := get("/users/"+user.ID+"/balance", "client-req-1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "client-req-1", resp.Header.Get(routes.RequestIDHeader))
+
+	resp = get("/users/"+user.ID+"/balance", "not a valid id")
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), resp.Header.Get(routes.RequestIDHeader))
+
+	resp = get("/users/"+user.ID+"/balance", "")
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{32}$`), resp.Header.Get(routes.RequestIDHeader))
+
+	// the request's deadline reaches the store, and what the handler logs about it can be traced to the request
+	resp = get("/leaderboard", "slow-req-1")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	var entry *log.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Message == "failed to get leaderboard" {
+			entry = e
+		}
+	}
+
+	if assert.NotNil(t, entry, "the failure wasn't logged") {
+		assert.Equal(t, "slow-req-1", entry.Data["request_id"])
+		assert.Equal(t, http.MethodGet, entry.Data["method"])
+		assert.Equal(t, "/leaderboard", entry.Data["route"])
+		assert.Equal(t, user.ID, entry.Data["user_id"])
+		assert.NotEmpty(t, entry.Data["remote_ip"])
+		assert.Contains(t, entry.Data[log.ErrorKey].(error).Error(), "deadline exceeded")
+	}
+}
@@ -0,0 +1,80 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserBalanceAndSummary(t *testing.T) {
+	setupMemoryServer(t)
+
+	referrer, err := seedOneUser("Daniel", "dan@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(referrer.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the first three referrals pay out, the fourth is pending
+	for i := 0; i < 4; i++ {
+		resp, err := registerUser(&handler.UserRequest{
+			Name:         "Referee",
+			Email:        fmt.Sprintf("referee%d@gmail.com", i),
+			Password:     "password",
+			ReferralCode: &referrer.ReferralCode,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	balance := &handler.BalanceResponse{}
+	resp, err := authenticatedGet(tokenFor(referrer.ID), "/users/"+referrer.ID+"/balance")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	if assert.NoError(t, getResponseBody(resp.Body, balance)) {
+		assert.EqualValues(t, 50, balance.Points)
+	}
+
+	summary := &handler.SummaryResponse{}
+	resp, err = authenticatedGet(tokenFor(referrer.ID), "/users/"+referrer.ID+"/summary")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	if !assert.NoError(t, getResponseBody(resp.Body, summary)) {
+		return
+	}
+
+	assert.EqualValues(t, 50, summary.AvailablePoints)
+	assert.EqualValues(t, 0, summary.TotalTransferredPoints)
+	assert.EqualValues(t, 50, summary.LifetimeReferralEarnings)
+	assert.NotNil(t, summary.LastActivityAt)
+	if assert.Len(t, summary.ReferralProgress, 2) {
+		assert.Equal(t, "signup_bonus", summary.ReferralProgress[0].Rule)
+		assert.EqualValues(t, 1, summary.ReferralProgress[0].Pending)
+		assert.EqualValues(t, 3, summary.ReferralProgress[0].BatchSize)
+	}
+
+	// users can only read their own summary
+	resp, err = authenticatedGet(tokenFor(referrer.ID), "/users/00000000-0000-0000-0000-000000000000/summary")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	resp, err = http.Get(url + "/users/" + referrer.ID + "/summary")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
@@ -0,0 +1,126 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryTopup(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, err := seedOneUser("Buyer", "buyer@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(user.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token := tokenFor(user.ID)
+	resp, err := authenticatedPost(token, "/topups", &handler.TopupRequest{Points: 50})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	topup := &handler.TopupResponse{}
+	if !assert.NoError(t, getResponseBody(resp.Body, topup)) {
+		return
+	}
+	assert.Equal(t, app.TopupPending, topup.Status)
+	assert.EqualValues(t, 5000, topup.Amount)
+	assert.NotEmpty(t, topup.AuthorizationURL)
+
+	// nothing is credited until the payment goes through
+	assertTopupStatus(t, token, topup.Reference, app.TopupPending)
+	assertBalance(t, user.ID, 0)
+
+	paystackServer.pay(topup.Reference, topup.Amount)
+
+	// verifying twice must credit the points once
+	for i := 0; i < 2; i++ {
+		assertTopupStatus(t, token, topup.Reference, app.TopupSuccess)
+		assertBalance(t, user.ID, 50)
+	}
+
+	other, err := seedOneUser("Other", "other@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err = authenticatedPost(tokenFor(other.ID), "/topups/"+topup.Reference+"/verify", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMemoryTopupFailures(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, err := seedOneUser("Buyer", "buyer@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(user.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token := tokenFor(user.ID)
+	resp, err := authenticatedPost(token, "/topups", &handler.TopupRequest{Points: 0})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	paystackServer.setDown(true)
+	resp, err = authenticatedPost(token, "/topups", &handler.TopupRequest{Points: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	paystackServer.setDown(false)
+
+	resp, err = authenticatedPost(token, "/topups", &handler.TopupRequest{Points: 10})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	topup := &handler.TopupResponse{}
+	if !assert.NoError(t, getResponseBody(resp.Body, topup)) {
+		return
+	}
+
+	// paying less than the price must not credit anything
+	paystackServer.pay(topup.Reference, topup.Amount-1)
+	assertTopupStatus(t, token, topup.Reference, app.TopupFailed)
+	assertBalance(t, user.ID, 0)
+}
+
+// assertTopupStatus verifies the topup identified by reference and checks its status
+func assertTopupStatus(t *testing.T, token string, reference string, want app.TopupStatus) {
+	t.Helper()
+
+	resp, err := authenticatedPost(token, "/topups/"+reference+"/verify", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	topup := &handler.TopupResponse{}
+	if !assert.NoError(t, getResponseBody(resp.Body, topup)) {
+		return
+	}
+	assert.Equal(t, want, topup.Status)
+}
@@ -0,0 +1,90 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMemoryTracing(t *testing.T) {
+	if _, err := tracing.Setup(nil); !assert.NoError(t, err) {
+		return
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(sender.ID, 100); !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if _, err = seedPointBalanceForUser(recipient.ID, 0); !assert.NoError(t, err) {
+		return
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url+"/transaction", serialize(&handler.TransferPointsRequest{RecipientUserID: recipient.ID, Points: 30}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the caller's trace, as a W3C traceparent header
+	r.Header.Set("Authorization", "Bearer "+tokenFor(sender.ID))
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	resp, err := http.DefaultClient.Do(r)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	server, ok := spans["POST /transaction"]
+	if !assert.True(t, ok, "no span for the request") {
+		return
+	}
+
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Contains(t, server.Attributes(), semconv.HTTPRoute("/transaction"))
+	assert.Contains(t, server.Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusOK))
+
+	transfer, ok := spans["Handler.TransferPoints"]
+	if assert.True(t, ok, "no span for the handler") {
+		assert.Equal(t, server.SpanContext().TraceID(), transfer.SpanContext().TraceID())
+		assert.Equal(t, server.SpanContext().SpanID(), transfer.Parent().SpanID())
+	}
+}
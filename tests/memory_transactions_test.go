@@ -0,0 +1,102 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryUserTransactions(t *testing.T) {
+	setupMemoryServer(t)
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(sender.ID, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	recipient, err := seedOneUser("Recipient", "recipient@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(recipient.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := transaction(tokenFor(sender.ID), &handler.TransferPointsRequest{
+			RecipientUserID: recipient.ID,
+			Points:          10,
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	page := &handler.TransactionHistoryResponse{}
+	resp, err := authenticatedGet(tokenFor(sender.ID), "/users/"+sender.ID+"/transactions?limit=2")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	if !assert.NoError(t, getResponseBody(resp.Body, page)) {
+		return
+	}
+
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, app.SentDirection, page.Data[0].Direction)
+		assert.EqualValues(t, 10, page.Data[0].Points)
+		assert.Equal(t, recipient.ID, *page.Data[0].CounterpartyUserID)
+	}
+	assert.NotEmpty(t, page.NextCursor)
+
+	next := &handler.TransactionHistoryResponse{}
+	resp, err = authenticatedGet(tokenFor(sender.ID), "/users/"+sender.ID+"/transactions?limit=2&cursor="+page.NextCursor)
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	if !assert.NoError(t, getResponseBody(resp.Body, next)) {
+		return
+	}
+
+	// the last transfer and the opening balance
+	if assert.Len(t, next.Data, 2) {
+		assert.Equal(t, app.PointTransferEntry, next.Data[0].Kind)
+		assert.Equal(t, app.OpeningBalanceEntry, next.Data[1].Kind)
+		assert.Nil(t, next.Data[1].CounterpartyUserID)
+	}
+	assert.Empty(t, next.NextCursor)
+
+	received := &handler.TransactionHistoryResponse{}
+	resp, err = authenticatedGet(tokenFor(recipient.ID), "/users/"+recipient.ID+"/transactions?direction=received")
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+	if !assert.NoError(t, getResponseBody(resp.Body, received)) {
+		return
+	}
+	assert.Len(t, received.Data, 3)
+
+	// the cursor is opaque but clients can still make one up, its ID must be a UUID like the ones we hand out
+	forged := base64.RawURLEncoding.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano) + "|not-a-uuid"))
+	for _, cursor := range []string{"garbage", forged} {
+		resp, err = authenticatedGet(tokenFor(sender.ID), "/users/"+sender.ID+"/transactions?cursor="+cursor)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, cursor)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/memory"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	"github.com/danvixent/aboki-africa-assessment/webhook"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// subscriber is a partner's webhook endpoint, it records the deliveries it accepts
+type subscriber struct {
+	*httptest.Server
+	mu       sync.Mutex
+	secret   string
+	down     bool
+	received []*http.Request
+	verified []bool
+}
+
+func newSubscriber(t *testing.T) *subscriber {
+	s := &subscriber{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		s.received = append(s.received, r)
+		s.verified = append(s.verified, webhook.VerifySignature(s.secret, r.Header.Get(webhook.TimestampHeader), body, r.Header.Get(webhook.SignatureHeader)))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestMemoryWebhookSubscriptions(t *testing.T) {
+	store := setupMemoryServer(t)
+	subscriptionRepo := memory.NewWebhookSubscriptionRepository(store)
+	deliveryRepo := memory.NewWebhookDeliveryRepository(store)
+
+	partner, err := seedOneUser("Partner", "partner@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, u := range []*app.User{partner, sender} {
+		if _, err = seedPointBalanceForUser(u.ID, 100); !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	srv := newSubscriber(t)
+	token := tokenFor(partner.ID)
+
+	for _, req := range []*handler.WebhookSubscriptionRequest{
+		{URL: "ftp://example.com/hooks"},
+		{URL: srv.URL, Events: []string{"points.stolen"}},
+	} {
+		resp, err := authenticatedPost(token, "/webhooks/subscriptions", req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err := authenticatedPost(token, "/webhooks/subscriptions", &handler.WebhookSubscriptionRequest{URL: srv.URL, Events: []string{app.PointsTransferredEvent}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	subscription := &app.WebhookSubscription{}
+	if !assert.NoError(t, getResponseBody(resp.Body, subscription)) {
+		return
+	}
+	assert.NotEmpty(t, subscription.Secret)
+	srv.secret = subscription.Secret
+
+	// the secret is only shown once
+	resp, err = authenticatedGet(token, "/webhooks/subscriptions")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var subscriptions []*app.WebhookSubscription
+	if assert.NoError(t, getResponseBody(resp.Body, &subscriptions)) && assert.Len(t, subscriptions, 1) {
+		assert.Equal(t, subscription.ID, subscriptions[0].ID)
+		assert.Empty(t, subscriptions[0].Secret)
+	}
+
+	// other users can't see nor delete the subscription
+	resp, err = authenticatedGet(tokenFor(sender.ID), "/webhooks/subscriptions/"+subscription.ID+"/deliveries")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = authenticatedDelete(tokenFor(sender.ID), "/webhooks/subscriptions/"+subscription.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// IDs that aren't UUIDs can't name anything
+	resp, err = authenticatedDelete(token, "/webhooks/subscriptions/not-a-uuid")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = authenticatedPost(token, "/webhooks/subscriptions/"+subscription.ID+"/deliveries/not-a-uuid/replay", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	cfg := &config.WebhookConfig{MaxAttempts: 2, RetryBackoff: time.Millisecond, MaxBackoff: time.Millisecond, AllowPrivateAddresses: true}
+	dispatcher := outbox.NewDispatcher(memory.NewOutboxRepository(store), store.RunInTx, nil, log.NewEntry(log.New()), webhook.NewFanout(subscriptionRepo, deliveryRepo))
+	deliverer := webhook.NewDeliverer(subscriptionRepo, deliveryRepo, store.RunInTx, cfg, log.NewEntry(log.New()))
+
+	transfer := func() {
+		resp, err := transaction(tokenFor(sender.ID), &handler.TransferPointsRequest{RecipientUserID: partner.ID, Points: 10})
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		_, err = dispatcher.Dispatch(context.Background())
+		assert.NoError(t, err)
+	}
+
+	transfer()
+	n, err := deliverer.Deliver(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	if assert.Len(t, srv.received, 1) {
+		assert.Equal(t, app.PointsTransferredEvent, srv.received[0].Header.Get(webhook.EventHeader))
+		assert.True(t, srv.verified[0], "the delivery must be signed with the subscription's secret")
+	}
+
+	// a delivery that keeps failing is given up on after cfg.MaxAttempts
+	srv.down = true
+	transfer()
+	for i := 0; i < cfg.MaxAttempts; i++ {
+		time.Sleep(2 * cfg.RetryBackoff)
+		_, err = deliverer.Deliver(context.Background())
+		assert.NoError(t, err)
+	}
+
+	deliveries := listDeliveries(t, token, subscription.ID)
+	if !assert.Len(t, deliveries, 2) {
+		return
+	}
+	assert.Equal(t, app.WebhookDeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, cfg.MaxAttempts, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].ResponseStatus)
+	assert.Equal(t, app.WebhookDeliverySuccess, deliveries[1].Status)
+
+	replay := "/webhooks/subscriptions/" + subscription.ID + "/deliveries/"
+	resp, err = authenticatedPost(token, replay+deliveries[1].ID+"/replay", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "only failed deliveries can be replayed")
+
+	srv.down = false
+	resp, err = authenticatedPost(token, replay+deliveries[0].ID+"/replay", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = deliverer.Deliver(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, srv.received, 2)
+	assert.Equal(t, app.WebhookDeliverySuccess, listDeliveries(t, token, subscription.ID)[0].Status)
+
+	// nothing is delivered to a deleted subscription
+	resp, err = authenticatedDelete(token, "/webhooks/subscriptions/"+subscription.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	transfer()
+	n, err = deliverer.Deliver(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func listDeliveries(t *testing.T, token string, subscriptionID string) []*app.WebhookDelivery {
+	resp, err := authenticatedGet(token, "/webhooks/subscriptions/"+subscriptionID+"/deliveries")
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var deliveries []*app.WebhookDelivery
+	assert.NoError(t, getResponseBody(resp.Body, &deliveries))
+	return deliveries
+}
+
+func TestMemoryWebhookPrivateAddresses(t *testing.T) {
+	testWebhooks = &config.WebhookConfig{}
+	t.Cleanup(func() { testWebhooks = &config.WebhookConfig{AllowPrivateAddresses: true} })
+	store := setupMemoryServer(t)
+	subscriptionRepo := memory.NewWebhookSubscriptionRepository(store)
+	deliveryRepo := memory.NewWebhookDeliveryRepository(store)
+
+	partner, err := seedOneUser("Partner", "partner@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sender, err := seedOneUser("Sender", "sender@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, u := range []*app.User{partner, sender} {
+		if _, err = seedPointBalanceForUser(u.ID, 100); !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	token := tokenFor(partner.ID)
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.5/hooks",
+		"http://192.168.1.1/hooks",
+		"http://[::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+		"http://0.0.0.0/hooks",
+	} {
+		resp, err := authenticatedPost(token, "/webhooks/subscriptions", &handler.WebhookSubscriptionRequest{URL: u})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, u)
+		resp.Body.Close()
+	}
+
+	// subscribed to an event the test doesn't trigger so nothing is sent out of the sandbox
+	public := &handler.WebhookSubscriptionRequest{URL: "https://93.184.216.34/hooks", Events: []string{app.UserRegisteredEvent}}
+	resp, err := authenticatedPost(token, "/webhooks/subscriptions", public)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// a subscription whose host resolves to a private address later on is refused when it's delivered to
+	srv := newSubscriber(t)
+	for _, u := range []string{srv.URL, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)} {
+		err = subscriptionRepo.CreateWebhookSubscription(context.Background(), &app.WebhookSubscription{
+			UserID: partner.ID,
+			URL:    u,
+			Events: []string{app.PointsTransferredEvent},
+			Secret: "whsec_test",
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	dispatcher := outbox.NewDispatcher(memory.NewOutboxRepository(store), store.RunInTx, nil, log.NewEntry(log.New()), webhook.NewFanout(subscriptionRepo, deliveryRepo))
+	deliverer := webhook.NewDeliverer(subscriptionRepo, deliveryRepo, store.RunInTx, &config.WebhookConfig{MaxAttempts: 1}, log.NewEntry(log.New()))
+
+	resp, err = transaction(tokenFor(sender.ID), &handler.TransferPointsRequest{RecipientUserID: partner.ID, Points: 10})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return
+	}
+
+	_, err = dispatcher.Dispatch(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = deliverer.Deliver(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, srv.received)
+
+	subscriptions, err := subscriptionRepo.ListUserWebhookSubscriptions(context.Background(), partner.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, subscription := range subscriptions {
+		if subscription.URL == public.URL {
+			continue
+		}
+
+		deliveries := listDeliveries(t, token, subscription.ID)
+		if assert.Len(t, deliveries, 1, subscription.URL) {
+			assert.Equal(t, app.WebhookDeliveryFailed, deliveries[0].Status)
+			assert.Contains(t, deliveries[0].LastError, webhook.ErrPrivateAddress.Error())
+		}
+	}
+}
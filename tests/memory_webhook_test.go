@@ -0,0 +1,79 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPaystackChargeSuccess(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, err := seedOneUser("Buyer", "buyer@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(user.ID, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	token := tokenFor(user.ID)
+	resp, err := authenticatedPost(token, "/topups", &handler.TopupRequest{Points: 30})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	topup := &handler.TopupResponse{}
+	if !assert.NoError(t, getResponseBody(resp.Body, topup)) {
+		return
+	}
+
+	charge := &paystack.Transaction{ID: 1, Status: paystack.StatusSuccess, Reference: topup.Reference, Amount: topup.Amount}
+
+	// a redelivered event must not credit the points again
+	for i := 0; i < 2; i++ {
+		resp, err = sendPaystackEvent(paystack.ChargeSuccess, charge, "")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assertBalance(t, user.ID, 30)
+	}
+
+	// the topup is settled so verifying it doesn't call Paystack
+	assertTopupStatus(t, token, topup.Reference, app.TopupSuccess)
+}
+
+func TestMemoryPaystackWebhookRejected(t *testing.T) {
+	setupMemoryServer(t)
+
+	charge := &paystack.Transaction{ID: 1, Status: paystack.StatusSuccess, Reference: "unknown", Amount: 100}
+
+	resp, err := sendPaystackEvent(paystack.ChargeSuccess, charge, "deadbeef")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// charges we didn't initialize are acknowledged so Paystack stops redelivering them
+	resp, err = sendPaystackEvent(paystack.ChargeSuccess, charge, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = sendPaystackEvent(paystack.TransferSuccess, map[string]interface{}{"reference": "unknown"}, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
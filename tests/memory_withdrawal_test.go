@@ -0,0 +1,216 @@
+//go:build !integration
+// +build !integration
+
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/handler"
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryWithdrawal(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, recipient, ok := seedWithdrawingUser(t, 1000)
+	if !ok {
+		return
+	}
+	token := tokenFor(user.ID)
+
+	withdrawal, ok := requestWithdrawal(t, token, recipient.ID, 300, http.StatusOK)
+	if !ok {
+		return
+	}
+	assert.Equal(t, app.WithdrawalProcessing, withdrawal.Status)
+	assert.EqualValues(t, 300*testWithdrawals.PointRate, withdrawal.Amount)
+
+	// the points are held until Paystack reports the outcome
+	assertBalance(t, user.ID, 700)
+	assertSystemBalance(t, app.WithdrawalHoldAccount, 300)
+
+	transfer := &paystack.Transfer{ID: 1, Reference: withdrawal.Reference, Status: paystack.StatusSuccess}
+	resp, err := sendPaystackEvent(paystack.TransferSuccess, transfer, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assertBalance(t, user.ID, 700)
+	assertSystemBalance(t, app.WithdrawalHoldAccount, 0)
+	assertSystemBalance(t, app.WithdrawalsPaidAccount, 300)
+	assertWithdrawalStatus(t, token, withdrawal.Reference, app.WithdrawalSuccess)
+
+	// a reversal gives the points back
+	transfer.Status = paystack.StatusReversed
+	resp, err = sendPaystackEvent(paystack.TransferReversed, transfer, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assertBalance(t, user.ID, 1000)
+	assertSystemBalance(t, app.WithdrawalsPaidAccount, 0)
+	assertWithdrawalStatus(t, token, withdrawal.Reference, app.WithdrawalFailed)
+}
+
+func TestMemoryWithdrawalReleased(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, recipient, ok := seedWithdrawingUser(t, 1000)
+	if !ok {
+		return
+	}
+	token := tokenFor(user.ID)
+
+	// a transfer Paystack rejects releases the hold straight away
+	paystackServer.answerTransfers(paystack.StatusFailed)
+	withdrawal, ok := requestWithdrawal(t, token, recipient.ID, 200, http.StatusOK)
+	if !ok {
+		return
+	}
+	assert.Equal(t, app.WithdrawalFailed, withdrawal.Status)
+	assert.NotEmpty(t, withdrawal.FailureReason)
+	assertBalance(t, user.ID, 1000)
+	assertSystemBalance(t, app.WithdrawalHoldAccount, 0)
+
+	// so does one that fails later
+	paystackServer.answerTransfers(paystack.StatusPending)
+	withdrawal, ok = requestWithdrawal(t, token, recipient.ID, 200, http.StatusOK)
+	if !ok {
+		return
+	}
+	assertBalance(t, user.ID, 800)
+
+	transfer := &paystack.Transfer{ID: 2, Reference: withdrawal.Reference, Status: paystack.StatusFailed}
+	for i := 0; i < 2; i++ {
+		resp, err := sendPaystackEvent(paystack.TransferFailed, transfer, "")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assertBalance(t, user.ID, 1000)
+	}
+}
+
+func TestMemoryWithdrawalLimits(t *testing.T) {
+	setupMemoryServer(t)
+
+	user, recipient, ok := seedWithdrawingUser(t, 2000)
+	if !ok {
+		return
+	}
+	token := tokenFor(user.ID)
+
+	// below the minimum and above the maximum of a single withdrawal
+	requestWithdrawal(t, token, recipient.ID, 5, http.StatusBadRequest)
+	requestWithdrawal(t, token, recipient.ID, 501, http.StatusBadRequest)
+
+	_, ok = requestWithdrawal(t, token, recipient.ID, 500, http.StatusOK)
+	if !ok {
+		return
+	}
+
+	// 600 points a day
+	requestWithdrawal(t, token, recipient.ID, 101, http.StatusUnprocessableEntity)
+	requestWithdrawal(t, token, recipient.ID, 100, http.StatusOK)
+	assertBalance(t, user.ID, 1400)
+
+	other, err := seedOneUser("Other", "other@gmail.com")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = seedPointBalanceForUser(other.ID, 1000)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// other users' bank accounts can't be used
+	requestWithdrawal(t, tokenFor(other.ID), recipient.ID, 100, http.StatusNotFound)
+	requestWithdrawal(t, tokenFor(user.ID), "not-a-uuid", 100, http.StatusNotFound)
+
+	resp, err := authenticatedPost(tokenFor(other.ID), "/bank-accounts", &handler.BankRecipientRequest{AccountNumber: unresolvableAccount, BankCode: "058"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// seedWithdrawingUser creates a user with points and a bank account to withdraw them to
+func seedWithdrawingUser(t *testing.T, points int64) (*app.User, *app.BankRecipient, bool) {
+	t.Helper()
+
+	user, err := seedOneUser("Withdrawer", "withdrawer@gmail.com")
+	if !assert.NoError(t, err) {
+		return nil, nil, false
+	}
+
+	_, err = seedPointBalanceForUser(user.ID, points)
+	if !assert.NoError(t, err) {
+		return nil, nil, false
+	}
+
+	resp, err := authenticatedPost(tokenFor(user.ID), "/bank-accounts", &handler.BankRecipientRequest{AccountNumber: "0123456789", BankCode: "058"})
+	if !assert.NoError(t, err) || !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return nil, nil, false
+	}
+
+	recipient := &app.BankRecipient{}
+	if !assert.NoError(t, getResponseBody(resp.Body, recipient)) {
+		return nil, nil, false
+	}
+	return user, recipient, true
+}
+
+func requestWithdrawal(t *testing.T, token string, recipientID string, points int64, wantCode int) (*app.Withdrawal, bool) {
+	t.Helper()
+
+	resp, err := authenticatedPost(token, "/withdrawals", &handler.WithdrawalRequest{BankRecipientID: recipientID, Points: points})
+	if !assert.NoError(t, err) || !assert.Equal(t, wantCode, resp.StatusCode) {
+		return nil, false
+	}
+
+	withdrawal := &app.Withdrawal{}
+	if !assert.NoError(t, getResponseBody(resp.Body, withdrawal)) {
+		return nil, false
+	}
+	return withdrawal, true
+}
+
+func assertWithdrawalStatus(t *testing.T, token string, reference string, want app.WithdrawalStatus) {
+	t.Helper()
+
+	resp, err := authenticatedGet(token, "/withdrawals/"+reference)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	withdrawal := &app.Withdrawal{}
+	if !assert.NoError(t, getResponseBody(resp.Body, withdrawal)) {
+		return
+	}
+	assert.Equal(t, want, withdrawal.Status)
+}
+
+// assertSystemBalance checks the balance of the system account identified by code
+func assertSystemBalance(t *testing.T, code string, want int64) {
+	t.Helper()
+	ctx := context.Background()
+
+	account, err := testHandler.ledgerRepository.FindAccountByCode(ctx, code)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	balance, err := testHandler.ledgerRepository.GetAccountBalance(ctx, account.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.EqualValues(t, want, balance)
+}
@@ -0,0 +1,57 @@
+//go:build integration
+// +build integration
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/datastore/postgres"
+	"github.com/danvixent/aboki-africa-assessment/outbox"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxPublisherDatabaseError(t *testing.T) {
+	ctx := context.Background()
+	outboxRepo := postgres.NewOutboxRepository(testClient)
+
+	event := &app.OutboxEvent{Type: "test.event", AggregateID: "failing-publisher", Payload: []byte("{}")}
+	err := testClient.RunInTx(ctx, func(ctx context.Context) error {
+		return outboxRepo.CreateOutboxEvent(ctx, event)
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a failed query aborts the transaction it runs in, the dispatcher must still record the attempt
+	dispatcher := outbox.NewDispatcher(outboxRepo, testClient.RunInTx, &config.OutboxConfig{BatchSize: 1000}, log.NewEntry(log.New()),
+		outbox.PublisherFunc(func(ctx context.Context, e *app.OutboxEvent) error {
+			if e.ID != event.ID {
+				return nil
+			}
+
+			tx, err := testClient.GetTx(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, "SELECT 1/0")
+			return err
+		}))
+
+	_, err = dispatcher.Dispatch(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var attempts int
+	var lastError string
+	err = testClient.QueryRow(ctx, "SELECT attempts, last_error FROM outbox_events WHERE id = $1", event.ID).Scan(&attempts, &lastError)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, attempts)
+		assert.Contains(t, lastError, "division by zero")
+	}
+}
@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/danvixent/aboki-africa-assessment/paystack"
+)
+
+const testPaystackKey = "sk_test_paystack"
+
+// unresolvableAccount is an account number fakePaystack can't create a transfer recipient for
+const unresolvableAccount = "0000000000"
+
+// fakePaystack stands in for the Paystack API, payments stay abandoned until they're paid with pay
+// and transfers are answered with transferStatus
+type fakePaystack struct {
+	*httptest.Server
+
+	lock           sync.Mutex
+	transactions   map[string]*paystack.Transaction
+	transfers      map[string]*paystack.InitiateTransferRequest
+	transferStatus string // pending unless set
+	down           bool   // answer every request with a server error
+}
+
+func newFakePaystack() *fakePaystack {
+	f := &fakePaystack{
+		transactions: map[string]*paystack.Transaction{},
+		transfers:    map[string]*paystack.InitiateTransferRequest{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// pay completes the payment identified by reference with amount
+func (f *fakePaystack) pay(reference string, amount int64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	txn := f.transactions[reference]
+	txn.Status, txn.Amount = paystack.StatusSuccess, amount
+}
+
+// answerTransfers sets the status new transfers are answered with, paystack.StatusFailed rejects them
+func (f *fakePaystack) answerTransfers(status string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.transferStatus = status
+}
+
+func (f *fakePaystack) setDown(down bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.down = down
+}
+
+func (f *fakePaystack) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.down {
+		respond(w, http.StatusInternalServerError, false, "something went wrong", nil)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+testPaystackKey {
+		respond(w, http.StatusUnauthorized, false, "Invalid key", nil)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/transaction/initialize":
+		req := &paystack.InitializeTransactionRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respond(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+
+		f.transactions[req.Reference] = &paystack.Transaction{
+			ID:        int64(len(f.transactions) + 1),
+			Status:    paystack.StatusAbandoned,
+			Reference: req.Reference,
+			Amount:    req.Amount,
+			Currency:  "NGN",
+		}
+		respond(w, http.StatusOK, true, "Authorization URL created", &paystack.InitializeTransactionResponse{
+			AuthorizationURL: "https://checkout.paystack.com/" + req.Reference,
+			AccessCode:       req.Reference,
+			Reference:        req.Reference,
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/transferrecipient":
+		req := &paystack.CreateTransferRecipientRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respond(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+
+		if req.AccountNumber == unresolvableAccount {
+			respond(w, http.StatusUnprocessableEntity, false, "Cannot resolve account", nil)
+			return
+		}
+
+		recipient := &paystack.TransferRecipient{RecipientCode: "RCP_" + req.AccountNumber, Name: req.Name}
+		recipient.Details.AccountNumber, recipient.Details.AccountName = req.AccountNumber, req.Name
+		recipient.Details.BankCode, recipient.Details.BankName = req.BankCode, "Test Bank"
+		respond(w, http.StatusCreated, true, "Transfer recipient created successfully", recipient)
+	case r.Method == http.MethodPost && r.URL.Path == "/transfer":
+		req := &paystack.InitiateTransferRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			respond(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+
+		if f.transferStatus == paystack.StatusFailed {
+			respond(w, http.StatusBadRequest, false, "Your balance is not enough to fulfil this request", nil)
+			return
+		}
+
+		status := f.transferStatus
+		if status == "" {
+			status = paystack.StatusPending
+		}
+
+		f.transfers[req.Reference] = req
+		respond(w, http.StatusOK, true, "Transfer has been queued", &paystack.Transfer{
+			ID:           int64(len(f.transfers)),
+			TransferCode: "TRF_" + req.Reference,
+			Reference:    req.Reference,
+			Amount:       req.Amount,
+			Status:       status,
+		})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/transaction/verify/"):
+		txn, ok := f.transactions[strings.TrimPrefix(r.URL.Path, "/transaction/verify/")]
+		if !ok {
+			respond(w, http.StatusBadRequest, false, "Transaction reference not found", nil)
+			return
+		}
+		respond(w, http.StatusOK, true, "Verification successful", txn)
+	default:
+		respond(w, http.StatusNotFound, false, "not found", nil)
+	}
+}
+
+func respond(w http.ResponseWriter, status int, ok bool, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": ok, "message": message, "data": data})
+}
+
+// sendPaystackEvent delivers a webhook for event about data, signed with testPaystackKey unless signature is given
+func sendPaystackEvent(event string, data interface{}, signature string) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{"event": event, "data": data})
+	if err != nil {
+		return nil, err
+	}
+
+	if signature == "" {
+		mac := hmac.New(sha512.New, []byte(testPaystackKey))
+		mac.Write(body)
+		signature = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url+"/webhooks/paystack", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set(paystack.SignatureHeader, signature)
+	return http.DefaultClient.Do(r)
+}
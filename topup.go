@@ -0,0 +1,37 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+type TopupStatus string
+
+const (
+	TopupPending TopupStatus = "pending"
+	TopupSuccess TopupStatus = "success"
+	TopupFailed  TopupStatus = "failed"
+)
+
+// Topup is a purchase of points paid for through Paystack, the points are
+// credited to the user once the payment is verified
+type Topup struct {
+	ID        string      `json:"id"`
+	UserID    string      `json:"user_id"`
+	Reference string      `json:"reference"` // the Paystack transaction reference
+	Points    int64       `json:"points"`
+	Amount    int64       `json:"amount"` // price of Points in kobo
+	Status    TopupStatus `json:"status"`
+	PaidAt    *time.Time  `json:"paid_at"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type TopupRepository interface {
+	CreateTopup(ctx context.Context, topup *Topup) error
+	FindTopupByReference(ctx context.Context, reference string) (*Topup, error)
+	// LockTopupByReference finds the topup and locks it until the transaction in ctx ends,
+	// so a payment is never credited twice
+	LockTopupByReference(ctx context.Context, reference string) (*Topup, error)
+	UpdateTopupStatus(ctx context.Context, topup *Topup) error
+}
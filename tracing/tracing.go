@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/jackc/pgx/v4"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer every span of the service is started with
+const InstrumentationName = "github.com/danvixent/aboki-africa-assessment"
+
+const DefaultServiceName = "aboki-africa-assessment"
+
+// exporters config.TracingConfig.Exporter may name
+const (
+	NoExporter     = "none"
+	StdoutExporter = "stdout"
+	FileExporter   = "file"
+)
+
+// Setup installs the W3C trace context propagator and the tracer provider cfg describes as the global ones.
+// The function it returns flushes the spans that haven't been exported yet, it must be called before exiting.
+func Setup(cfg *config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if cfg == nil {
+		cfg = &config.TracingConfig{}
+	}
+
+	var out io.Writer
+	closeOut := func() error { return nil }
+	switch cfg.Exporter {
+	case "", NoExporter:
+		// the global provider stays a no-op one, incoming trace context is still passed on
+		return func(context.Context) error { return nil }, nil
+	case StdoutExporter:
+		out = os.Stdout
+	case FileExporter:
+		if cfg.File == "" {
+			return nil, errors.New("tracing.file is required by the file exporter")
+		}
+
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open tracing file")
+		}
+		out, closeOut = f, f.Close
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q, expected none, stdout or file", cfg.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+	if err != nil {
+		closeOut()
+		return nil, errors.Wrap(err, "failed to create span exporter")
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		// callers that sampled a trace keep it sampled here, the ratio only applies to traces started here
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeErr := closeOut(); err == nil {
+			err = closeErr
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span named name as a child of the span in ctx, if there's one
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(InstrumentationName).Start(ctx, name, opts...)
+}
+
+// RecordError marks span as failed with err, pgx.ErrNoRows is an expected outcome rather than a failure
+func RecordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Extract returns ctx with the trace context carried by header, so spans started with it continue the caller's trace
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject adds the trace context of ctx to header, so the server the request is sent to continues the trace
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
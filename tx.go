@@ -1,3 +1,19 @@
 package aboki_africa_assessment
 
+import "context"
+
 const TxContextKey = "tx_key"
+
+// Tx is a database transaction as seen by the handlers, repositories
+// find the active transaction in the context under TxContextKey
+type Tx interface {
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// TxRunner runs fn in a transaction stored in the ctx it's given, the transaction is committed
+// if fn succeeds and rolled back otherwise. fn may be called more than once when the
+// datastore retries transactions that failed to serialize, so it must not have side effects
+// outside the transaction. When ctx already carries a transaction fn runs in a savepoint of it,
+// if fn fails only its own changes are rolled back and the transaction can go on.
+type TxRunner func(ctx context.Context, fn func(ctx context.Context) error) error
@@ -6,13 +6,21 @@ import (
 )
 
 type User struct {
-	ID           string     `json:"id"`
-	Name         string     `json:"name"`
-	Email        string     `json:"email"`
-	ReferralCode string     `json:"referral_code"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	DeletedAt    *time.Time `json:"deleted_at"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	ReferralCode string    `json:"referral_code"`
+	PasswordHash string    `json:"-"` // bcrypt hash of the password used to log in
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// DeactivatedAt is set while the user is suspended, they can't log in nor send or receive points
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+}
+
+// Active reports whether the user is neither deactivated nor deleted
+func (u *User) Active() bool {
+	return u.DeactivatedAt == nil && u.DeletedAt == nil
 }
 
 type UserReferral struct {
@@ -20,11 +28,45 @@ type UserReferral struct {
 	ReferrerID string     `json:"referrer_id"` // ID of the user whose referral code was used
 	RefereeID  string     `json:"referee_id"`  // ID of the user who was referred
 	PaidOut    bool       `json:"paid_out"`    // has this referral bonus being paid out to the referrer
+	Held       bool       `json:"held"`        // held referrals were flagged as fraudulent, they count for nothing until released
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
 	DeletedAt  *time.Time `json:"deleted_at"`
 }
 
+// ReferralStatus is where a referral stands with respect to the signup bonus
+type ReferralStatus string
+
+const (
+	ReferralPending ReferralStatus = "pending" // counts towards the referrer's next signup bonus
+	ReferralPaid    ReferralStatus = "paid"
+	ReferralOnHold  ReferralStatus = "held" // flagged by the fraud checks, see UserReferral.Held
+)
+
+// ReferralNode is a user in someone's referral tree, Depth is 1 for the users they referred directly
+type ReferralNode struct {
+	UserID     string          `json:"user_id"`
+	Name       string          `json:"name"`
+	ReferrerID string          `json:"referrer_id"`
+	Depth      int             `json:"depth"`
+	Status     ReferralStatus  `json:"status"`
+	Active     bool            `json:"active"` // false while the user is deactivated
+	ReferredAt time.Time       `json:"referred_at"`
+	Referees   []*ReferralNode `json:"referees,omitempty"`
+}
+
+// ReferralStatusOf returns the status of referral r
+func ReferralStatusOf(r *UserReferral) ReferralStatus {
+	switch {
+	case r.Held:
+		return ReferralOnHold
+	case r.PaidOut:
+		return ReferralPaid
+	default:
+		return ReferralPending
+	}
+}
+
 type ReferredUserTransactionBonus struct {
 	ID         string     `json:"id"`
 	ReferrerID string     `json:"referrer_id"` // ID of the user whose referral code was used
@@ -36,17 +78,47 @@ type ReferredUserTransactionBonus struct {
 }
 
 type UserRepository interface {
+	// CreateUser returns errors.ErrEmailTaken when the email is already used and errors.ErrDuplicateReferralCode
+	// when the referral code is, the transaction in ctx can still be used after the latter to try another code
 	CreateUser(ctx context.Context, user *User) error
-	FindUserByID(ctx context.Context, id string) error
+	FindUserByID(ctx context.Context, id string) (*User, error)
 	FindUserByReferralCode(ctx context.Context, code string) (*User, error)
+	FindUserByEmail(ctx context.Context, email string) (*User, error)
+	// FindUserByIDWithDeleted is FindUserByID that also finds soft-deleted users
+	FindUserByIDWithDeleted(ctx context.Context, id string) (*User, error)
+	// UpdateUserLifecycle saves the DeactivatedAt and DeletedAt of user
+	UpdateUserLifecycle(ctx context.Context, user *User) error
 }
 
 type UserReferralRepository interface {
 	CreateUserReferral(ctx context.Context, referral *UserReferral) error
 	GetUnpaidUserReferralCount(ctx context.Context, userID string) (int64, error)
-	MarkPendingReferralsAsPaid(ctx context.Context, referrerID string) error
+	// MarkPendingReferralsAsPaid marks the oldest limit unpaid referrals of referrerID as paid and returns
+	// their referees, oldest first
+	MarkPendingReferralsAsPaid(ctx context.Context, referrerID string, limit int64) ([]string, error)
+	// GetUserReferrer returns who referred userID unless the referral is deleted, the referrer is returned
+	// even when they're deleted or the referral is held
 	GetUserReferrer(ctx context.Context, userID string) (*User, error)
+	// CreateReferredUserTransactionBonus returns errors.ErrDuplicate when the referee already has a bonus,
+	// the transaction in ctx can still be used after it
 	CreateReferredUserTransactionBonus(ctx context.Context, referral *ReferredUserTransactionBonus) error
-	GetUnpaidReferredUserTransactionBonus(ctx context.Context, userID string) ([]*ReferredUserTransactionBonus, error)
+	// GetUnpaidReferredUserTransactionBonus returns the oldest limit unpaid bonuses of userID, all of them when limit is zero.
+	// Bonuses of held referrals are left out until they're released.
+	GetUnpaidReferredUserTransactionBonus(ctx context.Context, userID string, limit int64) ([]*ReferredUserTransactionBonus, error)
 	PayReferralsTransactionsBonuses(ctx context.Context, ids []string) error
+	// ListPaidReferredUserTransactionBonuses returns every paid out referred user transaction bonus, oldest first
+	ListPaidReferredUserTransactionBonuses(ctx context.Context) ([]*ReferredUserTransactionBonus, error)
+	// DeleteUnpaidRefereeReferrals soft-deletes at deletedAt the unpaid referral and transaction bonus of
+	// refereeID, so they no longer count towards their referrer's bonuses
+	DeleteUnpaidRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error
+	// RestoreRefereeReferrals restores the referrals and bonuses of refereeID deleted at deletedAt
+	RestoreRefereeReferrals(ctx context.Context, refereeID string, deletedAt time.Time) error
+	// ReleaseHeldReferral makes the held referral of refereeID count towards their referrer's bonuses
+	ReleaseHeldReferral(ctx context.Context, refereeID string) error
+	// GetReferralTree returns the users userID referred, the users they referred and so on down to depth
+	// levels, ordered by depth then referral time. Deleted users and the users below them are left out.
+	GetReferralTree(ctx context.Context, userID string, depth int) ([]*ReferralNode, error)
+	// GetReferralUpline returns userID's referrer, their referrer and so on up to depth levels, nearest
+	// first. Held and deleted referrals end the chain, deleted referrers are returned so levels aren't skipped.
+	GetReferralUpline(ctx context.Context, userID string, depth int) ([]*User, error)
 }
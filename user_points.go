@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// UserPoints caches a user's ledger balance, Points is maintained by
+// LedgerRepository.PostJournalEntry and must always equal the sum of the
+// postings on the user's Account
 type UserPoints struct {
 	ID        string     `json:"id"`
 	UserID    string     `json:"user_id"`
@@ -24,12 +27,46 @@ type Transaction struct {
 	DeletedAt       *time.Time `json:"deleted_at"`
 }
 
+// directions of a TransactionHistoryItem, relative to the user whose history it is
+const (
+	SentDirection     = "sent"
+	ReceivedDirection = "received"
+)
+
+// TransactionHistoryItem is one point movement on a user's account, taken from the ledger
+type TransactionHistoryItem struct {
+	ID                 string           `json:"id"`
+	Kind               JournalEntryKind `json:"kind"`
+	Direction          string           `json:"direction"`
+	Points             int64            `json:"points"`
+	CounterpartyUserID *string          `json:"counterparty_user_id"` // nil when the other side is a system account
+	Reference          string           `json:"reference"`
+	Description        string           `json:"description"`
+	CreatedAt          time.Time        `json:"created_at"`
+}
+
+// TransactionHistoryFilter narrows down a user's history, items are returned newest first
+// and only items strictly older than the (Before, BeforeID) cursor are included
+type TransactionHistoryFilter struct {
+	Direction string // SentDirection, ReceivedDirection or empty for both
+	From      *time.Time
+	To        *time.Time
+	Before    *time.Time
+	BeforeID  string
+	Limit     int
+}
+
 type UserPointRepository interface {
-	CreditUser(ctx context.Context, userID string, points int64) error
 	CreateUserPoint(ctx context.Context, userPoint *UserPoints) error
 	GetUserPointsBalance(ctx context.Context, userID string) (int64, error)
+	// LockUserPointsBalance reads userID's balance and locks it until the transaction in ctx ends,
+	// concurrent transfers from the same user are serialized by it
+	LockUserPointsBalance(ctx context.Context, userID string) (int64, error)
 	GetUserTotalTransferredPoints(ctx context.Context, userID string) (int64, error)
 	CreatePointTransaction(ctx context.Context, txn *Transaction) error
-	DebitUser(ctx context.Context, points int64, userID string) error
-	TransferPoints(ctx context.Context, senderID string, recipientID string, points int64) error
+	// ListPointTransactions returns every point transfer, oldest first
+	ListPointTransactions(ctx context.Context) ([]*Transaction, error)
+	ListUserTransactions(ctx context.Context, userID string, filter *TransactionHistoryFilter) ([]*TransactionHistoryItem, error)
+	GetUserReferralEarnings(ctx context.Context, userID string) (int64, error)
+	GetUserLastActivity(ctx context.Context, userID string) (*time.Time, error)
 }
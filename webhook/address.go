@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// ErrPrivateAddress is returned for webhook URLs that resolve to this server's own host or network
+var ErrPrivateAddress = errors.New("webhook URLs must resolve to public addresses")
+
+// privateNetworks are the ranges net.IP has no predicate for that deliveries mustn't reach
+var privateNetworks = parseCIDRs(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"172.16.0.0/12",  // private
+	"192.168.0.0/16", // private
+	"fc00::/7",       // unique local
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// IsPublic reports whether ip may be sent deliveries: loopback, private, link-local, multicast and
+// unspecified addresses, like 127.0.0.1, 10.0.0.1 or the 169.254.169.254 metadata endpoint, aren't
+func IsPublic(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of u and returns ErrPrivateAddress when any of its addresses isn't public
+func CheckURL(ctx context.Context, u *url.URL) error {
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublic(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return errors.Wrap(err, "failed to resolve "+host)
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// refusePrivate is a net.Dialer Control hook refusing connections to addresses that aren't public. It runs
+// on the address being dialed once the host is resolved, so a host that's pointed at an internal address
+// after its subscription was checked is refused too, and so is every redirect.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+		return fmt.Errorf("refusing to connect to %s: %w", host, ErrPrivateAddress)
+	}
+	return nil
+}
+
+// newHTTPClient returns the client deliveries are sent with, it can only reach public addresses unless
+// allowPrivate is set. Proxies aren't used since they'd connect to the subscriber on the client's behalf.
+func newHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/config"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+	"github.com/jackc/pgx/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultBatchSize    = 20
+	DefaultTimeout      = 10 * time.Second
+	DefaultMaxAttempts  = 8
+	DefaultRetryBackoff = 30 * time.Second
+	DefaultMaxBackoff   = time.Hour
+)
+
+// Deliverer POSTs queued deliveries to their subscriptions. A delivery is leased before it's sent so
+// requests aren't made while a transaction is open, if the process dies mid-delivery the lease runs
+// out and the delivery is sent again. Subscribers get every delivery at least once.
+type Deliverer struct {
+	subscriptionRepository app.WebhookSubscriptionRepository
+	deliveryRepository     app.WebhookDeliveryRepository
+	runInTx                app.TxRunner
+	httpClient             *http.Client
+	pollInterval           time.Duration
+	batchSize              int
+	maxAttempts            int
+	retryBackoff           time.Duration
+	maxBackoff             time.Duration
+	logger                 *log.Entry
+}
+
+// NewDeliverer returns a Deliverer, defaults are used for the fields of cfg that aren't set. Deliveries
+// are only sent to public addresses unless cfg allows private ones.
+func NewDeliverer(subscriptionRepository app.WebhookSubscriptionRepository, deliveryRepository app.WebhookDeliveryRepository, runInTx app.TxRunner, cfg *config.WebhookConfig, logger *log.Entry) *Deliverer {
+	d := &Deliverer{
+		subscriptionRepository: subscriptionRepository,
+		deliveryRepository:     deliveryRepository,
+		runInTx:                runInTx,
+		httpClient:             newHTTPClient(DefaultTimeout, cfg != nil && cfg.AllowPrivateAddresses),
+		pollInterval:           DefaultPollInterval,
+		batchSize:              DefaultBatchSize,
+		maxAttempts:            DefaultMaxAttempts,
+		retryBackoff:           DefaultRetryBackoff,
+		maxBackoff:             DefaultMaxBackoff,
+		logger:                 logger,
+	}
+
+	if cfg != nil {
+		if cfg.PollInterval > 0 {
+			d.pollInterval = cfg.PollInterval
+		}
+		if cfg.BatchSize > 0 {
+			d.batchSize = cfg.BatchSize
+		}
+		if cfg.Timeout > 0 {
+			d.httpClient.Timeout = cfg.Timeout
+		}
+		if cfg.MaxAttempts > 0 {
+			d.maxAttempts = cfg.MaxAttempts
+		}
+		if cfg.RetryBackoff > 0 {
+			d.retryBackoff = cfg.RetryBackoff
+		}
+		if cfg.MaxBackoff > 0 {
+			d.maxBackoff = cfg.MaxBackoff
+		}
+	}
+	return d
+}
+
+// Run delivers webhooks until ctx is done, a full batch is followed by another one right away
+func (d *Deliverer) Run(ctx context.Context) {
+	for {
+		n, err := d.Deliver(ctx)
+		if err != nil {
+			d.logger.WithError(err).Error("failed to deliver webhooks")
+		}
+
+		wait := d.pollInterval
+		if err == nil && n == d.batchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Deliver sends one batch of due deliveries and returns how many it claimed
+func (d *Deliverer) Deliver(ctx context.Context) (int, error) {
+	var deliveries []*app.WebhookDelivery
+	err := d.runInTx(ctx, func(ctx context.Context) error {
+		var err error
+		deliveries, err = d.deliveryRepository.ClaimWebhookDeliveries(ctx, d.batchSize)
+		if err != nil {
+			return err
+		}
+
+		// every delivery of the batch may take the full timeout, the lease must outlast them all
+		lease := time.Now().Add(time.Duration(len(deliveries)+1) * d.httpClient.Timeout)
+		for _, delivery := range deliveries {
+			delivery.NextAttemptAt = lease
+			if err = d.deliveryRepository.UpdateWebhookDelivery(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		if err = d.deliver(ctx, delivery); err != nil {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// deliver sends delivery and records the outcome of the attempt
+func (d *Deliverer) deliver(ctx context.Context, delivery *app.WebhookDelivery) error {
+	subscription, err := d.subscriptionRepository.FindWebhookSubscriptionByID(ctx, delivery.SubscriptionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// the subscription was deleted since the delivery was claimed, it's left as is
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	logger := d.logger.WithFields(log.Fields{"delivery_id": delivery.ID, "subscription_id": subscription.ID, "event_type": delivery.EventType})
+
+	status, sendErr := d.send(ctx, subscription, delivery)
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+
+	now := time.Now()
+	switch {
+	case sendErr == nil:
+		delivery.Status, delivery.LastError, delivery.DeliveredAt = app.WebhookDeliverySuccess, "", &now
+	case delivery.Attempts >= d.maxAttempts:
+		logger.WithError(sendErr).Warn("webhook delivery failed for good")
+		delivery.Status, delivery.LastError = app.WebhookDeliveryFailed, sendErr.Error()
+	default:
+		logger.WithError(sendErr).Info("webhook delivery failed, it'll be retried")
+		delivery.LastError, delivery.NextAttemptAt = sendErr.Error(), now.Add(d.backoff(delivery.Attempts))
+	}
+
+	return d.runInTx(ctx, func(ctx context.Context) error {
+		return d.deliveryRepository.UpdateWebhookDelivery(ctx, delivery)
+	})
+}
+
+// send POSTs delivery to subscription's URL and returns the status code of the response,
+// anything but a 2xx status is an error
+func (d *Deliverer) send(ctx context.Context, subscription *app.WebhookSubscription, delivery *app.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, fmt.Sprint(now.Unix()))
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, now, delivery.Payload))
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drain a bit of the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the next attempt of a delivery that failed attempts times
+func (d *Deliverer) backoff(attempts int) time.Duration {
+	wait := d.retryBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.maxBackoff {
+		wait = d.maxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,70 @@
+// Package webhook delivers outbox events to the webhook subscriptions of the users they concern
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	app "github.com/danvixent/aboki-africa-assessment"
+	"github.com/danvixent/aboki-africa-assessment/errors"
+)
+
+// Body is the JSON body POSTed to a subscription
+type Body struct {
+	ID        string          `json:"id"` // ID of the event, subscribers can use it to drop duplicates
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Fanout is an outbox.Publisher that queues a WebhookDelivery of each event for every subscription that
+// wants it. It's meant to run in the dispatcher's transaction, so deliveries are queued exactly once
+// per event even when the outbox publishes it more than once.
+type Fanout struct {
+	subscriptionRepository app.WebhookSubscriptionRepository
+	deliveryRepository     app.WebhookDeliveryRepository
+}
+
+func NewFanout(subscriptionRepository app.WebhookSubscriptionRepository, deliveryRepository app.WebhookDeliveryRepository) *Fanout {
+	return &Fanout{subscriptionRepository: subscriptionRepository, deliveryRepository: deliveryRepository}
+}
+
+func (f *Fanout) Publish(ctx context.Context, event *app.OutboxEvent) error {
+	userIDs, err := event.UserIDs()
+	if err != nil {
+		return errors.Wrap(err, "failed to decode event payload")
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	subscriptions, err := f.subscriptionRepository.ListWebhookSubscriptionsForUsers(ctx, userIDs)
+	if err != nil {
+		return errors.Wrap(err, "failed to list webhook subscriptions")
+	}
+
+	body, err := json.Marshal(&Body{ID: event.ID, Type: event.Type, CreatedAt: event.CreatedAt, Data: event.Payload})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode webhook body")
+	}
+
+	for _, s := range subscriptions {
+		if !s.Wants(event.Type) {
+			continue
+		}
+
+		err = f.deliveryRepository.CreateWebhookDelivery(ctx, &app.WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        body,
+			Status:         app.WebhookDeliveryPending,
+		})
+		if err != nil && !errors.Is(err, errors.ErrDuplicate) {
+			return errors.Wrap(err, "failed to queue webhook delivery")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// headers of a delivery
+const (
+	SignatureHeader = "X-Webhook-Signature" // Sign of the timestamp and body
+	TimestampHeader = "X-Webhook-Timestamp" // unix seconds the delivery was sent at
+	EventHeader     = "X-Webhook-Event"     // type of the event delivered
+	DeliveryHeader  = "X-Webhook-Delivery"  // ID of the delivery, it's the same on every retry
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with secret. Subscribers should
+// compute it over the raw body they receive and reject deliveries with a stale timestamp to prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is Sign of timestamp and body, timestamp is the
+// raw value of TimestampHeader
+func VerifySignature(secret string, timestamp string, body []byte, signature string) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	expected := Sign(secret, time.Unix(unix, 0), body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
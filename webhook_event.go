@@ -0,0 +1,22 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+// WebhookEvent is an event a payment provider delivered to us, it's kept so
+// an event that's delivered more than once is only applied once
+type WebhookEvent struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"` // e.g "paystack"
+	EventID   string    `json:"event_id"` // identifies the event within Provider
+	Event     string    `json:"event"`    // the event type, e.g "charge.success"
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookEventRepository interface {
+	// CreateWebhookEvent fails with a duplicate error when the event was already recorded
+	CreateWebhookEvent(ctx context.Context, event *WebhookEvent) error
+}
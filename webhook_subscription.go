@@ -0,0 +1,78 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription asks for the outbox events of the given types a user is a party to, see
+// OutboxEvent.UserIDs, to be POSTed to URL. Every delivery is signed with Secret.
+type WebhookSubscription struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	URL       string     `json:"url"`
+	Events    []string   `json:"events"`           // types of OutboxEvent delivered, every type when empty
+	Secret    string     `json:"secret,omitempty"` // only shown when the subscription is created
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Wants reports whether events of eventType should be delivered to the subscription
+func (s *WebhookSubscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending" // waiting for its first attempt or a retry
+	WebhookDeliverySuccess WebhookDeliveryStatus = "success"
+	WebhookDeliveryFailed  WebhookDeliveryStatus = "failed" // every attempt failed, it's only retried when replayed
+)
+
+// WebhookDelivery is an outbox event on its way to a WebhookSubscription, it doubles as the delivery log
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	SubscriptionID string                `json:"subscription_id"`
+	EventID        string                `json:"event_id"`
+	EventType      string                `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"` // the request body sent to the subscription's URL
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	ResponseStatus int                   `json:"response_status"` // HTTP status of the last attempt, 0 when no response came
+	LastError      string                `json:"last_error"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	DeliveredAt    *time.Time            `json:"delivered_at"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
+
+type WebhookSubscriptionRepository interface {
+	CreateWebhookSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	FindWebhookSubscriptionByID(ctx context.Context, id string) (*WebhookSubscription, error)
+	ListUserWebhookSubscriptions(ctx context.Context, userID string) ([]*WebhookSubscription, error)
+	// ListWebhookSubscriptionsForUsers returns the subscriptions of any of userIDs
+	ListWebhookSubscriptionsForUsers(ctx context.Context, userIDs []string) ([]*WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+}
+
+type WebhookDeliveryRepository interface {
+	CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	FindWebhookDeliveryByID(ctx context.Context, id string) (*WebhookDelivery, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are due, of subscriptions that
+	// weren't deleted. They're locked until the transaction in ctx ends so concurrent workers skip them.
+	ClaimWebhookDeliveries(ctx context.Context, limit int) ([]*WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// ListSubscriptionWebhookDeliveries returns the latest limit deliveries to subscriptionID, newest first
+	ListSubscriptionWebhookDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*WebhookDelivery, error)
+}
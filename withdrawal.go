@@ -0,0 +1,70 @@
+package aboki_africa_assessment
+
+import (
+	"context"
+	"time"
+)
+
+// BankRecipient is a bank account a user cashes points out to, it's registered with
+// Paystack as a transfer recipient
+type BankRecipient struct {
+	ID            string     `json:"id"`
+	UserID        string     `json:"user_id"`
+	RecipientCode string     `json:"recipient_code"` // the Paystack transfer recipient code
+	AccountNumber string     `json:"account_number"`
+	AccountName   string     `json:"account_name"`
+	BankCode      string     `json:"bank_code"`
+	BankName      string     `json:"bank_name"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+}
+
+type WithdrawalStatus string
+
+const (
+	WithdrawalPending    WithdrawalStatus = "pending"    // points are on hold, the transfer hasn't been accepted by Paystack yet
+	WithdrawalProcessing WithdrawalStatus = "processing" // Paystack accepted the transfer and hasn't reported its outcome
+	WithdrawalSuccess    WithdrawalStatus = "success"
+	WithdrawalFailed     WithdrawalStatus = "failed" // the hold was released back to the user
+)
+
+// Withdrawal is a cash-out of points to a BankRecipient. Requesting it moves the points from the
+// user's account to WithdrawalHoldAccount, they move on to WithdrawalsPaidAccount when the transfer
+// succeeds or back to the user when it fails.
+type Withdrawal struct {
+	ID              string           `json:"id"`
+	UserID          string           `json:"user_id"`
+	BankRecipientID string           `json:"bank_recipient_id"`
+	Reference       string           `json:"reference"` // the Paystack transfer reference
+	Points          int64            `json:"points"`
+	Amount          int64            `json:"amount"` // kobo paid out for Points
+	Status          WithdrawalStatus `json:"status"`
+	TransferCode    string           `json:"transfer_code"`
+	FailureReason   string           `json:"failure_reason"`
+	CompletedAt     *time.Time       `json:"completed_at"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+}
+
+// Completed reports whether the withdrawal's outcome is final
+func (w *Withdrawal) Completed() bool {
+	return w.Status == WithdrawalSuccess || w.Status == WithdrawalFailed
+}
+
+type BankRecipientRepository interface {
+	CreateBankRecipient(ctx context.Context, recipient *BankRecipient) error
+	FindBankRecipientByID(ctx context.Context, id string) (*BankRecipient, error)
+	ListUserBankRecipients(ctx context.Context, userID string) ([]*BankRecipient, error)
+}
+
+type WithdrawalRepository interface {
+	CreateWithdrawal(ctx context.Context, withdrawal *Withdrawal) error
+	FindWithdrawalByReference(ctx context.Context, reference string) (*Withdrawal, error)
+	// LockWithdrawalByReference finds the withdrawal and locks it until the transaction in ctx ends,
+	// so its hold is settled once
+	LockWithdrawalByReference(ctx context.Context, reference string) (*Withdrawal, error)
+	UpdateWithdrawal(ctx context.Context, withdrawal *Withdrawal) error
+	// GetUserWithdrawnPointsSince sums the points of userID's withdrawals created since, failed ones excluded
+	GetUserWithdrawnPointsSince(ctx context.Context, userID string, since time.Time) (int64, error)
+}